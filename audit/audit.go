@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Upstream is the result of the transaction forwarded to upstream
+type Upstream struct {
+	Status int    `json:"status"` // HTTP status code
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Record is an audit record of the guard decision on a transaction
+type Record struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	ClientIP  string    `json:"clientIP,omitempty"`
+	APIKey    string    `json:"apiKey,omitempty"`
+	TxHash    string    `json:"txHash,omitempty"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Nonce     uint64    `json:"nonce"`
+	Decision  string    `json:"decision"`
+	Status    int       `json:"status"`           // the guard status of the rules
+	Reason    string    `json:"reason,omitempty"` // the text of rejected status
+	Upstream  *Upstream `json:"upstream,omitempty"`
+
+	// Prev is the hash of the previous record, and Hash is the SHA-256 of the
+	// record with Hash empty, set if the log is hash chained
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// Log is an append-only JSON lines file of audit records, rotated by size and age
+type Log struct {
+	path    string
+	maxSize int64         // rotate if the file is larger, 0 to disable
+	maxAge  time.Duration // rotate if the file is older, 0 to disable
+	chain   bool
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	seq    uint64
+	prev   string
+}
+
+// Open opens the audit log at path for appending, the sequence and hash chain
+// continue from the last record in the file
+func Open(path string, maxSize int64, maxAge time.Duration, chain bool) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, maxAge: maxAge, chain: chain}
+
+	if f, err := os.Open(path); err == nil {
+		var last Record
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) > 0 {
+				last = Record{}
+				if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+					f.Close()
+					return nil, fmt.Errorf("audit log %s corrupted: %v", path, err)
+				}
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		l.seq = last.Seq
+		l.prev = last.Hash
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	l.opened = time.Now()
+	return nil
+}
+
+// rotate renames the current file with the time suffix, and opens a new file
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	rotated := fmt.Sprintf("%s.%s", l.path, time.Now().Format("20060102T150405.000000000"))
+	if err := os.Rename(l.path, rotated); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// Write appends the record, set its sequence, and hash if chained
+func (l *Log) Write(rec *Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errors.New("audit log closed")
+	}
+	if l.size > 0 && ((l.maxSize > 0 && l.size >= l.maxSize) || (l.maxAge > 0 && time.Since(l.opened) >= l.maxAge)) {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	rec.Seq = l.seq + 1
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if l.chain {
+		rec.Prev = l.prev
+		hash, err := recordHash(rec)
+		if err != nil {
+			return err
+		}
+		rec.Hash = hash
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	n, err := l.file.Write(append(b, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	l.seq = rec.Seq
+	l.prev = rec.Hash
+
+	return nil
+}
+
+// Close closes the file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// recordHash returns the hex SHA-256 of the record JSON with Hash empty
+func recordHash(rec *Record) (string, error) {
+	r := *rec
+	r.Hash = ""
+	b, err := json.Marshal(&r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify verifies the hash chain of the records read from r, starting from the
+// prev hash, and returns the number of records and the last hash
+func Verify(r io.Reader, prev string) (int, string, error) {
+	n := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return n, prev, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if rec.Prev != prev {
+			return n, prev, fmt.Errorf("record %d: previous hash mismatch", rec.Seq)
+		}
+		hash, err := recordHash(&rec)
+		if err != nil {
+			return n, prev, err
+		}
+		if hash != rec.Hash {
+			return n, prev, fmt.Errorf("record %d: hash mismatch", rec.Seq)
+		}
+		prev = rec.Hash
+		n++
+	}
+	return n, prev, scanner.Err()
+}
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLogHashChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	l, err := Open(path, 0, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{"0x01", "0x02"} {
+		if err := l.Write(&Record{TxHash: hash, Decision: "accepted"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// reopen with rotation by size, the sequence and chain continue
+	l, err = Open(path, 1, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Write(&Record{TxHash: "0x03", Decision: "rejected", Status: 428}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	files, _ := filepath.Glob(path + "*")
+	sort.Strings(files)
+	if len(files) != 2 || files[0] != path {
+		t.Fatalf("files %v, want the current and a rotated", files)
+	}
+	var all []byte
+	for _, file := range []string{files[1], files[0]} {
+		b, _ := ioutil.ReadFile(file)
+		all = append(all, b...)
+	}
+	n, _, err := Verify(bytes.NewReader(all), "")
+	if err != nil || n != 3 {
+		t.Fatalf("verify %d records, error %v", n, err)
+	}
+	var last Record
+	b, _ := ioutil.ReadFile(path)
+	json.Unmarshal(b, &last)
+	if last.Seq != 3 || last.Prev == "" {
+		t.Errorf("last record %+v", last)
+	}
+
+	tampered := strings.Replace(string(all), `"decision":"rejected"`, `"decision":"accepted"`, 1)
+	if _, _, err := Verify(strings.NewReader(tampered), ""); err == nil {
+		t.Error("verify tampered log, want error")
+	}
+}
+
+func TestFinish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+	l, err := Open(path, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Enable(l)
+	defer Enable(nil)
+
+	r := WithPending(httptest.NewRequest("POST", "/", nil), []byte("[]"))
+	Add(r, nil, &Record{TxHash: "0x00", Decision: "rejected"}, false)
+	Add(r, json.RawMessage("1"), &Record{TxHash: "0x01", Decision: "accepted"}, true)
+	Add(r, json.RawMessage("2"), &Record{TxHash: "0x02", Decision: "accepted"}, true)
+	Finish(r, 200, []byte(`[{"jsonrpc":"2.0","id":2,"error":{"code":-32000,"message":"nonce too low"}},{"jsonrpc":"2.0","id":1,"result":"0x01"}]`))
+	l.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("%d records, want 3", len(lines))
+	}
+	records := make(map[string]Record)
+	for _, line := range lines {
+		var rec Record
+		json.Unmarshal([]byte(line), &rec)
+		records[rec.TxHash] = rec
+	}
+	if rec := records["0x00"]; rec.Upstream != nil {
+		t.Errorf("rejected upstream %+v, want nil", rec.Upstream)
+	}
+	if rec := records["0x01"]; rec.Upstream == nil || rec.Upstream.Result != "0x01" || rec.Upstream.Status != 200 {
+		t.Errorf("upstream %+v, want result 0x01", rec.Upstream)
+	}
+	if rec := records["0x02"]; rec.Upstream == nil || rec.Upstream.Error != "nonce too low" {
+		t.Errorf("upstream %+v, want error", rec.Upstream)
+	}
+}
+
+func TestFinishMixedBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+	l, err := Open(path, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Enable(l)
+	defer Enable(nil)
+
+	// the only transaction of batch is not matched by the response of the other method
+	body := `[{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":[]},{"jsonrpc":"2.0","id":2,"method":"eth_sendRawTransaction","params":[]}]`
+	r := WithPending(httptest.NewRequest("POST", "/", nil), []byte(body))
+	Add(r, json.RawMessage("2"), &Record{TxHash: "0x02", Decision: "accepted"}, true)
+	Finish(r, 200, []byte(`[{"jsonrpc":"2.0","id":1,"result":"0x64"},{"jsonrpc":"2.0","id": 2 ,"result":"0x02"}]`))
+
+	// the batch failed as a whole
+	r = WithPending(httptest.NewRequest("POST", "/", nil), []byte(body))
+	Add(r, json.RawMessage("2"), &Record{TxHash: "0x03", Decision: "accepted"}, true)
+	Finish(r, 200, []byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`))
+
+	// the single request
+	r = WithPending(httptest.NewRequest("POST", "/", nil), []byte(`{"jsonrpc":"2.0","id":4,"method":"eth_sendRawTransaction","params":[]}`))
+	Add(r, json.RawMessage("4"), &Record{TxHash: "0x04", Decision: "accepted"}, true)
+	Finish(r, 200, []byte(`{"jsonrpc":"2.0","id":4,"result":"0x04"}`))
+	l.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	records := make(map[string]Record)
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var rec Record
+		json.Unmarshal([]byte(line), &rec)
+		records[rec.TxHash] = rec
+	}
+	if rec := records["0x02"]; rec.Upstream == nil || rec.Upstream.Result != "0x02" {
+		t.Errorf("upstream %+v, want result 0x02", rec.Upstream)
+	}
+	if rec := records["0x03"]; rec.Upstream == nil || rec.Upstream.Result != "" || rec.Upstream.Error != "" {
+		t.Errorf("upstream %+v, want no result", rec.Upstream)
+	}
+	if rec := records["0x04"]; rec.Upstream == nil || rec.Upstream.Result != "0x04" {
+		t.Errorf("upstream %+v, want result 0x04", rec.Upstream)
+	}
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var std *Log
+
+// Enable sets the audit log of Add and Finish
+func Enable(l *Log) {
+	std = l
+}
+
+// Enabled returns whether the audit log enabled
+func Enabled() bool {
+	return std != nil
+}
+
+type contextKey struct{}
+
+type pendingRecord struct {
+	id  json.RawMessage
+	rec *Record
+}
+
+// pending is the records of transactions forwarded to upstream in a request
+type pending struct {
+	batch bool // the request body is a batch
+
+	mu      sync.Mutex
+	records []pendingRecord
+}
+
+// WithPending returns the request of body to hold the records of forwarded transactions until Finish
+func WithPending(r *http.Request, body []byte) *http.Request {
+	trimmed := bytes.TrimSpace(body)
+	p := &pending{batch: len(trimmed) > 0 && trimmed[0] == '['}
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, p))
+}
+
+// Add writes the record of the transaction rejected, or holds the record of the
+// transaction forwarded in JSON-RPC request id until Finish with the upstream result
+func Add(r *http.Request, id json.RawMessage, rec *Record, forwarded bool) {
+	if std == nil {
+		return
+	}
+	if forwarded && r != nil {
+		if p, ok := r.Context().Value(contextKey{}).(*pending); ok {
+			p.mu.Lock()
+			p.records = append(p.records, pendingRecord{id: id, rec: rec})
+			p.mu.Unlock()
+			return
+		}
+	}
+	write(rec)
+}
+
+func write(rec *Record) {
+	if err := std.Write(rec); err != nil {
+		log.Errorf("Audit write %s error: %v", rec.TxHash, err)
+	}
+}
+
+type jsonrpcResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Finish writes the held records of the request with the upstream result in
+// the response body of HTTP status
+func Finish(r *http.Request, status int, body []byte) {
+	if std == nil || r == nil {
+		return
+	}
+	p, ok := r.Context().Value(contextKey{}).(*pending)
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	records := p.records
+	p.records = nil
+	p.mu.Unlock()
+	if len(records) == 0 {
+		return
+	}
+
+	// the responses of batch are matched by id, the response of single request is of its record
+	var responses []jsonrpcResponse
+	single := false
+	if err := json.Unmarshal(body, &responses); err != nil && !p.batch {
+		var response jsonrpcResponse
+		if err := json.Unmarshal(body, &response); err == nil {
+			responses = []jsonrpcResponse{response}
+			single = true
+		}
+	}
+	for _, pr := range records {
+		upstream := &Upstream{Status: status}
+		for _, res := range responses {
+			if !single && !bytes.Equal(bytes.TrimSpace(res.ID), bytes.TrimSpace(pr.id)) {
+				continue
+			}
+			if res.Error != nil {
+				upstream.Error = res.Error.Message
+			} else {
+				json.Unmarshal(res.Result, &upstream.Result)
+			}
+			break
+		}
+		pr.rec.Upstream = upstream
+		write(pr.rec)
+	}
+}
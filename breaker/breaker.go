@@ -0,0 +1,323 @@
+package breaker
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// State is the state of circuit breaker
+type State int
+
+const (
+	StateClosed   State = iota // requests forwarded, outcomes counted
+	StateOpen                  // requests failed fast until OpenDuration passed
+	StateHalfOpen              // probes forwarded, closed if succeeded or open if failed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Outcome is the outcome of a request forwarded
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failure         // transport error, timeout or 5xx of upstream
+	Ignored         // canceled by client or hedging, neither success nor failure, but may be slow
+)
+
+var (
+	DefaultWindow       = 10 * time.Second
+	DefaultMinRequests  = 20
+	DefaultOpenDuration = 30 * time.Second
+	latencySamples      = 1024
+)
+
+// Config is the thresholds of circuit breaker
+type Config struct {
+	Window         time.Duration // rolling window of the outcomes counted, Default 10s
+	MinRequests    int           // the circuit is not opened with fewer requests in window, Default 20
+	ErrorRate      float64       // open if the rate of failures in window reached, 0 for no limit
+	SlowThreshold  time.Duration // the request slower is counted as slow, 0 for no limit
+	SlowRate       float64       // open if the rate of slow requests in window reached, 0 for no limit
+	OpenDuration   time.Duration // open before half-open, Default 30s
+	HalfOpenProbes int           // probes forwarded in half-open, closed if all succeeded, Default 1
+}
+
+// bucket counts the outcomes in a second
+type bucket struct {
+	second   int64
+	total    int
+	failures int
+	slow     int
+}
+
+// Ticket is the admission of a request by Allow, its outcome is counted only in the state admitted
+type Ticket struct {
+	gen uint64 // the generation of state admitted in
+}
+
+// Breaker is the circuit breaker of an upstream
+type Breaker struct {
+	name   string
+	config Config
+
+	mu       sync.Mutex
+	state    State
+	gen      uint64 // increased on each transition
+	openedAt time.Time
+	buckets  []bucket
+	probes   int // probes in flight in half-open
+	probed   int // probes succeeded in half-open
+
+	latencies []time.Duration // ring of the latencies of successful requests
+	next      int
+
+	// the last percentile, computed at most once per second
+	percentile   float64
+	percentileAt time.Time
+	percentileOf time.Duration
+}
+
+// New returns the closed breaker of upstream name
+func New(name string, config Config) *Breaker {
+	if config.Window <= 0 {
+		config.Window = DefaultWindow
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = DefaultMinRequests
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = DefaultOpenDuration
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = 1
+	}
+	seconds := int(config.Window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &Breaker{
+		name:    name,
+		config:  config,
+		buckets: make([]bucket, seconds),
+	}
+}
+
+// State returns the state at now
+func (b *Breaker) State(now time.Time) State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.config.OpenDuration {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow returns whether the request should be forwarded at now, Done must be called with the ticket
+// and the outcome if allowed
+func (b *Breaker) Allow(now time.Time) (Ticket, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.config.OpenDuration {
+			return Ticket{}, false
+		}
+		b.setState(StateHalfOpen, now)
+		fallthrough
+	case StateHalfOpen:
+		if b.probes >= b.config.HalfOpenProbes-b.probed {
+			return Ticket{}, false
+		}
+		b.probes++
+	}
+	return Ticket{gen: b.gen}, true
+}
+
+// Done records the outcome and latency of the request of ticket at now, the outcome of the request
+// admitted before the last transition is not counted, such as the one admitted while closed and done in half-open
+func (b *Breaker) Done(t Ticket, outcome Outcome, latency time.Duration, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slow := b.config.SlowThreshold > 0 && latency >= b.config.SlowThreshold
+	if outcome == Success {
+		if len(b.latencies) < latencySamples {
+			b.latencies = append(b.latencies, latency)
+		} else {
+			b.latencies[b.next] = latency
+			b.next = (b.next + 1) % latencySamples
+		}
+	}
+
+	if t.gen != b.gen {
+		return
+	}
+	switch b.state {
+	case StateHalfOpen:
+		if b.probes > 0 {
+			b.probes--
+		}
+		switch {
+		case outcome == Failure || slow:
+			b.setState(StateOpen, now)
+		case outcome == Ignored:
+		default:
+			b.probed++
+			if b.probed >= b.config.HalfOpenProbes {
+				b.setState(StateClosed, now)
+			}
+		}
+	case StateClosed:
+		// the request canceled after slow is still counted as slow
+		if outcome == Ignored && !slow {
+			return
+		}
+		second := now.Unix()
+		bk := &b.buckets[int(second%int64(len(b.buckets)))]
+		if bk.second != second {
+			*bk = bucket{second: second}
+		}
+		bk.total++
+		if outcome == Failure {
+			bk.failures++
+		}
+		if slow {
+			bk.slow++
+		}
+		if b.tripped(second) {
+			b.setState(StateOpen, now)
+		}
+	}
+}
+
+// tripped returns whether the outcomes in window till second reached the thresholds
+func (b *Breaker) tripped(second int64) bool {
+	var total, failures, slow int
+	for _, bk := range b.buckets {
+		if second-bk.second >= int64(len(b.buckets)) {
+			continue
+		}
+		total += bk.total
+		failures += bk.failures
+		slow += bk.slow
+	}
+	if total < b.config.MinRequests {
+		return false
+	}
+	if b.config.ErrorRate > 0 && float64(failures) >= b.config.ErrorRate*float64(total) {
+		return true
+	}
+	if b.config.SlowRate > 0 && float64(slow) >= b.config.SlowRate*float64(total) {
+		return true
+	}
+	return false
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		if state == StateOpen {
+			b.openedAt = now
+		}
+		return
+	}
+	from := b.state
+	b.state = state
+	b.gen++
+	b.probes, b.probed = 0, 0
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+	}
+
+	log.Warnf("Circuit breaker of %s is %s from %s", b.name, state, from)
+	notify.AddEvent(notify.NewEvent(notify.EventCircuit, "", map[string]interface{}{
+		"upstream": b.name,
+		"state":    state.String(),
+		"from":     from.String(),
+	}))
+}
+
+// Percentile returns the latency percentile p (0-100) of the recent successful requests at now,
+// false if fewer than MinRequests
+func (b *Breaker) Percentile(p float64, now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.latencies) < b.config.MinRequests {
+		return 0, false
+	}
+	if p == b.percentile && now.Sub(b.percentileAt) < time.Second {
+		return b.percentileOf, true
+	}
+
+	latencies := append([]time.Duration{}, b.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	i := int(p / 100 * float64(len(latencies)))
+	if i >= len(latencies) {
+		i = len(latencies) - 1
+	} else if i < 0 {
+		i = 0
+	}
+	b.percentile, b.percentileAt, b.percentileOf = p, now, latencies[i]
+	return latencies[i], true
+}
+
+// Breakers holds the breakers of upstreams created on demand
+type Breakers struct {
+	config Config
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewBreakers returns the breakers of config
+func NewBreakers(config Config) *Breakers {
+	return &Breakers{config: config, breakers: make(map[string]*Breaker)}
+}
+
+// Get returns the breaker of upstream rawURL
+func (bs *Breakers) Get(rawURL string) *Breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.breakers[rawURL]
+	if !ok {
+		b = New(rawURL, bs.config)
+		bs.breakers[rawURL] = b
+	}
+	return b
+}
+
+var std *Breakers
+
+// Enable sets the breakers of upstreams
+func Enable(bs *Breakers) {
+	std = bs
+}
+
+// Get returns the breaker of upstream rawURL, or nil if not enabled
+func Get(rawURL string) *Breaker {
+	if std == nil {
+		return nil
+	}
+	return std.Get(rawURL)
+}
@@ -0,0 +1,134 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := New("node", Config{Window: 10 * time.Second, MinRequests: 4, ErrorRate: 0.5, OpenDuration: time.Minute, HalfOpenProbes: 2})
+	now := time.Unix(1000, 0)
+
+	for i, outcome := range []Outcome{Success, Failure, Success} {
+		ticket, ok := b.Allow(now)
+		if !ok {
+			t.Fatalf("%d: rejected while closed", i)
+		}
+		b.Done(ticket, outcome, time.Millisecond, now)
+	}
+	if s := b.State(now); s != StateClosed {
+		t.Fatalf("state %s below MinRequests, want closed", s)
+	}
+	ticket, _ := b.Allow(now)
+	b.Done(ticket, Failure, time.Millisecond, now)
+	if s := b.State(now); s != StateOpen {
+		t.Fatalf("state %s at the error rate, want open", s)
+	}
+	if _, ok := b.Allow(now.Add(time.Second)); ok {
+		t.Error("allowed while open")
+	}
+
+	// half-open, two probes
+	now = now.Add(time.Minute)
+	probe1, ok1 := b.Allow(now)
+	probe2, ok2 := b.Allow(now)
+	if !ok1 || !ok2 {
+		t.Fatal("probes rejected in half-open")
+	}
+	if _, ok := b.Allow(now); ok {
+		t.Error("allowed more than the probes in half-open")
+	}
+	b.Done(probe1, Success, time.Millisecond, now)
+	b.Done(probe2, Failure, time.Millisecond, now)
+	if s := b.State(now); s != StateOpen {
+		t.Fatalf("state %s after the probe failed, want open", s)
+	}
+
+	now = now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		probe, ok := b.Allow(now)
+		if !ok {
+			t.Fatal("probe rejected in half-open")
+		}
+		b.Done(probe, Success, time.Millisecond, now)
+	}
+	if s := b.State(now); s != StateClosed {
+		t.Fatalf("state %s after the probes succeeded, want closed", s)
+	}
+
+	// the failures out of window are not counted
+	for i := 0; i < 3; i++ {
+		ticket, _ := b.Allow(now)
+		b.Done(ticket, Failure, time.Millisecond, now)
+	}
+	now = now.Add(10 * time.Second)
+	ticket, _ = b.Allow(now)
+	b.Done(ticket, Failure, time.Millisecond, now)
+	if s := b.State(now); s != StateClosed {
+		t.Errorf("state %s with the failures out of window, want closed", s)
+	}
+}
+
+func TestBreakerStale(t *testing.T) {
+	b := New("node", Config{MinRequests: 1, ErrorRate: 0.5, OpenDuration: time.Minute})
+	now := time.Unix(1000, 0)
+
+	// admitted while closed, and done after the circuit opened and half-open
+	stale, _ := b.Allow(now)
+	ticket, _ := b.Allow(now)
+	b.Done(ticket, Failure, time.Millisecond, now)
+	now = now.Add(time.Minute)
+	probe, ok := b.Allow(now)
+	if !ok {
+		t.Fatal("probe rejected in half-open")
+	}
+	b.Done(stale, Success, time.Millisecond, now)
+	if s := b.State(now); s != StateHalfOpen {
+		t.Fatalf("state %s after the request admitted while closed succeeded, want half-open", s)
+	}
+	if _, ok := b.Allow(now); ok {
+		t.Error("probe returned by the request admitted while closed")
+	}
+	b.Done(probe, Success, time.Millisecond, now)
+	if s := b.State(now); s != StateClosed {
+		t.Fatalf("state %s after the probe succeeded, want closed", s)
+	}
+}
+
+func TestBreakerSlow(t *testing.T) {
+	b := New("node", Config{MinRequests: 2, SlowThreshold: time.Second, SlowRate: 0.5})
+	now := time.Unix(1000, 0)
+
+	ticket, _ := b.Allow(now)
+	b.Done(ticket, Success, time.Millisecond, now)
+	ticket, _ = b.Allow(now)
+	b.Done(ticket, Ignored, 100*time.Millisecond, now)
+	if s := b.State(now); s != StateClosed {
+		t.Fatalf("state %s with the fast canceled, want closed", s)
+	}
+	// canceled by hedging after slow
+	ticket, _ = b.Allow(now)
+	b.Done(ticket, Ignored, 2*time.Second, now)
+	if s := b.State(now); s != StateOpen {
+		t.Fatalf("state %s at the slow rate, want open", s)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	b := New("node", Config{MinRequests: 10})
+	now := time.Now()
+	for i := 1; i <= 9; i++ {
+		b.Done(Ticket{}, Success, time.Duration(i)*time.Millisecond, now)
+	}
+	if _, ok := b.Percentile(90, now); ok {
+		t.Error("percentile below MinRequests")
+	}
+	b.Done(Ticket{}, Success, 10*time.Millisecond, now)
+	b.Done(Ticket{}, Failure, time.Hour, now)
+	if p, ok := b.Percentile(90, now); !ok || p != 10*time.Millisecond {
+		t.Errorf("p90 %v %v, want 10ms", p, ok)
+	}
+	if p, ok := b.Percentile(50, now); !ok || p != 6*time.Millisecond {
+		t.Errorf("p50 %v %v, want 6ms", p, ok)
+	}
+}
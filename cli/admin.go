@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// defaultAdminURL returns the url of the guard admin API by config key, Default the local port
+func defaultAdminURL(key string) string {
+	if u := viper.GetString(key); u != "" {
+		return u
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", viper.GetInt("port"))
+}
+
+// adminRequest requests the admin API at url with the bearer token, and prints the response
+func adminRequest(method, url, token string) error {
+	if token == "" {
+		return errors.New("admin token not set")
+	}
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Print(string(body))
+	return nil
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"errors"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/breaker"
+	"github.com/spf13/viper"
+)
+
+// loadBreakers returns the circuit breakers of [CircuitBreaker]
+func loadBreakers() (*breaker.Breakers, error) {
+	config := breaker.Config{
+		Window:         time.Duration(viper.GetInt("CircuitBreaker.Window")) * time.Second,
+		MinRequests:    viper.GetInt("CircuitBreaker.MinRequests"),
+		ErrorRate:      viper.GetFloat64("CircuitBreaker.ErrorRate"),
+		SlowThreshold:  time.Duration(viper.GetInt("CircuitBreaker.SlowThreshold")) * time.Millisecond,
+		SlowRate:       viper.GetFloat64("CircuitBreaker.SlowRate"),
+		OpenDuration:   time.Duration(viper.GetInt("CircuitBreaker.OpenDuration")) * time.Second,
+		HalfOpenProbes: viper.GetInt("CircuitBreaker.HalfOpenProbes"),
+	}
+	if config.ErrorRate < 0 || config.ErrorRate > 1 || config.SlowRate < 0 || config.SlowRate > 1 {
+		return nil, errors.New("CircuitBreaker.ErrorRate and SlowRate must be in [0, 1]")
+	}
+	if config.SlowRate > 0 && config.SlowThreshold <= 0 {
+		return nil, errors.New("CircuitBreaker.SlowRate requires SlowThreshold")
+	}
+	if config.ErrorRate == 0 && config.SlowRate == 0 {
+		return nil, errors.New("CircuitBreaker.ErrorRate or SlowRate not set")
+	}
+	return breaker.NewBreakers(config), nil
+}
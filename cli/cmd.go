@@ -28,4 +28,10 @@ func (cli *CLI) buildRootCmd() {
 
 	// server
 	rootCmd.AddCommand(cli.buildServerCmd()) // server
+
+	// quarantine
+	rootCmd.AddCommand(cli.buildQuarantineCmd()) // quarantine
+
+	// maintenance
+	rootCmd.AddCommand(cli.buildMaintenanceCmd()) // maintenance
 }
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/newtonproject/newchain-guard/concurrency"
+	"github.com/spf13/viper"
+)
+
+// loadConcurrencyConfig returns the limiter config of section
+func loadConcurrencyConfig(section string) concurrency.Config {
+	return concurrency.Config{
+		InitialLimit: viper.GetInt(section + ".InitialLimit"),
+		MinLimit:     viper.GetInt(section + ".MinLimit"),
+		MaxLimit:     viper.GetInt(section + ".MaxLimit"),
+		Tolerance:    viper.GetFloat64(section + ".Tolerance"),
+		Backoff:      viper.GetFloat64(section + ".Backoff"),
+		LowShare:     viper.GetFloat64(section + ".LowShare"),
+		MaxQueue:     viper.GetInt(section + ".MaxQueue"),
+		MaxWait:      time.Duration(viper.GetInt(section+".MaxWait")) * time.Millisecond,
+	}
+}
+
+// loadConcurrency returns the global and upstream concurrency limiters of [Concurrency]
+func loadConcurrency() *concurrency.Limiters {
+	highMethods := viper.GetStringSlice("Concurrency.HighMethods")
+	if len(highMethods) == 0 {
+		highMethods = concurrency.DefaultHighMethods
+	}
+	lowMethods := viper.GetStringSlice("Concurrency.LowMethods")
+	if len(lowMethods) == 0 {
+		lowMethods = concurrency.DefaultLowMethods
+	}
+	return concurrency.NewLimiters(loadConcurrencyConfig("Concurrency"), loadConcurrencyConfig("Concurrency.Upstream"),
+		highMethods, lowMethods, viper.GetStringSlice("Concurrency.PriorityKeys"))
+}
@@ -3,14 +3,18 @@ package cli
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/newtonproject/newchain-guard/params"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/upper/db/v4/adapter/mysql"
 )
@@ -86,6 +90,23 @@ func loadParamsConfig() (*params.Config, error) {
 		}
 	}
 
+	if localMethods := viper.GetStringSlice("LocalMethods"); len(localMethods) > 0 {
+		config.LocalMethods = make(map[string]struct{}, len(localMethods))
+		for _, method := range localMethods {
+			config.LocalMethods[method] = struct{}{}
+		}
+	}
+	if localResults := viper.GetStringMap("LocalResults"); len(localResults) > 0 {
+		config.LocalResults = make(map[string]json.RawMessage, len(localResults))
+		for method, result := range localResults {
+			b, err := json.Marshal(result)
+			if err != nil {
+				return nil, fmt.Errorf("result of %s: %v", method, err)
+			}
+			config.LocalResults[strings.ToLower(method)] = b
+		}
+	}
+
 	if fromBlacklistConfig := viper.GetString("FromBlacklistConfig"); len(fromBlacklistConfig) > 0 {
 		v := viper.New()
 		v.SetConfigFile(fromBlacklistConfig)
@@ -121,7 +142,33 @@ func loadParamsConfig() (*params.Config, error) {
 			}
 		}
 	}
+	if toWhitelistConfig := viper.GetString("ToWhitelistConfig"); len(toWhitelistConfig) > 0 {
+		v := viper.New()
+		v.SetConfigFile(toWhitelistConfig)
+		err := v.ReadInConfig()
+		if err != nil {
+			return nil, err
+		}
+		if toWhiteList := v.GetStringSlice("ToWhiteList"); len(toWhiteList) > 0 {
+			config.ToWhiteList = make(map[common.Address]struct{}, len(toWhiteList))
+			for _, address := range toWhiteList {
+				if !common.IsHexAddress(address) {
+					return nil, fmt.Errorf("address %s not invalid hex-encode\n", address)
+				}
+				config.ToWhiteList[common.HexToAddress(address)] = struct{}{}
+			}
+		}
+	}
 	config.DisableContractCreate = viper.GetBool("DisableContractCreate")
+	if requireToType := strings.ToLower(viper.GetString("RequireToType")); requireToType != "" {
+		if requireToType != params.ToTypeContract && requireToType != params.ToTypeEOA {
+			return nil, fmt.Errorf("RequireToType %s not supported", requireToType)
+		}
+		config.RequireToType = requireToType
+	}
+	if codeCacheTTL := viper.GetInt64("CodeCacheTTL"); codeCacheTTL > 0 {
+		config.CodeCacheTTL = time.Duration(codeCacheTTL) * time.Second
+	}
 
 	if fromBlacklistConfig := viper.GetString("TxHashBlackListConfig"); len(fromBlacklistConfig) > 0 {
 		v := viper.New()
@@ -150,6 +197,68 @@ func loadParamsConfig() (*params.Config, error) {
 		}
 	}
 
+	if txTypeAllowList := viper.GetStringSlice("TxTypeAllowList"); len(txTypeAllowList) > 0 {
+		config.TxTypeAllowList = make(map[uint8]struct{}, len(txTypeAllowList))
+		for _, name := range txTypeAllowList {
+			txType, ok := params.TxTypeNames[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("transaction type %s not supported", name)
+			}
+			config.TxTypeAllowList[txType] = struct{}{}
+		}
+	}
+	config.RequireEIP155 = viper.GetBool("RequireEIP155")
+	config.MaxAccessListSize = viper.GetInt("MaxAccessListSize")
+	config.MaxAccessListStorageKeys = viper.GetInt("MaxAccessListStorageKeys")
+
+	config.MaxCallGas = viper.GetUint64("MaxCallGas")
+	config.AllowStateOverride = viper.GetBool("AllowStateOverride")
+	config.CallTimeout = time.Duration(viper.GetInt("CallTimeout")) * time.Second
+	config.EstimateGasPadding = viper.GetInt("EstimateGasPadding")
+	if config.EstimateGasPadding < 0 {
+		return nil, errors.New("EstimateGasPadding less than 0")
+	}
+
+	config.MaxLogsBlockRange = viper.GetUint64("MaxLogsBlockRange")
+	config.MaxLogsAddresses = viper.GetInt("MaxLogsAddresses")
+	config.MaxLogsTopics = viper.GetInt("MaxLogsTopics")
+	config.SplitLogsRange = viper.GetBool("SplitLogsRange")
+	if config.SplitLogsRange && config.MaxLogsBlockRange == 0 {
+		return nil, errors.New("SplitLogsRange requires MaxLogsBlockRange")
+	}
+	if viper.IsSet("SplitLogsParallel") {
+		config.SplitLogsParallel = viper.GetInt("SplitLogsParallel")
+		if config.SplitLogsParallel < 1 {
+			return nil, errors.New("SplitLogsParallel less than 1")
+		}
+	}
+	if viper.IsSet("MaxLogsChunks") {
+		config.MaxLogsChunks = viper.GetInt("MaxLogsChunks")
+		if config.MaxLogsChunks < 0 {
+			return nil, errors.New("MaxLogsChunks less than 0")
+		}
+	}
+	config.MaxLogsResultSize = viper.GetInt("MaxLogsResultSize")
+
+	config.HedgeUpstream = viper.GetString("Hedge.Upstream")
+	config.HedgePercentile = 95
+	if viper.IsSet("Hedge.Percentile") {
+		config.HedgePercentile = viper.GetFloat64("Hedge.Percentile")
+		if config.HedgePercentile <= 0 || config.HedgePercentile > 100 {
+			return nil, errors.New("Hedge.Percentile not in (0, 100]")
+		}
+	}
+	config.HedgeMinDelay = time.Duration(viper.GetInt("Hedge.MinDelay")) * time.Millisecond
+
+	config.MaxCalldataSize = viper.GetInt("MaxCalldataSize")
+	if contractRulesConfig := viper.GetString("ContractRulesConfig"); len(contractRulesConfig) > 0 {
+		rules, err := loadContractRules(contractRulesConfig)
+		if err != nil {
+			return nil, err
+		}
+		config.ContractRules = rules
+	}
+
 	config.EnableMaxValueVerify = viper.GetBool("EnableMaxValueVerify")
 	maxValueInNEW := viper.GetInt64("MaxValueInNEW")
 	if maxValueInNEW > 0 {
@@ -210,6 +319,7 @@ func loadParamsConfig() (*params.Config, error) {
 	}
 
 	config.EnableActiveMQ = viper.GetBool("EnableActiveMQ")
+	config.EnableNotify = config.EnableActiveMQ || viper.IsSet("Notify.Sink")
 
 	config.EnableWhitelistDB = viper.GetBool("EnableWhitelistDB")
 	if config.EnableWhitelistDB {
@@ -246,3 +356,48 @@ func loadParamsConfig() (*params.Config, error) {
 
 	return &config, nil
 }
+
+// loadLogPolicy loads the policy of request logs from [Log]
+func loadLogPolicy() (*params.LogPolicy, error) {
+	policy := params.DefaultLogPolicy
+	policy.MaxBodySize = viper.GetInt("Log.MaxBodySize")
+	if viper.IsSet("Log.SampleRate") {
+		policy.SampleRate = viper.GetFloat64("Log.SampleRate")
+		if policy.SampleRate < 0 || policy.SampleRate > 1 {
+			return nil, fmt.Errorf("Log.SampleRate %v not in [0, 1]", policy.SampleRate)
+		}
+	}
+	if viper.IsSet("Log.RedactQuery") {
+		policy.RedactQuery = viper.GetStringSlice("Log.RedactQuery")
+	}
+	if methods := viper.GetStringSlice("Log.WriteMethods"); len(methods) > 0 {
+		policy.WriteMethods = make(map[string]struct{}, len(methods))
+		for _, method := range methods {
+			policy.WriteMethods[strings.ToLower(method)] = struct{}{}
+		}
+	}
+
+	if levels := viper.GetStringMapString("Log.MethodLevel"); len(levels) > 0 {
+		policy.MethodLevels = make(map[string]logrus.Level, len(levels))
+		for method, l := range levels {
+			level, err := logrus.ParseLevel(l)
+			if err != nil {
+				return nil, fmt.Errorf("Log.MethodLevel %s: %v", method, err)
+			}
+			policy.MethodLevels[strings.ToLower(method)] = level
+		}
+	}
+
+	var redactParams map[string][]int
+	if err := viper.UnmarshalKey("Log.RedactParams", &redactParams); err != nil {
+		return nil, err
+	}
+	if len(redactParams) > 0 {
+		policy.RedactParams = make(map[string][]int, len(redactParams))
+		for method, indexes := range redactParams {
+			policy.RedactParams[strings.ToLower(method)] = indexes
+		}
+	}
+
+	return &policy, nil
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/spf13/viper"
+)
+
+type contractRuleConfig struct {
+	Address  string
+	ABIFile  string
+	Allow    []string
+	Deny     []string
+	Argument []argumentRuleConfig
+}
+
+type argumentRuleConfig struct {
+	Method string
+	Index  int
+	Min    string
+	Max    string
+}
+
+// loadContractRules loads the function selector rules of contracts from file
+func loadContractRules(file string) (map[common.Address]*params.ContractRule, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var contracts []contractRuleConfig
+	if err := v.UnmarshalKey("Contract", &contracts); err != nil {
+		return nil, err
+	}
+
+	rules := make(map[common.Address]*params.ContractRule, len(contracts))
+	for _, c := range contracts {
+		if !common.IsHexAddress(c.Address) {
+			return nil, fmt.Errorf("address %s not invalid hex-encode\n", c.Address)
+		}
+		var contractABI *abi.ABI
+		if c.ABIFile != "" {
+			f, err := os.Open(c.ABIFile)
+			if err != nil {
+				return nil, err
+			}
+			a, err := abi.JSON(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("parse abi file %s error: %v", c.ABIFile, err)
+			}
+			contractABI = &a
+		}
+
+		rule := &params.ContractRule{
+			AllowSelectors: make(map[[4]byte]struct{}),
+			DenySelectors:  make(map[[4]byte]struct{}),
+			Inputs:         make(map[[4]byte]abi.Arguments),
+			ArgumentRules:  make(map[[4]byte][]params.ArgumentRule),
+		}
+		for _, method := range c.Allow {
+			selector, _, err := parseMethod(method, contractABI)
+			if err != nil {
+				return nil, err
+			}
+			rule.AllowSelectors[selector] = struct{}{}
+		}
+		for _, method := range c.Deny {
+			selector, _, err := parseMethod(method, contractABI)
+			if err != nil {
+				return nil, err
+			}
+			rule.DenySelectors[selector] = struct{}{}
+		}
+		for _, arg := range c.Argument {
+			selector, inputs, err := parseMethod(arg.Method, contractABI)
+			if err != nil {
+				return nil, err
+			}
+			if inputs == nil {
+				return nil, fmt.Errorf("method %s without signature can not bound arguments", arg.Method)
+			}
+			if arg.Index < 0 || arg.Index >= len(inputs) {
+				return nil, fmt.Errorf("argument index %d out of range of method %s", arg.Index, arg.Method)
+			}
+			argRule := params.ArgumentRule{Index: arg.Index}
+			if arg.Min != "" {
+				if argRule.Min, err = parseBig(arg.Min); err != nil {
+					return nil, err
+				}
+			}
+			if arg.Max != "" {
+				if argRule.Max, err = parseBig(arg.Max); err != nil {
+					return nil, err
+				}
+			}
+			rule.Inputs[selector] = inputs
+			rule.ArgumentRules[selector] = append(rule.ArgumentRules[selector], argRule)
+		}
+
+		rules[common.HexToAddress(c.Address)] = rule
+	}
+
+	return rules, nil
+}
+
+// parseMethod returns the selector and inputs of method, which is a 4-byte hex selector,
+// a signature such as "transfer(address,uint256)" or a method name in contractABI.
+// The inputs is nil if method is a hex selector.
+func parseMethod(method string, contractABI *abi.ABI) ([4]byte, abi.Arguments, error) {
+	var selector [4]byte
+	method = strings.TrimSpace(method)
+
+	if strings.HasPrefix(method, "0x") || strings.HasPrefix(method, "0X") {
+		b, err := hexutil.Decode(method)
+		if err != nil || len(b) != 4 {
+			return selector, nil, fmt.Errorf("selector %s not 4-byte hex-encode", method)
+		}
+		copy(selector[:], b)
+		return selector, nil, nil
+	}
+
+	if index := strings.IndexByte(method, '('); index > 0 && strings.HasSuffix(method, ")") {
+		typeList := strings.TrimSpace(method[index+1 : len(method)-1])
+		inputs := abi.Arguments{}
+		if typeList != "" {
+			for _, typeName := range strings.Split(typeList, ",") {
+				typ, err := abi.NewType(strings.TrimSpace(typeName), "", nil)
+				if err != nil {
+					return selector, nil, fmt.Errorf("method %s type %s error: %v", method, typeName, err)
+				}
+				inputs = append(inputs, abi.Argument{Type: typ})
+			}
+		}
+		types := make([]string, 0, len(inputs))
+		for _, input := range inputs {
+			types = append(types, input.Type.String())
+		}
+		signature := fmt.Sprintf("%s(%s)", strings.TrimSpace(method[:index]), strings.Join(types, ","))
+		copy(selector[:], crypto.Keccak256([]byte(signature))[:4])
+		return selector, inputs, nil
+	}
+
+	if contractABI != nil {
+		if m, ok := contractABI.Methods[method]; ok {
+			copy(selector[:], m.ID)
+			return selector, m.Inputs, nil
+		}
+	}
+
+	return selector, nil, fmt.Errorf("method %s not found", method)
+}
+
+func parseBig(s string) (*big.Int, error) {
+	b, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return nil, errBigSetString
+	}
+	return b, nil
+}
@@ -1,8 +1,21 @@
 package cli
 
-import "testing"
+import (
+	"os"
+	"testing"
+)
 
 func TestInit(t *testing.T) {
+	// init writes the config file in the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
 	cli := NewCLI()
 
 	cli.TestCommand("init")
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/maintenance"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// parseWindowTime parses the TOML datetime or the RFC 3339 string
+func parseWindowTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		return time.Parse(time.RFC3339, t)
+	default:
+		return time.Time{}, fmt.Errorf("maintenance window time %v not RFC 3339", v)
+	}
+}
+
+// loadMaintenance returns the read-only mode of [Maintenance]
+func loadMaintenance() (*maintenance.Mode, error) {
+	methods := viper.GetStringSlice("Maintenance.Methods")
+	if len(methods) == 0 && viper.GetBool("Maintenance.AllWrites") {
+		methods = maintenance.WriteMethods
+	}
+
+	var windowConfigs []struct {
+		Start interface{}
+		End   interface{}
+	}
+	if err := viper.UnmarshalKey("Maintenance.Window", &windowConfigs); err != nil {
+		return nil, err
+	}
+	windows := make([]maintenance.Window, 0, len(windowConfigs))
+	for _, c := range windowConfigs {
+		start, err := parseWindowTime(c.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseWindowTime(c.End)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, maintenance.Window{Start: start, End: end})
+	}
+
+	m, err := maintenance.New(methods, viper.GetString("Maintenance.Message"), windows)
+	if err != nil {
+		return nil, err
+	}
+	if viper.GetBool("Maintenance.ReadOnly") {
+		m.SetReadOnly(true, "config")
+	}
+	return m, nil
+}
+
+func (cli *CLI) buildMaintenanceCmd() *cobra.Command {
+	var adminURL, token string
+
+	request := func(method, path string) {
+		if err := adminRequest(method, strings.TrimRight(adminURL, "/")+"/maintenance"+path, token); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Switch the guard read-only mode",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cli.setup(cmd, args)
+			if adminURL == "" {
+				adminURL = defaultAdminURL("Maintenance.AdminURL")
+			}
+			if token == "" {
+				token = viper.GetString("Maintenance.AdminToken")
+			}
+		},
+	}
+	cmd.PersistentFlags().StringVar(&adminURL, "url", "", "The `url` of guard, Default Maintenance.AdminURL")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "The admin `token`, Default Maintenance.AdminToken")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Get the read-only status",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			request(http.MethodGet, "")
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "readonly",
+		Short: "Reject the transactions until readwrite",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			request(http.MethodPost, "/readonly")
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "readwrite",
+		Short: "Accept the transactions again",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			request(http.MethodPost, "/readwrite")
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/notify"
+	"github.com/spf13/viper"
+)
+
+type notifySinkConfig struct {
+	Name   string
+	Type   string // mqtt, kafka, nats, webhook or file
+	Topics map[string]string
+	Format string
+
+	MinRetryInterval int // seconds
+	MaxRetryInterval int // seconds
+	MaxAttempts      int
+
+	// mqtt and nats
+	Server   string
+	URL      string // nats server or webhook url
+	Username string
+	Password string
+	ClientID string
+	QoS      int
+
+	// kafka
+	Brokers      []string
+	RequiredAcks *int // Default -1 for all replicas
+
+	// webhook
+	Secret string
+
+	// file
+	Path string
+}
+
+// loadNotifySinks registers the sink of [ActiveMQ] if enableActiveMQ, and the sinks of [[Notify.Sink]]
+func loadNotifySinks(enableActiveMQ bool) error {
+	outboxDir := viper.GetString("Notify.OutboxDir")
+
+	if enableActiveMQ {
+		if clientID := viper.GetString("ActiveMQ.ClientID"); clientID != "" {
+			notify.ClientID = clientID
+		}
+		if viper.IsSet("ActiveMQ.QoS") {
+			if qos := viper.GetInt("ActiveMQ.QoS"); qos == 0 || qos == 1 || qos == 2 {
+				notify.QoS = byte(qos)
+			}
+		} else {
+			notify.QoS = byte(1)
+		}
+		if topic := viper.GetString("ActiveMQ.Topic"); topic != "" {
+			notify.Topic = topic
+		}
+		notify.RejectedTopic = viper.GetString("ActiveMQ.RejectedTopic")
+		notify.EventTopic = viper.GetString("ActiveMQ.EventTopic")
+
+		notifier := &notify.MQTTNotifier{
+			Server:        viper.GetString("ActiveMQ.Server"),
+			Username:      viper.GetString("ActiveMQ.Username"),
+			Password:      viper.GetString("ActiveMQ.Password"),
+			ClientID:      notify.ClientID,
+			QoS:           notify.QoS,
+			CleanSession:  true,
+			KeepAlive:     time.Duration(viper.GetInt("ActiveMQ.KeepAlive")) * time.Second,
+			WillTopic:     viper.GetString("ActiveMQ.WillTopic"),
+			WillPayload:   viper.GetString("ActiveMQ.WillPayload"),
+			WillRetained:  viper.GetBool("ActiveMQ.WillRetained"),
+			OnlinePayload: viper.GetString("ActiveMQ.OnlinePayload"),
+		}
+		if viper.IsSet("ActiveMQ.CleanSession") {
+			notifier.CleanSession = viper.GetBool("ActiveMQ.CleanSession")
+		}
+		willQoS := viper.GetInt("ActiveMQ.WillQoS")
+		if willQoS < 0 || willQoS > 2 {
+			return fmt.Errorf("ActiveMQ WillQoS %d not 0, 1 or 2", willQoS)
+		}
+		notifier.WillQoS = byte(willQoS)
+		if viper.GetBool("ActiveMQ.TLS") {
+			tlsConfig, err := notify.NewTLSConfig(
+				viper.GetString("ActiveMQ.CACert"),
+				viper.GetString("ActiveMQ.ClientCert"),
+				viper.GetString("ActiveMQ.ClientKey"),
+				viper.GetString("ActiveMQ.ServerName"),
+				viper.GetBool("ActiveMQ.InsecureSkipVerify"))
+			if err != nil {
+				return err
+			}
+			notifier.TLSConfig = tlsConfig
+		}
+
+		// the legacy consumers of RawTransaction topic expect the raw transaction, JSON is opt-in
+		format := viper.GetString("ActiveMQ.Format")
+		if format == "" {
+			format = notify.FormatRaw
+		}
+		s, err := notify.NewSink("activemq", notifier, notify.DefaultTopics(), format, notify.DefaultRetryPolicy,
+			viper.GetString("ActiveMQ.OutboxPath"))
+		if err != nil {
+			return err
+		}
+		notify.AddSink(s)
+	}
+
+	var configs []notifySinkConfig
+	if err := viper.UnmarshalKey("Notify.Sink", &configs); err != nil {
+		return err
+	}
+	names := make(map[string]struct{}, len(configs))
+	for _, c := range configs {
+		if c.Name == "" {
+			c.Name = c.Type
+		}
+		if _, ok := names[c.Name]; ok {
+			return fmt.Errorf("notify sink %s duplicated", c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		var notifier notify.Notifier
+		switch c.Type {
+		case "mqtt":
+			if c.ClientID == "" {
+				c.ClientID = notify.ClientID
+			}
+			if c.QoS < 0 || c.QoS > 2 {
+				return fmt.Errorf("notify sink %s QoS %d not 0, 1 or 2", c.Name, c.QoS)
+			}
+			notifier = &notify.MQTTNotifier{Server: c.Server, Username: c.Username, Password: c.Password,
+				ClientID: c.ClientID, QoS: byte(c.QoS), CleanSession: true}
+			if c.Format == "" {
+				c.Format = notify.FormatRaw
+			}
+		case "kafka":
+			acks := -1
+			if c.RequiredAcks != nil {
+				acks = *c.RequiredAcks
+			}
+			if acks < -1 || acks > 1 {
+				return fmt.Errorf("notify sink %s RequiredAcks %d not -1, 0 or 1", c.Name, acks)
+			}
+			notifier = &notify.KafkaNotifier{Brokers: c.Brokers, RequiredAcks: acks}
+		case "nats":
+			notifier = &notify.NATSNotifier{URL: c.URL, Username: c.Username, Password: c.Password}
+		case "webhook":
+			notifier = &notify.WebhookNotifier{URL: c.URL, Secret: c.Secret}
+		case "file":
+			notifier = &notify.FileNotifier{Path: c.Path}
+		default:
+			return fmt.Errorf("notify sink %s type %s not supported", c.Name, c.Type)
+		}
+
+		topics := notify.DefaultTopics()
+		if len(c.Topics) > 0 {
+			topics = c.Topics
+		}
+		retry := notify.DefaultRetryPolicy
+		if c.MinRetryInterval > 0 {
+			retry.MinInterval = time.Duration(c.MinRetryInterval) * time.Second
+		}
+		if c.MaxRetryInterval > 0 {
+			retry.MaxInterval = time.Duration(c.MaxRetryInterval) * time.Second
+		}
+		retry.MaxAttempts = c.MaxAttempts
+
+		outboxPath := ""
+		if outboxDir != "" {
+			outboxPath = filepath.Join(outboxDir, c.Name)
+		}
+		s, err := notify.NewSink(c.Name, notifier, topics, c.Format, retry, outboxPath)
+		if err != nil {
+			return fmt.Errorf("notify sink %s: %v", c.Name, err)
+		}
+		notify.AddSink(s)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/quarantine"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type quarantineRuleConfig struct {
+	Name          string
+	From          string
+	To            string
+	Method        string // 4-byte hex selector or signature such as "transfer(address,uint256)"
+	MinValueInNEW int64
+}
+
+// loadQuarantine opens the quarantine queue of [Quarantine], the approved transactions are forwarded to
+// the upstream routed for eth_sendRawTransaction by default
+func loadQuarantine(rawURL string) (*quarantine.Queue, error) {
+	var rules []quarantine.Rule
+	if minValueInNEW := viper.GetInt64("Quarantine.MinValueInNEW"); minValueInNEW > 0 {
+		rules = append(rules, quarantine.Rule{
+			Name:     "value",
+			MinValue: new(big.Int).Mul(big.NewInt(minValueInNEW), params.Big1NEW),
+		})
+	}
+
+	var ruleConfigs []quarantineRuleConfig
+	if err := viper.UnmarshalKey("Quarantine.Rule", &ruleConfigs); err != nil {
+		return nil, err
+	}
+	for i, c := range ruleConfigs {
+		rule := quarantine.Rule{Name: c.Name}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule%d", i)
+		}
+		if c.From != "" {
+			if !common.IsHexAddress(c.From) {
+				return nil, fmt.Errorf("address %s not invalid hex-encode", c.From)
+			}
+			from := common.HexToAddress(c.From)
+			rule.From = &from
+		}
+		if c.To != "" {
+			if !common.IsHexAddress(c.To) {
+				return nil, fmt.Errorf("address %s not invalid hex-encode", c.To)
+			}
+			to := common.HexToAddress(c.To)
+			rule.To = &to
+		}
+		if c.Method != "" {
+			selector, _, err := parseMethod(c.Method, nil)
+			if err != nil {
+				return nil, err
+			}
+			rule.Selector = selector[:]
+		}
+		if c.MinValueInNEW > 0 {
+			rule.MinValue = new(big.Int).Mul(big.NewInt(c.MinValueInNEW), params.Big1NEW)
+		}
+		if rule.From == nil && rule.To == nil && rule.Selector == nil && rule.MinValue == nil {
+			return nil, fmt.Errorf("quarantine rule %s matches nothing", rule.Name)
+		}
+		rules = append(rules, rule)
+	}
+
+	// the routed pool of transactions, or rawURL
+	backend := quarantine.NewRoutedBackend(rawURL)
+	if upstream := viper.GetString("Quarantine.Upstream"); upstream != "" {
+		client, err := ethclient.Dial(upstream)
+		if err != nil {
+			return nil, err
+		}
+		backend = client
+	}
+
+	return quarantine.Open(viper.GetString("Quarantine.Path"), backend, rules,
+		time.Duration(viper.GetInt("Quarantine.Expire"))*time.Second)
+}
+
+func (cli *CLI) buildQuarantineCmd() *cobra.Command {
+	var adminURL, token string
+
+	request := func(method, path string) error {
+		return adminRequest(method, strings.TrimRight(adminURL, "/")+"/quarantine/tx"+path, token)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "quarantine",
+		Short: "Manage the transactions held in quarantine",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cli.setup(cmd, args)
+			if adminURL == "" {
+				adminURL = defaultAdminURL("Quarantine.AdminURL")
+			}
+			if token == "" {
+				token = viper.GetString("Quarantine.AdminToken")
+			}
+		},
+	}
+	cmd.PersistentFlags().StringVar(&adminURL, "url", "", "The `url` of guard, Default Quarantine.AdminURL")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "The admin `token`, Default Quarantine.AdminToken")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the held transactions",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := request(http.MethodGet, ""); err != nil {
+				fmt.Println(err)
+			}
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "get <hash>",
+		Short: "Get the held transaction",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := request(http.MethodGet, "/"+args[0]); err != nil {
+				fmt.Println(err)
+			}
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "approve <hash>",
+		Short: "Approve and forward the held transaction to upstream",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := request(http.MethodPost, "/"+args[0]+"/approve"); err != nil {
+				fmt.Println(err)
+			}
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "deny <hash>",
+		Short: "Deny and drop the held transaction",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := request(http.MethodPost, "/"+args[0]+"/deny"); err != nil {
+				fmt.Println(err)
+			}
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/newtonproject/newchain-guard/router"
+	"github.com/spf13/viper"
+)
+
+// loadRouter returns the router of [Router], the default pool is rawURL if not set
+func loadRouter(rawURL string) (*router.Router, error) {
+	pools := viper.GetStringMapStringSlice("Router.Pools")
+	if _, ok := pools[router.DefaultPool]; !ok {
+		pools[router.DefaultPool] = []string{rawURL}
+	}
+
+	var rules []router.Rule
+	if err := viper.UnmarshalKey("Router.Rule", &rules); err != nil {
+		return nil, err
+	}
+
+	archiveDepth := uint64(router.DefaultArchiveDepth)
+	if viper.IsSet("Router.ArchiveDepth") {
+		archiveDepth = viper.GetUint64("Router.ArchiveDepth")
+	}
+
+	var backend router.Backend
+	for _, rule := range rules {
+		if rule.Block != "" {
+			client, err := ethclient.Dial(pools[router.DefaultPool][0])
+			if err != nil {
+				return nil, err
+			}
+			backend = client
+			break
+		}
+	}
+
+	return router.New(pools, rules, archiveDepth, backend)
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -13,8 +14,22 @@ import (
 
 	"github.com/didip/tollbooth"
 	"github.com/didip/tollbooth/limiter"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/newtonproject/newchain-guard/audit"
+	"github.com/newtonproject/newchain-guard/breaker"
+	"github.com/newtonproject/newchain-guard/concurrency"
+	"github.com/newtonproject/newchain-guard/gasoracle"
+	"github.com/newtonproject/newchain-guard/journal"
+	"github.com/newtonproject/newchain-guard/maintenance"
 	"github.com/newtonproject/newchain-guard/notify"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/quarantine"
+	"github.com/newtonproject/newchain-guard/router"
 	"github.com/newtonproject/newchain-guard/server"
+	"github.com/newtonproject/newchain-guard/tracing"
+	"github.com/newtonproject/newchain-guard/tracker"
+	"github.com/newtonproject/newchain-guard/velocity"
+	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -55,6 +70,13 @@ func (cli *CLI) buildServerCmd() *cobra.Command {
 				logger.Errorln("config is nil")
 				return
 			}
+			logPolicy, err := loadLogPolicy()
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			params.SetLogPolicy(logPolicy)
+
 			b, err := json.MarshalIndent(config, "", "\t")
 			if err != nil {
 				fmt.Println(err)
@@ -62,28 +84,218 @@ func (cli *CLI) buildServerCmd() *cobra.Command {
 			}
 			logger.Printf("The config is as follow: \n%s\n", string(b))
 
-			if config.EnableActiveMQ {
-				if clientID := viper.GetString("ActiveMQ.ClientID"); clientID != "" {
-					notify.ClientID = clientID
+			// the status APIs are served with the admin token only
+			adminToken := viper.GetString("AdminToken")
+			handleAdmin := func(pattern string, h http.Handler) {
+				if adminToken == "" {
+					logger.Warnf("AdminToken not set, %s is disabled", pattern)
+					return
+				}
+				http.Handle(pattern, params.RequireToken(adminToken, h))
+			}
+
+			if config.EnableNotify {
+				notify.Logger = logger
+				if err := loadNotifySinks(config.EnableActiveMQ); err != nil {
+					logger.Error(err)
+					return
+				}
+				handleAdmin("/notify/status", http.HandlerFunc(notify.StatusHandler))
+				notify.AddEvent(notify.NewEvent(notify.EventBlacklist, "", map[string]interface{}{
+					"fromBlackList":   len(config.FromBlackList),
+					"toBlackList":     len(config.ToBlackList),
+					"toWhiteList":     len(config.ToWhiteList),
+					"txHashBlackList": len(config.TxHashBlackList),
+				}))
+				notify.Start()
+			}
+
+			if viper.GetBool("EnableTracker") {
+				client, err := ethclient.Dial(config.RawURL)
+				if err != nil {
+					logger.Error(err)
+					return
 				}
-				if viper.IsSet("ActiveMQ.QoS") {
-					if qos := viper.GetInt("ActiveMQ.QoS"); qos == 0 || qos == 1 || qos == 2 {
-						notify.QoS = byte(qos)
+				t, err := tracker.New(client,
+					time.Duration(viper.GetInt("Tracker.PollInterval"))*time.Second,
+					time.Duration(viper.GetInt("Tracker.DropTimeout"))*time.Second,
+					viper.GetInt("Tracker.HistorySize"),
+					viper.GetInt("Tracker.MaxPending"),
+					viper.GetInt("Tracker.PollWorkers"),
+					viper.GetInt("Tracker.PollBatch"))
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				tracker.Enable(t)
+				go t.Run()
+				handleAdmin("/tracker/", t)
+				logger.Println("The transaction tracker is Enabled")
+			}
+
+			if viper.GetBool("EnableGasOracle") {
+				client, err := ethclient.Dial(config.RawURL)
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				o, err := gasoracle.New(client, gasoracle.Config{
+					Blocks:        viper.GetInt("GasOracle.Blocks"),
+					Percentile:    viper.GetInt("GasOracle.Percentile"),
+					HistoryBlocks: viper.GetInt("GasOracle.HistoryBlocks"),
+					PollInterval:  time.Duration(viper.GetInt("GasOracle.PollInterval")) * time.Second,
+					MaxAge:        time.Duration(viper.GetInt("GasOracle.MaxAge")) * time.Second,
+					MinGasPrice:   config.MinGasPriceInWEI,
+					MaxGasPrice:   config.MaxGasPriceInWEI,
+					MinGasTipCap:  config.MinGasTipCapInWEI,
+					MaxGasTipCap:  config.MaxGasTipCapInWEI,
+				})
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				gasoracle.Enable(o)
+				go o.Run()
+				logger.Println("The gas oracle is Enabled")
+			}
+
+			if viper.GetBool("EnableJournal") {
+				upstreamURLs := viper.GetStringSlice("Journal.Upstreams")
+				if len(upstreamURLs) == 0 {
+					upstreamURLs = []string{config.RawURL}
+				}
+				upstreams := make([]journal.Backend, 0, len(upstreamURLs))
+				for _, u := range upstreamURLs {
+					client, err := ethclient.Dial(u)
+					if err != nil {
+						logger.Error(err)
+						return
 					}
-				} else {
-					notify.QoS = byte(1)
+					upstreams = append(upstreams, client)
+				}
+				j, err := journal.Open(viper.GetString("Journal.Path"), upstreams,
+					time.Duration(viper.GetInt("Journal.RebroadcastInterval"))*time.Second,
+					time.Duration(viper.GetInt("Journal.MaxAge"))*time.Second)
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				journal.Enable(j)
+				defer j.Close()
+				go j.Run()
+				logger.Printf("The transaction journal is Enabled, rebroadcast to %v", upstreamURLs)
+			}
+
+			if viper.GetBool("EnableRouter") {
+				rt, err := loadRouter(config.RawURL)
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				router.Enable(rt)
+				logger.Println("The method router is Enabled")
+			}
+
+			if viper.GetBool("EnableCircuitBreaker") {
+				bs, err := loadBreakers()
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				breaker.Enable(bs)
+				logger.Println("The upstream circuit breaker is Enabled")
+			} else if config.HedgeUpstream != "" {
+				// only the latencies of upstreams are needed by hedging
+				breaker.Enable(breaker.NewBreakers(breaker.Config{}))
+			}
+			if config.HedgeUpstream != "" {
+				logger.Printf("The hedged requests to %s after p%v latency are Enabled", config.HedgeUpstream, config.HedgePercentile)
+			}
+
+			if viper.GetBool("EnableConcurrencyLimit") {
+				ls := loadConcurrency()
+				concurrency.Enable(ls)
+				handleAdmin("/concurrency/status", http.HandlerFunc(ls.StatusHandler))
+				logger.Println("The adaptive concurrency limit is Enabled")
+			}
+
+			if viper.GetBool("EnableQuarantine") {
+				token := viper.GetString("Quarantine.AdminToken")
+				if token == "" {
+					logger.Error("Quarantine.AdminToken not set")
+					return
 				}
-				if topic := viper.GetString("ActiveMQ.Topic"); topic != "" {
-					notify.Topic = topic
+				q, err := loadQuarantine(config.RawURL)
+				if err != nil {
+					logger.Error(err)
+					return
 				}
+				defer q.Close()
+				quarantine.Enable(q)
+				go q.Run()
+				http.Handle("/quarantine/", quarantine.NewAPI(q, token))
+				logger.Println("The transaction quarantine is Enabled")
+			}
 
-				go func() {
-					notify.InitAndRunNotifyClient(
-						viper.GetString("ActiveMQ.Server"),
-						viper.GetString("ActiveMQ.Username"),
-						viper.GetString("ActiveMQ.Password"),
-						logger)
-				}()
+			if viper.GetBool("EnableVelocityLimit") {
+				l, err := loadVelocity()
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				defer l.Close()
+				velocity.Enable(l)
+				go l.Run()
+				logger.Println("The sender velocity limit is Enabled")
+			}
+
+			// the read-only mode is always switchable by signals
+			m, err := loadMaintenance()
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			maintenance.Enable(m)
+			stopSignals := make(chan struct{})
+			defer close(stopSignals)
+			go m.HandleSignals(stopSignals)
+			if token := viper.GetString("Maintenance.AdminToken"); token != "" {
+				api := maintenance.NewAPI(m, token)
+				http.Handle("/maintenance", api)
+				http.Handle("/maintenance/", api)
+				logger.Println("The maintenance API is Enabled")
+			}
+
+			if endpoint := viper.GetString("Tracing.Endpoint"); endpoint != "" {
+				serviceName := viper.GetString("Tracing.ServiceName")
+				if serviceName == "" {
+					serviceName = "newchain-guard"
+				}
+				ratio := 1.0
+				if viper.IsSet("Tracing.SampleRatio") {
+					ratio = viper.GetFloat64("Tracing.SampleRatio")
+				}
+				shutdown, err := tracing.Init(endpoint, viper.GetBool("Tracing.Insecure"), serviceName, ratio)
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				defer shutdown(context.Background())
+				logger.Printf("The tracing is Enabled, export to %s", endpoint)
+			}
+
+			if auditPath := viper.GetString("Audit.Path"); auditPath != "" {
+				l, err := audit.Open(auditPath,
+					viper.GetInt64("Audit.MaxSize")*1024*1024,
+					time.Duration(viper.GetInt("Audit.MaxAge"))*time.Hour,
+					viper.GetBool("Audit.HashChain"))
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				defer l.Close()
+				audit.Enable(l)
+				logger.Printf("The audit log %s is Enabled", auditPath)
 			}
 
 			s := server.NewServer(config)
@@ -98,6 +310,18 @@ func (cli *CLI) buildServerCmd() *cobra.Command {
 					DefaultExpirationTTL: time.Second * 30})
 				lmt.SetIPLookups([]string{"X-Forwarded-For", "RemoteAddr", "X-Real-IP"})
 				lmt.SetMethods([]string{"POST"})
+				if config.EnableNotify {
+					// notify once per IP in the limiter expiration
+					tripped := cache.New(time.Second*30, time.Minute)
+					lmt.SetOnLimitReached(func(w http.ResponseWriter, r *http.Request) {
+						clientIP := params.GetRemoteIP(r)
+						if err := tripped.Add(clientIP, struct{}{}, cache.DefaultExpiration); err == nil {
+							notify.AddEvent(notify.NewEvent(notify.EventRateLimit, clientIP, map[string]interface{}{
+								"rate": IPRate,
+							}))
+						}
+					})
+				}
 				http.Handle("/", tollbooth.LimitFuncHandler(lmt, s.ServeHTTP))
 			} else {
 				http.HandleFunc("/", s.ServeHTTP)
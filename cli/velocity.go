@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/velocity"
+	"github.com/spf13/viper"
+)
+
+type velocityLimitConfig struct {
+	Window        int64 // seconds
+	MaxValueInNEW int64
+	MaxCount      int
+}
+
+type velocityOverrideConfig struct {
+	Address string
+	Limit   []velocityLimitConfig
+}
+
+func parseVelocityLimits(configs []velocityLimitConfig) ([]velocity.Limit, error) {
+	limits := make([]velocity.Limit, 0, len(configs))
+	for _, c := range configs {
+		if c.Window <= 0 {
+			return nil, fmt.Errorf("velocity limit window %d not positive", c.Window)
+		}
+		limit := velocity.Limit{Window: time.Duration(c.Window) * time.Second, MaxCount: c.MaxCount}
+		if c.MaxValueInNEW > 0 {
+			limit.MaxValue = new(big.Int).Mul(big.NewInt(c.MaxValueInNEW), params.Big1NEW)
+		}
+		if limit.MaxValue == nil && limit.MaxCount <= 0 {
+			return nil, fmt.Errorf("velocity limit of window %d limits nothing", c.Window)
+		}
+		limits = append(limits, limit)
+	}
+	return limits, nil
+}
+
+// loadVelocity opens the velocity limiter of [Velocity]
+func loadVelocity() (*velocity.Limiter, error) {
+	var limitConfigs []velocityLimitConfig
+	if err := viper.UnmarshalKey("Velocity.Limit", &limitConfigs); err != nil {
+		return nil, err
+	}
+	limits, err := parseVelocityLimits(limitConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrideConfigs []velocityOverrideConfig
+	if err := viper.UnmarshalKey("Velocity.Override", &overrideConfigs); err != nil {
+		return nil, err
+	}
+	overrides := make(map[common.Address][]velocity.Limit)
+	for _, c := range overrideConfigs {
+		if !common.IsHexAddress(c.Address) {
+			return nil, fmt.Errorf("address %s not invalid hex-encode", c.Address)
+		}
+		limits, err := parseVelocityLimits(c.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.Address, err)
+		}
+		overrides[common.HexToAddress(c.Address)] = limits
+	}
+
+	return velocity.Open(viper.GetString("Velocity.Path"), limits, overrides)
+}
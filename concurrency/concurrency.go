@@ -0,0 +1,308 @@
+package concurrency
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Priority is the priority class of request, the lower is shed first
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // the expensive methods of anonymous clients
+	PriorityNormal                 // the others
+	PriorityHigh                   // the transactions, and the clients of priority API keys
+	priorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrShed is returned if the request is shed by the limiter
+var ErrShed = errors.New("request shed")
+
+var (
+	DefaultInitialLimit = 20
+	DefaultMinLimit     = 1
+	DefaultMaxLimit     = 1000
+	DefaultTolerance    = 2.0
+	DefaultBackoff      = 0.9
+	DefaultLowShare     = 0.75
+	DefaultMaxQueue     = 100
+	DefaultMaxWait      = time.Second
+)
+
+// Config is the thresholds of the adaptive concurrency limiter
+type Config struct {
+	InitialLimit int           // the limit of requests in flight at start, Default 20
+	MinLimit     int           // Default 1
+	MaxLimit     int           // Default 1000
+	Tolerance    float64       // the latency over baseline multiplied by it decreases the limit, Default 2
+	Backoff      float64       // the limit is multiplied by it on decrease, Default 0.9
+	LowShare     float64       // the low priority requests are admitted below the share of limit only, Default 0.75
+	MaxQueue     int           // the requests waiting for the limit, Default 100, negative for no waiting
+	MaxWait      time.Duration // the request waited longer is shed, Default 1s
+}
+
+func (c *Config) setDefaults() {
+	if c.MinLimit <= 0 {
+		c.MinLimit = DefaultMinLimit
+	}
+	if c.MaxLimit <= 0 {
+		c.MaxLimit = DefaultMaxLimit
+	}
+	if c.MaxLimit < c.MinLimit {
+		c.MaxLimit = c.MinLimit
+	}
+	if c.InitialLimit <= 0 {
+		c.InitialLimit = DefaultInitialLimit
+	}
+	if c.InitialLimit < c.MinLimit {
+		c.InitialLimit = c.MinLimit
+	} else if c.InitialLimit > c.MaxLimit {
+		c.InitialLimit = c.MaxLimit
+	}
+	if c.Tolerance <= 1 {
+		c.Tolerance = DefaultTolerance
+	}
+	if c.Backoff <= 0 || c.Backoff >= 1 {
+		c.Backoff = DefaultBackoff
+	}
+	if c.LowShare <= 0 || c.LowShare > 1 {
+		c.LowShare = DefaultLowShare
+	}
+	if c.MaxQueue < 0 {
+		c.MaxQueue = 0
+	} else if c.MaxQueue == 0 {
+		c.MaxQueue = DefaultMaxQueue
+	}
+	if c.MaxWait <= 0 {
+		c.MaxWait = DefaultMaxWait
+	}
+}
+
+// waiter is a request waiting for the limit, ready receives true if admitted or false if shed
+type waiter struct {
+	ready chan bool
+}
+
+// Limiter limits the requests in flight, the limit is increased by one per window of
+// requests completed in time, and multiplied by Backoff if the latency exceeds the baseline
+// by Tolerance (AIMD). The waiting requests are admitted by priority, and the lowest are
+// shed first if the queue is full.
+type Limiter struct {
+	name   string
+	config Config
+
+	mu          sync.Mutex
+	limit       float64
+	inflight    int
+	waiters     [priorities]*list.List // of *waiter
+	queued      int
+	baseline    time.Duration // the minimum latency, drifted to the recent ones
+	decreasedAt time.Time
+	shed        [priorities]uint64
+}
+
+// New returns the limiter of name
+func New(name string, config Config) *Limiter {
+	config.setDefaults()
+	l := &Limiter{
+		name:   name,
+		config: config,
+		limit:  float64(config.InitialLimit),
+	}
+	for i := range l.waiters {
+		l.waiters[i] = list.New()
+	}
+	return l
+}
+
+// capacity returns the requests in flight allowed for priority
+func (l *Limiter) capacity(priority Priority) int {
+	c := int(l.limit)
+	if priority == PriorityLow {
+		c = int(l.limit * l.config.LowShare)
+	}
+	if c < 1 {
+		c = 1
+	}
+	return c
+}
+
+// waiting returns whether there are requests of priority or higher waiting
+func (l *Limiter) waiting(priority Priority) bool {
+	for p := priority; p < priorities; p++ {
+		if l.waiters[p].Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// evict sheds the latest waiting request of priority lower than priority
+func (l *Limiter) evict(priority Priority) bool {
+	for p := PriorityLow; p < priority; p++ {
+		if e := l.waiters[p].Back(); e != nil {
+			l.waiters[p].Remove(e)
+			l.queued--
+			l.shed[p]++
+			e.Value.(*waiter).ready <- false
+			return true
+		}
+	}
+	return false
+}
+
+// grant admits the waiting requests by priority
+func (l *Limiter) grant() {
+	for p := priorities - 1; p >= PriorityLow; p-- {
+		for l.waiters[p].Len() > 0 && l.inflight < l.capacity(p) {
+			e := l.waiters[p].Front()
+			l.waiters[p].Remove(e)
+			l.queued--
+			l.inflight++
+			e.Value.(*waiter).ready <- true
+		}
+		if l.waiters[p].Len() > 0 {
+			return
+		}
+	}
+}
+
+// Acquire waits until the request of priority admitted, or returns ErrShed if the request is shed
+// or the error of ctx. Release must be called if admitted.
+func (l *Limiter) Acquire(ctx context.Context, priority Priority) error {
+	if priority < PriorityLow || priority >= priorities {
+		priority = PriorityNormal
+	}
+
+	l.mu.Lock()
+	if l.inflight < l.capacity(priority) && !l.waiting(priority) {
+		l.inflight++
+		l.mu.Unlock()
+		return nil
+	}
+	if l.queued >= l.config.MaxQueue && !l.evict(priority) {
+		l.shed[priority]++
+		l.mu.Unlock()
+		return ErrShed
+	}
+	w := &waiter{ready: make(chan bool, 1)}
+	e := l.waiters[priority].PushBack(w)
+	l.queued++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.config.MaxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case ok := <-w.ready:
+		if ok {
+			return nil
+		}
+		return ErrShed
+	case <-timer.C:
+		err = ErrShed
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case ok := <-w.ready:
+		// admitted or shed meanwhile
+		if ok {
+			return nil
+		}
+		return ErrShed
+	default:
+	}
+	l.waiters[priority].Remove(e)
+	l.queued--
+	l.shed[priority]++
+	return err
+}
+
+// Release releases the request admitted and adapts the limit to its latency at now,
+// the latency 0 is not sampled, such as the request canceled by client
+func (l *Limiter) Release(latency time.Duration, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if latency > 0 {
+		l.adapt(latency, now)
+	}
+	l.inflight--
+	l.grant()
+}
+
+func (l *Limiter) adapt(latency time.Duration, now time.Time) {
+	if l.baseline == 0 || latency < l.baseline {
+		l.baseline = latency
+	} else {
+		// drift to the recent latencies, as the no-load latency of upstream changes
+		l.baseline += (latency - l.baseline) / 100
+	}
+
+	if float64(latency) > float64(l.baseline)*l.config.Tolerance {
+		// decrease once per latency, as the requests in flight are slow together
+		if now.Sub(l.decreasedAt) >= latency {
+			l.limit *= l.config.Backoff
+			if l.limit < float64(l.config.MinLimit) {
+				l.limit = float64(l.config.MinLimit)
+			}
+			l.decreasedAt = now
+		}
+		return
+	}
+	// increase only if the limit is used
+	if l.inflight*2 >= int(l.limit) {
+		l.limit += 1 / l.limit
+		if l.limit > float64(l.config.MaxLimit) {
+			l.limit = float64(l.config.MaxLimit)
+		}
+	}
+}
+
+// Status is the status of limiter
+type Status struct {
+	Name     string            `json:"name"`
+	Limit    int               `json:"limit"`
+	InFlight int               `json:"inFlight"`
+	Queued   int               `json:"queued"`
+	Baseline float64           `json:"baselineMs"`
+	Shed     map[string]uint64 `json:"shed"`
+}
+
+// Status returns the status of limiter
+func (l *Limiter) Status() *Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := &Status{
+		Name:     l.name,
+		Limit:    int(l.limit),
+		InFlight: l.inflight,
+		Queued:   l.queued,
+		Baseline: float64(l.baseline) / float64(time.Millisecond),
+		Shed:     make(map[string]uint64, priorities),
+	}
+	for p := PriorityLow; p < priorities; p++ {
+		s.Shed[p.String()] = l.shed[p]
+	}
+	return s
+}
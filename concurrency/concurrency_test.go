@@ -0,0 +1,152 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterPriority(t *testing.T) {
+	l := New("test", Config{InitialLimit: 4, LowShare: 0.5, MaxQueue: 2, MaxWait: time.Minute})
+	ctx := context.Background()
+
+	// low priority admitted below half of the limit only
+	for i := 0; i < 2; i++ {
+		if err := l.Acquire(ctx, PriorityLow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.Acquire(ctx, PriorityNormal); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the queue is filled by low and normal, and the low one is shed for high
+	results := make(map[Priority]chan error)
+	queued := func(p Priority) int {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.waiters[p].Len()
+	}
+	wait := func(p Priority) {
+		result := make(chan error, 1)
+		results[p] = result
+		go func() { result <- l.Acquire(ctx, p) }()
+		for deadline := time.Now().Add(time.Second); queued(p) == 0 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait(PriorityLow)
+	wait(PriorityNormal)
+	wait(PriorityHigh)
+	if err := <-results[PriorityLow]; err != ErrShed {
+		t.Errorf("low priority waiting %v, want shed", err)
+	}
+	if err := l.Acquire(ctx, PriorityLow); err != ErrShed {
+		t.Errorf("low priority %v with full queue, want shed", err)
+	}
+
+	// the high one is admitted before the normal one
+	l.Release(0, time.Now())
+	select {
+	case err := <-results[PriorityHigh]:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("high priority not admitted")
+	}
+	select {
+	case <-results[PriorityNormal]:
+		t.Fatal("normal priority admitted before release")
+	default:
+	}
+	l.Release(0, time.Now())
+	if err := <-results[PriorityNormal]; err != nil {
+		t.Error(err)
+	}
+
+	s := l.Status()
+	if s.InFlight != 4 || s.Queued != 0 || s.Shed["low"] != 2 {
+		t.Errorf("status %+v", s)
+	}
+}
+
+func TestLimiterMaxWait(t *testing.T) {
+	l := New("test", Config{InitialLimit: 1, MaxWait: 10 * time.Millisecond})
+	ctx := context.Background()
+	if err := l.Acquire(ctx, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Acquire(ctx, PriorityHigh); err != ErrShed {
+		t.Errorf("waited %v, want shed", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.Acquire(canceled, PriorityHigh); err != context.Canceled {
+		t.Errorf("canceled %v", err)
+	}
+	if l.queued != 0 {
+		t.Errorf("%d queued after wait", l.queued)
+	}
+}
+
+func TestLimiterAdapt(t *testing.T) {
+	l := New("test", Config{InitialLimit: 10, MinLimit: 2, MaxLimit: 11})
+	now := time.Now()
+	ctx := context.Background()
+
+	// increased while the latency near the baseline and the limit used
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 10; j++ {
+			l.Acquire(ctx, PriorityNormal)
+		}
+		for j := 0; j < 10; j++ {
+			l.Release(10*time.Millisecond, now)
+		}
+	}
+	if limit := l.Status().Limit; limit != 11 {
+		t.Errorf("limit %d, want max 11", limit)
+	}
+
+	// decreased once per latency if slow
+	for i := 0; i < 5; i++ {
+		l.Acquire(ctx, PriorityNormal)
+		l.Release(100*time.Millisecond, now)
+	}
+	if limit := l.Status().Limit; limit != 9 {
+		t.Errorf("limit %d, want 9 after a decrease", limit)
+	}
+	for i := 0; i < 30; i++ {
+		now = now.Add(time.Second)
+		l.Acquire(ctx, PriorityNormal)
+		l.Release(time.Second, now)
+	}
+	if limit := l.Status().Limit; limit != 2 {
+		t.Errorf("limit %d, want min 2", limit)
+	}
+}
+
+func TestLimitersPriority(t *testing.T) {
+	ls := NewLimiters(Config{}, Config{}, DefaultHighMethods, DefaultLowMethods, []string{"paid"})
+	for _, c := range []struct {
+		key     string
+		methods []string
+		want    Priority
+	}{
+		{"", []string{"eth_getLogs"}, PriorityLow},
+		{"free", []string{"eth_blockNumber", "eth_getLogs"}, PriorityLow},
+		{"paid", []string{"eth_getLogs"}, PriorityHigh},
+		{"", []string{"eth_getLogs", "eth_sendRawTransaction"}, PriorityHigh},
+		{"", []string{"eth_call"}, PriorityNormal},
+	} {
+		if p := ls.Priority(c.key, c.methods); p != c.want {
+			t.Errorf("priority of %s %v is %s, want %s", c.key, c.methods, p, c.want)
+		}
+	}
+	if ls.Upstream("http://a") != ls.Upstream("http://a") || len(ls.Status()) != 2 {
+		t.Error("upstream limiter not reused")
+	}
+}
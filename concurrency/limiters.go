@@ -0,0 +1,133 @@
+package concurrency
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// DefaultHighMethods are the methods of high priority
+var DefaultHighMethods = []string{"eth_sendRawTransaction"}
+
+// DefaultLowMethods are the methods of low priority for the anonymous clients
+var DefaultLowMethods = []string{"eth_getLogs"}
+
+// Limiters holds the global limiter of the guard, and the limiters of upstreams created on demand
+type Limiters struct {
+	global   *Limiter
+	upstream Config
+
+	highMethods map[string]bool
+	lowMethods  map[string]bool
+	keys        map[string]bool // the API keys of high priority
+
+	mu        sync.Mutex
+	upstreams map[string]*Limiter
+}
+
+// NewLimiters returns the limiters of global and each upstream config,
+// the requests of high methods or API keys are served before the others,
+// and the requests of low methods without those keys are shed first
+func NewLimiters(global, upstream Config, highMethods, lowMethods, keys []string) *Limiters {
+	set := func(list []string) map[string]bool {
+		m := make(map[string]bool, len(list))
+		for _, s := range list {
+			m[s] = true
+		}
+		return m
+	}
+	return &Limiters{
+		global:      New("global", global),
+		upstream:    upstream,
+		highMethods: set(highMethods),
+		lowMethods:  set(lowMethods),
+		keys:        set(keys),
+		upstreams:   make(map[string]*Limiter),
+	}
+}
+
+// Global returns the global limiter
+func (ls *Limiters) Global() *Limiter {
+	return ls.global
+}
+
+// Upstream returns the limiter of upstream rawURL
+func (ls *Limiters) Upstream(rawURL string) *Limiter {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	l, ok := ls.upstreams[rawURL]
+	if !ok {
+		l = New(rawURL, ls.upstream)
+		ls.upstreams[rawURL] = l
+	}
+	return l
+}
+
+// Priority returns the priority of the request of apiKey calling methods
+func (ls *Limiters) Priority(apiKey string, methods []string) Priority {
+	if apiKey != "" && ls.keys[apiKey] {
+		return PriorityHigh
+	}
+	priority := PriorityNormal
+	for _, method := range methods {
+		if ls.highMethods[method] {
+			return PriorityHigh
+		}
+		if ls.lowMethods[method] {
+			priority = PriorityLow
+		}
+	}
+	return priority
+}
+
+// Status returns the status of the global and upstream limiters
+func (ls *Limiters) Status() []*Status {
+	ls.mu.Lock()
+	upstreams := make([]*Limiter, 0, len(ls.upstreams))
+	for _, l := range ls.upstreams {
+		upstreams = append(upstreams, l)
+	}
+	ls.mu.Unlock()
+	sort.Slice(upstreams, func(i, j int) bool { return upstreams[i].name < upstreams[j].name })
+
+	status := []*Status{ls.global.Status()}
+	for _, l := range upstreams {
+		status = append(status, l.Status())
+	}
+	return status
+}
+
+// StatusHandler responses the status of the limiters
+func (ls *Limiters) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ls.Status())
+}
+
+type contextKey struct{}
+
+// WithPriority returns the context of request of priority
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, contextKey{}, priority)
+}
+
+// PriorityOf returns the priority of request context, PriorityNormal if not set
+func PriorityOf(ctx context.Context) Priority {
+	if p, ok := ctx.Value(contextKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+var std *Limiters
+
+// Enable sets the concurrency limiters
+func Enable(ls *Limiters) {
+	std = ls
+}
+
+// Default returns the concurrency limiters, nil if not enabled
+func Default() *Limiters {
+	return std
+}
@@ -4,23 +4,39 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"math/big"
 	"net/http"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/newtonproject/newchain-guard/notify"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (f *Filter) HandleJSONRequest(w http.ResponseWriter, r *http.Request, bodyBytes []byte) (*params.LogRequest, error) {
+	var span trace.Span
+	f.ctx, span = tracing.Start(r.Context(), "filter.check")
+	defer span.End()
+
 	var rawmsg json.RawMessage
 	if err := json.Unmarshal(bodyBytes, &rawmsg); err != nil {
 		return nil, err
 	}
 
 	msg, batch := parseMessage(rawmsg)
+	f.msgs, f.batch = msg, batch
 	if batch {
+		if f.isLocalBatch(msg) && f.responseLocalBatch(w, r, msg, string(bodyBytes)) {
+			return &params.LogRequest{
+				R:          r,
+				Logger:     f.ErrorLog,
+				StatusList: []int{params.StatusOK},
+				ReqBody:    bodyBytes,
+				IsBatch:    true,
+			}, params.ErrorGuard
+		}
+
 		resList, statusList, err := f.checkJSONBatchRequest(r, msg)
 		if err == params.ErrorGuard {
 			responseBytes, fErr := json.Marshal(resList)
@@ -47,6 +63,26 @@ func (f *Filter) HandleJSONRequest(w http.ResponseWriter, r *http.Request, bodyB
 
 		// params.LogBatchRequestInfo(r, f.ErrorLog, statusList, string(bodyBytes), "")
 
+		if len(f.answered) == len(msg) {
+			// nothing to forward
+			responseBytes, err := json.Marshal(f.localResponses)
+			if err != nil {
+				return nil, err
+			}
+			if len(f.localResponses) == 0 {
+				responseBytes = nil
+			}
+			w.Header().Set("Content-Type", "application/json")
+			params.LogBatchRequestAndResponse(w, r, f.ErrorLog, statusList, string(bodyBytes), responseBytes)
+			return &params.LogRequest{
+				R:          r,
+				Logger:     f.ErrorLog,
+				StatusList: statusList,
+				ReqBody:    bodyBytes,
+				IsBatch:    true,
+			}, params.ErrorGuard
+		}
+
 		return &params.LogRequest{
 			R:          r,
 			Logger:     f.ErrorLog,
@@ -77,12 +113,26 @@ func (f *Filter) HandleJSONRequest(w http.ResponseWriter, r *http.Request, bodyB
 	}, nil
 }
 
+// passedTx is a transaction in batch passed the guard
+type passedTx struct {
+	index  int
+	id     json.RawMessage
+	tx     *types.Transaction
+	raw    string
+	status int
+
+	// reason to hold in quarantine, empty if not held
+	held   bool
+	reason string
+}
+
 func (f *Filter) checkJSONBatchRequest(r *http.Request, ins []*jsonrpcMessage) ([]interface{}, []int, error) {
 	var (
-		gpList       []int
+		gasAnswers   []int
 		resList      []interface{}
 		statusList   []int
 		requestError bool
+		passedTxs    []passedTx
 	)
 
 	for i, in := range ins {
@@ -100,7 +150,8 @@ func (f *Filter) checkJSONBatchRequest(r *http.Request, ins []*jsonrpcMessage) (
 			continue
 		}
 
-		if !f.inWhitelistMethod(in.Method) {
+		// the local methods in batch with others are forwarded
+		if !f.inWhitelistMethod(in.Method) && !f.isLocalMethod(in.Method) {
 			resList = append(resList, params.JSONErrResponse{
 				Version: params.JSONRPCVersion,
 				ID:      in.ID,
@@ -114,6 +165,20 @@ func (f *Filter) checkJSONBatchRequest(r *http.Request, ins []*jsonrpcMessage) (
 			continue
 		}
 
+		if message, ok := f.readOnlyMessage(in.Method); ok {
+			resList = append(resList, params.JSONErrResponse{
+				Version: params.JSONRPCVersion,
+				ID:      in.ID,
+				Error: params.JSONError{
+					Code:    params.StatusReadOnly,
+					Message: fmt.Sprintf("%s - %d", message, params.StatusReadOnly),
+				},
+			})
+			statusList = append(statusList, params.StatusReadOnly)
+			requestError = true
+			continue
+		}
+
 		switch in.Method {
 		case "eth_sendRawTransaction":
 			hexParam, err := decodeRawTransaction(in.Params)
@@ -133,6 +198,7 @@ func (f *Filter) checkJSONBatchRequest(r *http.Request, ins []*jsonrpcMessage) (
 			}
 			tx, err := decodeTransaction(hexParam)
 			if err != nil {
+				f.notifyRejectedTx(r, nil, hexParam, params.StatusDecodeTransactionError)
 				resList = append(resList, params.JSONErrResponse{
 					Version: params.JSONRPCVersion,
 					ID:      in.ID,
@@ -146,18 +212,11 @@ func (f *Filter) checkJSONBatchRequest(r *http.Request, ins []*jsonrpcMessage) (
 				requestError = true
 				continue
 			}
-			status := f.checkTransaction(tx)
-			if status == params.StatusOK {
-				// params.LogRequestInfo(r, f.ErrorLog, params.StatusOK, in.String())
-				resList = append(resList, params.JSONSuccessResponse{
-					Version: params.JSONRPCVersion,
-					ID:      in.ID,
-				})
-				statusList = append(statusList, status)
-				continue
-			} else if status == params.StatusValueTooLarge {
+			status := f.checkTransactionVelocity(tx)
+			if status == params.StatusValueTooLarge {
 				params.LogRequestWarn(r, f.ErrorLog, params.StatusValueTooLarge, in.String())
-			} else {
+			} else if status != params.StatusOK {
+				f.notifyRejectedTx(r, tx, hexParam, status)
 				resList = append(resList, params.JSONErrResponse{
 					Version: params.JSONRPCVersion,
 					ID:      in.ID,
@@ -171,49 +230,69 @@ func (f *Filter) checkJSONBatchRequest(r *http.Request, ins []*jsonrpcMessage) (
 				requestError = true
 				continue
 			}
+			resList = append(resList, params.JSONSuccessResponse{
+				Version: params.JSONRPCVersion,
+				ID:      in.ID,
+			})
+			statusList = append(statusList, status)
 
-			// transaction pass
-			if f.config.EnableActiveMQ {
-				notify.AddTx(hexParam)
-			}
+			// transaction pass, notify after the whole batch pass
+			reason, held := f.matchQuarantine(tx)
+			passedTxs = append(passedTxs, passedTx{index: i, id: in.ID, tx: tx, raw: hexParam, status: status,
+				held: held, reason: reason})
 
 			continue
-		case "eth_gasPrice", "eth_maxPriorityFeePerGas":
+		case "eth_gasPrice", "eth_maxPriorityFeePerGas", "eth_feeHistory":
+			// answered by the guard like the single request, the fee history not answered is forwarded
+			res := params.JSONSuccessResponse{
+				Version: params.JSONRPCVersion,
+				ID:      in.ID,
+			}
+			if result, ok := f.gasResult(r, in); ok {
+				res.Result = result
+				gasAnswers = append(gasAnswers, i)
+			}
+			resList = append(resList, res)
+			statusList = append(statusList, params.StatusOK)
+		case "eth_getLogs":
+			// the range is not split in batch
+			if _, status := f.checkLogs(in.Params, false); status != params.StatusOK {
+				resList = append(resList, params.JSONErrResponse{
+					Version: params.JSONRPCVersion,
+					ID:      in.ID,
+					Error: params.JSONError{
+						Code:    status,
+						Message: fmt.Sprintf("%s - %d", params.ErrorInternalError.Error(), status),
+					},
+				})
+				statusList = append(statusList, status)
+				requestError = true
+				continue
+			}
+			resList = append(resList, params.JSONSuccessResponse{
+				Version: params.JSONRPCVersion,
+				ID:      in.ID,
+			})
+			statusList = append(statusList, params.StatusOK)
+		case "eth_call", "eth_estimateGas":
+			if status := f.checkCallMessage(in); status != params.StatusOK {
+				resList = append(resList, params.JSONErrResponse{
+					Version: params.JSONRPCVersion,
+					ID:      in.ID,
+					Error: params.JSONError{
+						Code:    status,
+						Message: fmt.Sprintf("%s - %d", params.ErrorInternalError.Error(), status),
+					},
+				})
+				statusList = append(statusList, status)
+				requestError = true
+				continue
+			}
 			resList = append(resList, params.JSONSuccessResponse{
 				Version: params.JSONRPCVersion,
 				ID:      in.ID,
 			})
 			statusList = append(statusList, params.StatusOK)
-			gpList = append(gpList, i)
-		// TODO: add gas price check
-		// gasPrice, err := getGasPrice(r.Context(), f.config.RawURL)
-		// if err != nil {
-		// 	params.LogRequestWarn(r, f.ErrorLog, params.StatusInternalError, err.Error())
-		// 	gasPrice = big.NewInt(0).Set(f.config.MinGasPriceInWEI)
-		// } else {
-		// 	if gasPrice.Cmp(f.config.MinGasPriceInWEI) < 0 {
-		// 		gasPrice.Set(f.config.MinGasPriceInWEI)
-		// 	}
-		// 	if f.config.MaxGasPriceInWEI != nil && gasPrice.Cmp(f.config.MaxGasPriceInWEI) > 0 {
-		// 		gasPrice.Set(f.config.MaxGasPriceInWEI)
-		// 	}
-		// }
-		//
-		// response := params.JSONSuccessResponse{
-		// 	Version: params.JSONRPCVersion,
-		// 	ID:      in.ID,
-		// 	Result:  hexutil.EncodeBig(gasPrice),
-		// }
-		// ret, err := json.Marshal(response)
-		// if err != nil {
-		// 	params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusGasPriceError, in.ID, in.String())
-		// 	return params.ErrorInternalError
-		// }
-		// w.Header().Set("Content-Type", "application/json")
-		// buf := bytes.NewBuffer(ret).Bytes()
-		// buf = append(buf, '\n')
-		// params.LogAndResponseOK(w, r, f.ErrorLog, params.StatusOK, buf, in.String())
-		// return params.ErrorGuard
 		default:
 			resList = append(resList, params.JSONSuccessResponse{
 				Version: params.JSONRPCVersion,
@@ -224,9 +303,24 @@ func (f *Filter) checkJSONBatchRequest(r *http.Request, ins []*jsonrpcMessage) (
 	}
 
 	if requestError {
+		// not forwarded, so not counted in the velocity limits
+		for _, passed := range passedTxs {
+			f.releaseVelocity(passed.tx)
+		}
 		return resList, statusList, params.ErrorGuard
 	}
 
+	for _, i := range gasAnswers {
+		f.answerBatch(i, resList[i])
+	}
+	for _, passed := range passedTxs {
+		if passed.held {
+			f.holdBatchTx(r, passed.index, passed.tx, passed.reason)
+			continue
+		}
+		f.notifyTx(r, passed.id, passed.tx, passed.raw, passed.status)
+	}
+
 	return resList, statusList, nil
 }
 
@@ -236,11 +330,21 @@ func (f *Filter) checkJSONRequest(w http.ResponseWriter, r *http.Request, in *js
 		return params.GetStatusError(params.StatusMethodNotAllowed)
 	}
 
+	// answered by the guard, even if not in the whitelist
+	if result, ok := f.localResult(in.Method); ok {
+		return f.responseResult(w, r, in.ID, result, in.String())
+	}
+
 	if !f.inWhitelistMethod(in.Method) {
 		params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusMethodNotWhitelist, in.ID, in.String())
 		return params.GetStatusError(params.StatusMethodNotWhitelist)
 	}
 
+	if message, ok := f.readOnlyMessage(in.Method); ok {
+		params.LogAndResponseJSONErrorMessage(w, r, f.ErrorLog, params.StatusReadOnly, in.ID, message, in.String())
+		return params.GetStatusError(params.StatusReadOnly)
+	}
+
 	switch in.Method {
 	case "eth_sendRawTransaction":
 		hexParam, err := decodeRawTransaction(in.Params)
@@ -250,87 +354,49 @@ func (f *Filter) checkJSONRequest(w http.ResponseWriter, r *http.Request, in *js
 		}
 		tx, err := decodeTransaction(hexParam)
 		if err != nil {
+			f.notifyRejectedTx(r, nil, hexParam, params.StatusDecodeTransactionError)
 			params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusDecodeTransactionError, in.ID, in.String())
 			return params.GetStatusError(params.StatusDecodeTransactionError)
 		}
-		status := f.checkTransaction(tx)
+		status := f.checkTransactionVelocity(tx)
 		if status == params.StatusOK {
 			params.LogRequestInfo(r, f.ErrorLog, params.StatusOK, in.String())
 		} else if status == params.StatusValueTooLarge {
 			params.LogRequestWarn(r, f.ErrorLog, params.StatusValueTooLarge, in.String())
 		} else {
+			f.notifyRejectedTx(r, tx, hexParam, status)
 			params.LogAndResponseJSONError(w, r, f.ErrorLog, status, in.ID, in.String())
 			return params.ErrorInternalError
 		}
 
-		// transaction pass
-		if f.config.EnableActiveMQ {
-			notify.AddTx(hexParam)
+		// transaction pass, held in quarantine if matched
+		if reason, held := f.matchQuarantine(tx); held {
+			if status := f.holdTx(r, tx, reason); status != params.StatusOK {
+				params.LogAndResponseJSONError(w, r, f.ErrorLog, status, in.ID, in.String())
+				return params.GetStatusError(status)
+			}
+			return f.responseResult(w, r, in.ID, tx.Hash(), in.String())
 		}
+		f.notifyTx(r, in.ID, tx, hexParam, status)
 
 		return nil
 	case "eth_gasPrice":
-		gasPrice, err := getGasPrice(r.Context(), f.config.RawURL)
-		if err != nil {
-			params.LogRequestWarn(r, f.ErrorLog, params.StatusInternalError, err.Error())
-			gasPrice = big.NewInt(0).Set(f.config.MinGasPriceInWEI)
-		} else {
-			if gasPrice.Cmp(f.config.MinGasPriceInWEI) < 0 {
-				gasPrice.Set(f.config.MinGasPriceInWEI)
-			}
-			if f.config.MaxGasPriceInWEI != nil && gasPrice.Cmp(f.config.MaxGasPriceInWEI) > 0 {
-				gasPrice.Set(f.config.MaxGasPriceInWEI)
-			}
-		}
-
-		response := params.JSONSuccessResponse{
-			Version: params.JSONRPCVersion,
-			ID:      in.ID,
-			Result:  hexutil.EncodeBig(gasPrice),
-		}
-		ret, err := json.Marshal(response)
-		if err != nil {
-			params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusGasPriceError, in.ID, in.String())
-			return params.ErrorInternalError
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		buf := bytes.NewBuffer(ret).Bytes()
-		buf = append(buf, '\n')
-		params.LogAndResponseOK(w, r, f.ErrorLog, params.StatusOK, buf, in.String())
-		return params.ErrorGuard
+		return f.responseResult(w, r, in.ID, hexutil.EncodeBig(f.gasPrice(r)), in.String())
 	case "eth_maxPriorityFeePerGas":
-		gasTipCap, err := getGasTipCap(r.Context(), f.config.RawURL)
-		if err != nil {
-			params.LogRequestWarn(r, f.ErrorLog, params.StatusInternalError, err.Error())
-			gasTipCap = big.NewInt(0).Set(f.config.MinGasTipCapInWEI)
-		} else {
-			if gasTipCap.Cmp(f.config.MinGasTipCapInWEI) < 0 {
-				gasTipCap.Set(f.config.MinGasTipCapInWEI)
-			}
-			if f.config.MaxGasTipCapInWEI != nil && gasTipCap.Cmp(f.config.MaxGasTipCapInWEI) > 0 {
-				gasTipCap.Set(f.config.MaxGasTipCapInWEI)
-			}
-		}
-
-		response := params.JSONSuccessResponse{
-			Version: params.JSONRPCVersion,
-			ID:      in.ID,
-			Result:  hexutil.EncodeBig(gasTipCap),
+		return f.responseResult(w, r, in.ID, hexutil.EncodeBig(f.gasTipCap(r)), in.String())
+	case "eth_feeHistory":
+		// answered by the gas oracle, or forwarded to the node
+		if history, ok := feeHistory(in.Params); ok {
+			return f.responseResult(w, r, in.ID, history, in.String())
 		}
-		ret, err := json.Marshal(response)
-		if err != nil {
-			params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusGasPriceError, in.ID, in.String())
-			return params.ErrorInternalError
+	case "eth_call", "eth_estimateGas":
+		if status := f.checkCallMessage(in); status != params.StatusOK {
+			params.LogAndResponseJSONError(w, r, f.ErrorLog, status, in.ID, in.String())
+			return params.GetStatusError(status)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		buf := bytes.NewBuffer(ret).Bytes()
-		buf = append(buf, '\n')
-		params.LogAndResponseOK(w, r, f.ErrorLog, params.StatusOK, buf, in.String())
-		return params.ErrorGuard
+	case "eth_getLogs":
+		// the oversized range is split by the guard if allowed
+		return f.responseLogs(w, r, in.ID, in.Params, in.String())
 	}
 
 	// params.LogRequestInfo(r, f.ErrorLog, params.StatusOK, in.String())
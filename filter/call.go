@@ -0,0 +1,132 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// checkCall checks the params of eth_call and eth_estimateGas,
+// and returns the params with the gas field injected or capped by MaxCallGas,
+// nil if the params is not changed
+func (f *Filter) checkCall(args json.RawMessage) (json.RawMessage, int) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(args, &raw); err != nil || len(raw) < 1 || len(raw) > 3 {
+		return nil, params.StatusCallArgsError
+	}
+
+	// the third param is the state override set
+	if len(raw) == 3 && !f.config.AllowStateOverride && !isEmptyObject(raw[2]) {
+		return nil, params.StatusStateOverrideNotAllowed
+	}
+
+	var call map[string]json.RawMessage
+	if err := json.Unmarshal(raw[0], &call); err != nil || call == nil {
+		return nil, params.StatusCallArgsError
+	}
+
+	var gas hexutil.Uint64
+	gasRaw, ok := call["gas"]
+	if ok && !isEmptyObject(gasRaw) {
+		if err := json.Unmarshal(gasRaw, &gas); err != nil {
+			return nil, params.StatusCallArgsError
+		}
+	} else {
+		ok = false
+	}
+
+	if f.config.MaxCallGas == 0 || (ok && uint64(gas) <= f.config.MaxCallGas) {
+		return nil, params.StatusOK
+	}
+
+	gasRaw, err := json.Marshal(hexutil.Uint64(f.config.MaxCallGas))
+	if err != nil {
+		return nil, params.StatusInternalError
+	}
+	call["gas"] = gasRaw
+	if raw[0], err = json.Marshal(call); err != nil {
+		return nil, params.StatusInternalError
+	}
+	rewritten, err := json.Marshal(raw)
+	if err != nil {
+		return nil, params.StatusInternalError
+	}
+
+	return rewritten, params.StatusOK
+}
+
+// isEmptyObject returns true if raw is null or {}
+func isEmptyObject(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	if bytes.Equal(raw, null) {
+		return true
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return false
+	}
+	return len(m) == 0
+}
+
+// checkCallMessage checks the call message, and rewrites its params if needed
+func (f *Filter) checkCallMessage(in *jsonrpcMessage) int {
+	rewritten, status := f.checkCall(in.Params)
+	if status != params.StatusOK {
+		return status
+	}
+
+	f.hasCall = true
+	if in.Method == "eth_estimateGas" {
+		f.estimateGasIDs = append(f.estimateGasIDs, in.ID)
+	}
+	if rewritten != nil {
+		in.Params = rewritten
+		f.rewritten = true
+	}
+
+	return params.StatusOK
+}
+
+// Body returns the request body to forward to the node without the messages answered by the guard,
+// which is nil if the request is not rewritten by the guard
+func (f *Filter) Body() []byte {
+	if !f.rewritten && len(f.answered) == 0 {
+		return nil
+	}
+	var (
+		body []byte
+		err  error
+	)
+	if f.batch {
+		msgs := make([]*jsonrpcMessage, 0, len(f.msgs))
+		for i, msg := range f.msgs {
+			if !f.answered[i] {
+				msgs = append(msgs, msg)
+			}
+		}
+		body, err = json.Marshal(msgs)
+	} else {
+		body, err = json.Marshal(f.msgs[0])
+	}
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+// CallTimeout returns the upstream timeout of request,
+// which is 0 if there is no eth_call or eth_estimateGas in the request
+func (f *Filter) CallTimeout() time.Duration {
+	if !f.hasCall {
+		return 0
+	}
+	return f.config.CallTimeout
+}
+
+// EstimateGasIDs returns the ids of eth_estimateGas in the request
+func (f *Filter) EstimateGasIDs() []json.RawMessage {
+	return f.estimateGasIDs
+}
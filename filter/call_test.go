@@ -0,0 +1,95 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+func TestCheckCall(t *testing.T) {
+	config := params.DefaultConfig
+	config.MaxCallGas = 50000000
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args   string
+		status int
+		gas    string // gas of the rewritten call, empty if not rewritten
+	}{
+		{`[{"to":"0x0000000000000000000000000000000000002048","data":"0x"},"latest"]`, params.StatusOK, "0x2faf080"},
+		{`[{"to":"0x0000000000000000000000000000000000002048","gas":"0x5208"},"latest"]`, params.StatusOK, ""},
+		{`[{"to":"0x0000000000000000000000000000000000002048","gas":"0xffffffff"}]`, params.StatusOK, "0x2faf080"},
+		{`[{"to":"0x0000000000000000000000000000000000002048","gas":null}]`, params.StatusOK, "0x2faf080"},
+		{`[{"to":"0x0000000000000000000000000000000000002048","gas":"0x5208"},"latest",{}]`, params.StatusOK, ""},
+		{`[{"to":"0x0000000000000000000000000000000000002048","gas":"0x5208"},"latest",null]`, params.StatusOK, ""},
+		{`[{"to":"0x0000000000000000000000000000000000002048"},"latest",{"0x0000000000000000000000000000000000002048":{"balance":"0x1"}}]`, params.StatusStateOverrideNotAllowed, ""},
+		{`[{"gas":"gas"}]`, params.StatusCallArgsError, ""},
+		{`["0x"]`, params.StatusCallArgsError, ""},
+		{`[]`, params.StatusCallArgsError, ""},
+		{`{}`, params.StatusCallArgsError, ""},
+	}
+	for i, test := range tests {
+		rewritten, status := f.checkCall(json.RawMessage(test.args))
+		if status != test.status {
+			t.Errorf("%d: status %d, want %d", i, status, test.status)
+			continue
+		}
+		if test.gas == "" {
+			if rewritten != nil {
+				t.Errorf("%d: rewritten %s, want nil", i, rewritten)
+			}
+			continue
+		}
+		var (
+			raw  []json.RawMessage
+			call map[string]interface{}
+		)
+		if err := json.Unmarshal(rewritten, &raw); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if err := json.Unmarshal(raw[0], &call); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if call["gas"] != test.gas || call["to"] != "0x0000000000000000000000000000000000002048" {
+			t.Errorf("%d: rewritten %s, want gas %s", i, rewritten, test.gas)
+		}
+	}
+
+	config.AllowStateOverride = true
+	if _, status := f.checkCall(json.RawMessage(tests[6].args)); status != params.StatusOK {
+		t.Errorf("state override allowed status %d, want %d", status, params.StatusOK)
+	}
+}
+
+func TestCallBody(t *testing.T) {
+	config := params.DefaultConfig
+	config.MaxCallGas = 1000
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.msgs, f.batch = parseMessage(json.RawMessage(`[{"jsonrpc":"2.0","id":1,"method":"eth_estimateGas","params":[{}]},` +
+		`{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber","params":[]}]`))
+	if f.Body() != nil || f.CallTimeout() != 0 {
+		t.Fatal("body rewritten before check")
+	}
+	if status := f.checkCallMessage(f.msgs[0]); status != params.StatusOK {
+		t.Fatalf("status %d, want %d", status, params.StatusOK)
+	}
+
+	var msgs []jsonrpcMessage
+	if err := json.Unmarshal(f.Body(), &msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || string(msgs[0].Params) != `[{"gas":"0x3e8"}]` || msgs[1].Method != "eth_blockNumber" {
+		t.Errorf("body %s", f.Body())
+	}
+	if ids := f.EstimateGasIDs(); len(ids) != 1 || string(ids[0]) != "1" {
+		t.Errorf("estimateGas ids %s, want [1]", ids)
+	}
+}
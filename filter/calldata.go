@@ -0,0 +1,85 @@
+package filter
+
+import (
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// checkCalldata checks the calldata size and the function selector rules of the to contract
+func (f *Filter) checkCalldata(tx *types.Transaction) int {
+	data := tx.Data()
+	if f.config.MaxCalldataSize > 0 && len(data) > f.config.MaxCalldataSize {
+		return params.StatusCalldataTooLarge
+	}
+
+	if tx.To() == nil || len(f.config.ContractRules) == 0 {
+		return params.StatusOK
+	}
+	rule, ok := f.config.ContractRules[*tx.To()]
+	if !ok {
+		return params.StatusOK
+	}
+
+	if len(data) < 4 {
+		// plain transfer or fallback call
+		if len(rule.AllowSelectors) > 0 {
+			return params.StatusSelectorNotAllowed
+		}
+		return params.StatusOK
+	}
+	var selector [4]byte
+	copy(selector[:], data[:4])
+
+	if _, ok := rule.DenySelectors[selector]; ok {
+		return params.StatusSelectorNotAllowed
+	}
+	if len(rule.AllowSelectors) > 0 {
+		if _, ok := rule.AllowSelectors[selector]; !ok {
+			return params.StatusSelectorNotAllowed
+		}
+	}
+
+	argRules, ok := rule.ArgumentRules[selector]
+	if !ok {
+		return params.StatusOK
+	}
+	args, err := rule.Inputs[selector].Unpack(data[4:])
+	if err != nil {
+		return params.StatusArgumentOutOfRange
+	}
+	for _, argRule := range argRules {
+		if argRule.Index >= len(args) {
+			return params.StatusArgumentOutOfRange
+		}
+		value, ok := toBig(args[argRule.Index])
+		if !ok {
+			return params.StatusArgumentOutOfRange
+		}
+		if argRule.Min != nil && value.Cmp(argRule.Min) < 0 {
+			return params.StatusArgumentOutOfRange
+		}
+		if argRule.Max != nil && value.Cmp(argRule.Max) > 0 {
+			return params.StatusArgumentOutOfRange
+		}
+	}
+
+	return params.StatusOK
+}
+
+// toBig converts the unpacked integer argument to big.Int
+func toBig(arg interface{}) (*big.Int, bool) {
+	if b, ok := arg.(*big.Int); ok {
+		return b, true
+	}
+	v := reflect.ValueOf(arg)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(v.Uint()), true
+	}
+	return nil, false
+}
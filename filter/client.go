@@ -0,0 +1,29 @@
+package filter
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[string]*ethclient.Client)
+)
+
+// dialClient returns the client shared by all requests to rpcurl, dial on first use
+func dialClient(rpcurl string) (*ethclient.Client, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if client, ok := clients[rpcurl]; ok {
+		return client, nil
+	}
+	client, err := ethclient.Dial(rpcurl)
+	if err != nil {
+		return nil, err
+	}
+	clients[rpcurl] = client
+
+	return client, nil
+}
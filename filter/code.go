@@ -0,0 +1,82 @@
+package filter
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+const getCodeTimeout = 5 * time.Second
+
+// codeCache caches whether the address is a contract
+var codeCache = cache.New(params.DefaultCodeCacheTTL, 2*params.DefaultCodeCacheTTL)
+
+// checkToAllowed checks the to address is in the whitelist if set, and of the type required,
+// the contract creation is not allowed with the whitelist
+func (f *Filter) checkToAllowed(to *common.Address) int {
+	if to == nil {
+		if len(f.config.ToWhiteList) > 0 {
+			return params.StatusToAddressNotWhitelist
+		}
+		return params.StatusOK
+	}
+	if len(f.config.ToWhiteList) > 0 {
+		if _, ok := f.config.ToWhiteList[*to]; !ok {
+			return params.StatusToAddressNotWhitelist
+		}
+	}
+	return f.checkToType(*to)
+}
+
+// checkToType checks the to address is a contract or an EOA as config required
+func (f *Filter) checkToType(to common.Address) int {
+	if f.config.RequireToType == "" {
+		return params.StatusOK
+	}
+
+	isContract, err := f.isContract(to)
+	if err != nil {
+		log.Errorln("get code error:", err)
+		return params.StatusGetCodeError
+	}
+
+	switch f.config.RequireToType {
+	case params.ToTypeContract:
+		if !isContract {
+			return params.StatusToAddressNotContract
+		}
+	case params.ToTypeEOA:
+		if isContract {
+			return params.StatusToAddressNotEOA
+		}
+	}
+
+	return params.StatusOK
+}
+
+// isContract returns whether address has code, looked up in the node within the request and getCodeTimeout
+func (f *Filter) isContract(address common.Address) (bool, error) {
+	if isContract, ok := codeCache.Get(address.Hex()); ok {
+		return isContract.(bool), nil
+	}
+
+	client, err := dialClient(f.config.RawURL)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(f.ctx, getCodeTimeout)
+	defer cancel()
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return false, err
+	}
+
+	isContract := len(code) > 0
+	codeCache.Set(address.Hex(), isContract, f.config.CodeCacheTTL)
+
+	return isContract, nil
+}
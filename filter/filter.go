@@ -1,30 +1,52 @@
 package filter
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"math/big"
-	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/newtonproject/newchain-guard/gasoracle"
 	mysql "github.com/newtonproject/newchain-guard/gluasql_mysql"
-	"github.com/newtonproject/newchain-guard/notify"
 	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/tracing"
 	log "github.com/sirupsen/logrus"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	lua "github.com/yuin/gopher-lua"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const senderCacheSize = 4096
+
+// senderCache is the LRU cache of tx hash to recovered sender
+var senderCache, _ = lru.New(senderCacheSize)
+
+// recoverSender recovers the sender of tx by signer, replaced in tests
+var recoverSender = types.Sender
+
 type Filter struct {
 	config   *params.Config
 	ErrorLog *log.Logger
+
+	// ctx is the context of request being checked, for tracing
+	ctx context.Context
+
+	// messages of request, rewritten by the call checks
+	msgs           []*jsonrpcMessage
+	batch          bool
+	rewritten      bool
+	hasCall        bool
+	estimateGasIDs []json.RawMessage
+
+	// batch messages answered by the guard, such as the transactions held in quarantine
+	answered       map[int]bool
+	localResponses []json.RawMessage
 }
 
 func NewFilter(config *params.Config, log *log.Logger) (*Filter, error) {
@@ -32,7 +54,7 @@ func NewFilter(config *params.Config, log *log.Logger) (*Filter, error) {
 		return nil, params.GetStatusError(params.StatusFilterNoConfig)
 	}
 
-	return &Filter{config: config, ErrorLog: log}, nil
+	return &Filter{config: config, ErrorLog: log, ctx: context.Background()}, nil
 }
 
 func (f *Filter) inWhitelistMethod(method string) bool {
@@ -40,119 +62,6 @@ func (f *Filter) inWhitelistMethod(method string) bool {
 	return ok
 }
 
-func (f *Filter) CheckJSONRequest(w http.ResponseWriter, r *http.Request, bodyBytes []byte) error {
-	var in params.JSONRequest
-	if err := json.Unmarshal(bodyBytes, &in); err != nil {
-		params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusInvalidJSONRequest, in.ID, string(bodyBytes))
-		return err
-	}
-
-	if len(strings.Split(in.Method, serviceMethodSeparator)) != 2 {
-		params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusMethodNotAllowed, in.ID, string(bodyBytes))
-		return params.GetStatusError(params.StatusMethodNotAllowed)
-	}
-
-	if !f.inWhitelistMethod(in.Method) {
-		params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusMethodNotWhitelist, in.ID, string(bodyBytes))
-		return params.GetStatusError(params.StatusMethodNotWhitelist)
-	}
-
-	switch in.Method {
-	case "eth_sendRawTransaction":
-		hexParam, err := decodeRawTransaction(in.Payload)
-		if err != nil {
-			params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusDecodeTransactionError, in.ID, string(bodyBytes))
-			return params.GetStatusError(params.StatusDecodeTransactionError)
-		}
-		tx, err := decodeTransaction(hexParam)
-		if err != nil {
-			params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusDecodeTransactionError, in.ID, string(bodyBytes))
-			return params.GetStatusError(params.StatusDecodeTransactionError)
-		}
-		status := f.checkTransaction(tx)
-		if status == params.StatusOK {
-			params.LogRequestInfo(r, f.ErrorLog, params.StatusOK, string(bodyBytes))
-		} else if status == params.StatusValueTooLarge {
-			params.LogRequestWarn(r, f.ErrorLog, params.StatusValueTooLarge, string(bodyBytes))
-		} else {
-			params.LogAndResponseJSONError(w, r, f.ErrorLog, status, in.ID, string(bodyBytes))
-			return params.ErrorInternalError
-		}
-
-		// transaction pass
-		if f.config.EnableActiveMQ {
-			notify.AddTx(hexParam)
-		}
-
-		return nil
-	case "eth_gasPrice":
-		gasPrice, err := getGasPrice(r.Context(), f.config.RawURL)
-		if err != nil {
-			params.LogRequestWarn(r, f.ErrorLog, params.StatusInternalError, err.Error())
-			gasPrice = big.NewInt(0).Set(f.config.MinGasPriceInWEI)
-		} else {
-			if gasPrice.Cmp(f.config.MinGasPriceInWEI) < 0 {
-				gasPrice.Set(f.config.MinGasPriceInWEI)
-			}
-			if f.config.MaxGasPriceInWEI != nil && gasPrice.Cmp(f.config.MaxGasPriceInWEI) > 0 {
-				gasPrice.Set(f.config.MaxGasPriceInWEI)
-			}
-		}
-
-		response := params.JSONSuccessResponse{
-			Version: params.JSONRPCVersion,
-			ID:      in.ID,
-			Result:  hexutil.EncodeBig(gasPrice),
-		}
-		ret, err := json.Marshal(response)
-		if err != nil {
-			params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusGasPriceError, in.ID, string(bodyBytes))
-			return params.ErrorInternalError
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		buf := bytes.NewBuffer(ret).Bytes()
-		buf = append(buf, '\n')
-		params.LogAndResponseOK(w, r, f.ErrorLog, params.StatusOK, buf, string(bodyBytes))
-		return params.ErrorGuard
-	case "eth_maxPriorityFeePerGas":
-		gasTipCap, err := getGasTipCap(r.Context(), f.config.RawURL)
-		if err != nil {
-			params.LogRequestWarn(r, f.ErrorLog, params.StatusInternalError, err.Error())
-			gasTipCap = big.NewInt(0).Set(f.config.MinGasTipCapInWEI)
-		} else {
-			if gasTipCap.Cmp(f.config.MinGasTipCapInWEI) < 0 {
-				gasTipCap.Set(f.config.MinGasTipCapInWEI)
-			}
-			if f.config.MaxGasTipCapInWEI != nil && gasTipCap.Cmp(f.config.MaxGasTipCapInWEI) > 0 {
-				gasTipCap.Set(f.config.MaxGasTipCapInWEI)
-			}
-		}
-
-		response := params.JSONSuccessResponse{
-			Version: params.JSONRPCVersion,
-			ID:      in.ID,
-			Result:  hexutil.EncodeBig(gasTipCap),
-		}
-		ret, err := json.Marshal(response)
-		if err != nil {
-			params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusGasPriceError, in.ID, string(bodyBytes))
-			return params.ErrorInternalError
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		buf := bytes.NewBuffer(ret).Bytes()
-		buf = append(buf, '\n')
-		params.LogAndResponseOK(w, r, f.ErrorLog, params.StatusOK, buf, string(bodyBytes))
-		return params.ErrorGuard
-	}
-
-	params.LogRequestInfo(r, f.ErrorLog, params.StatusOK, string(bodyBytes))
-	return nil
-}
-
 func decodeRawTransaction(raw json.RawMessage) (string, error) {
 	var hexParams [1]string
 	err := json.Unmarshal(raw, &hexParams)
@@ -185,6 +94,16 @@ func (f *Filter) checkTransaction(tx *types.Transaction) int {
 		return params.StatusInternalError
 	}
 
+	// tx type
+	if len(f.config.TxTypeAllowList) > 0 {
+		if _, ok := f.config.TxTypeAllowList[tx.Type()]; !ok {
+			return params.StatusTxTypeNotAllowed
+		}
+	}
+	if f.config.RequireEIP155 && tx.Type() == types.LegacyTxType && !tx.Protected() {
+		return params.StatusNotEIP155Protected
+	}
+
 	// ChainID
 	// if tx.ChainId().Uint64() != f.config.ChainID {
 	if tx.ChainId().Cmp(f.config.ChainID) != 0 {
@@ -218,19 +137,29 @@ func (f *Filter) checkTransaction(tx *types.Transaction) int {
 		}
 	}
 
+	// access list
+	if status := f.checkAccessList(tx.AccessList()); status != params.StatusOK {
+		return status
+	}
+
+	// calldata
+	if status := f.checkCalldata(tx); status != params.StatusOK {
+		return status
+	}
+
+	// to whitelist and type, required with the Lua filter too
+	if status := f.checkToAllowed(tx.To()); status != params.StatusOK {
+		return status
+	}
+
 	// call lua
 	if f.config.EnableLuaFilter {
 		hash := tx.Hash()
 		to := tx.To()
 		if f.config.EnableFromCheck {
-			signer := types.NewLondonSigner(f.config.ChainID)
-			from, err := signer.Sender(tx)
-			if err != nil {
-				log.Errorln("Sender error:", err)
-				return params.StatusSignatureVerifyFailed
-			}
-			if from == (common.Address{}) {
-				return params.StatusEmptyFromAddress
+			from, status := f.sender(tx)
+			if status != params.StatusOK {
+				return status
 			}
 			code, err := f.CheckTx(&hash, &from, to)
 			if err != nil {
@@ -281,13 +210,9 @@ func (f *Filter) checkTransaction(tx *types.Transaction) int {
 
 	// from
 	if f.config.EnableWhitelistDB || len(f.config.FromBlackList) > 0 {
-		signer := NewEIP155Signer(f.config.ChainID)
-		from, err := signer.Sender(tx)
-		if err != nil {
-			return params.StatusSignatureVerifyFailed
-		}
-		if from == (common.Address{}) {
-			return params.StatusEmptyFromAddress
+		from, status := f.sender(tx)
+		if status != params.StatusOK {
+			return status
 		}
 
 		// check from black
@@ -311,11 +236,49 @@ func (f *Filter) checkTransaction(tx *types.Transaction) int {
 	return status
 }
 
+// sender recovers the from address of tx with the NewChain signer.
+// The sender is cached on tx for the request and by tx hash across requests.
+func (f *Filter) sender(tx *types.Transaction) (common.Address, int) {
+	hash := tx.Hash()
+	if from, ok := senderCache.Get(hash); ok {
+		return from.(common.Address), params.StatusOK
+	}
+
+	from, err := recoverSender(NewSigner(f.config.ChainID), tx)
+	if err == ErrSecp256r1HalfN {
+		return common.Address{}, params.StatusSecp256r1HalfN
+	} else if err != nil {
+		log.Errorln("Sender error:", err)
+		return common.Address{}, params.StatusSignatureVerifyFailed
+	}
+	if from == (common.Address{}) {
+		return common.Address{}, params.StatusEmptyFromAddress
+	}
+	senderCache.Add(hash, from)
+
+	return from, params.StatusOK
+}
+
+func (f *Filter) checkAccessList(accessList types.AccessList) int {
+	if f.config.MaxAccessListSize > 0 && len(accessList) > f.config.MaxAccessListSize {
+		return params.StatusAccessListTooLarge
+	}
+	if f.config.MaxAccessListStorageKeys > 0 && accessList.StorageKeys() > f.config.MaxAccessListStorageKeys {
+		return params.StatusAccessListTooLarge
+	}
+
+	return params.StatusOK
+}
+
 func (f *Filter) CheckTx(hash *common.Hash, from, to *common.Address) (int, error) {
 	if !f.config.EnableLuaFilter {
 		return params.StatusInternalError, nil // StatusInternalError
 	}
 
+	_, span := tracing.Start(f.ctx, "filter.lua",
+		attribute.String("lua.function", f.config.LuaCallFunctionName))
+	defer span.End()
+
 	ls := lua.NewState()
 	defer ls.Close()
 	ls.PreloadModule("mysql", mysql.Loader)
@@ -367,16 +330,24 @@ func (f *Filter) CheckTx(hash *common.Hash, from, to *common.Address) (int, erro
 	return strconv.Atoi(ret.String())
 }
 
+// getGasPrice returns the gas price suggested by the gas oracle if enabled and not stale, or by the node at rpcurl
 func getGasPrice(ctx context.Context, rpcurl string) (*big.Int, error) {
-	client, err := ethclient.Dial(rpcurl)
+	if o := gasoracle.Fresh(); o != nil {
+		return o.GasPrice(), nil
+	}
+	client, err := dialClient(rpcurl)
 	if err != nil {
 		return nil, err
 	}
 	return client.SuggestGasPrice(ctx)
 }
 
+// getGasTipCap returns the gas tip cap suggested by the gas oracle if enabled and not stale, or by the node at rpcurl
 func getGasTipCap(ctx context.Context, rpcurl string) (*big.Int, error) {
-	client, err := ethclient.Dial(rpcurl)
+	if o := gasoracle.Fresh(); o != nil {
+		return o.GasTipCap(), nil
+	}
+	client, err := dialClient(rpcurl)
 	if err != nil {
 		return nil, err
 	}
@@ -1,8 +1,12 @@
 package filter
 
 import (
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/newtonproject/newchain-guard/params"
@@ -37,3 +41,144 @@ func TestCheckTransaction(t *testing.T) {
 		}
 	}()
 }
+
+func TestCheckTransactionType(t *testing.T) {
+	config := params.DefaultConfig
+	config.TxTypeAllowList = map[uint8]struct{}{types.DynamicFeeTxType: {}}
+	config.RequireEIP155 = true
+	config.MaxAccessListSize = 1
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessList := types.AccessList{
+		{Address: common.HexToAddress("0x1024")},
+		{Address: common.HexToAddress("0x2048")},
+	}
+	accessListTx := types.NewTx(&types.AccessListTx{ChainID: config.ChainID, Gas: 21000, GasPrice: big.NewInt(1)})
+	if status := f.checkTransaction(accessListTx); status != params.StatusTxTypeNotAllowed {
+		t.Errorf("access list tx status %d, want %d", status, params.StatusTxTypeNotAllowed)
+	}
+
+	dynamicFeeTx := types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1)})
+	if status := f.checkTransaction(dynamicFeeTx); status != params.StatusOK {
+		t.Errorf("dynamic fee tx status %d, want %d", status, params.StatusOK)
+	}
+
+	dynamicFeeTx = types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1), AccessList: accessList})
+	if status := f.checkTransaction(dynamicFeeTx); status != params.StatusAccessListTooLarge {
+		t.Errorf("dynamic fee tx status %d, want %d", status, params.StatusAccessListTooLarge)
+	}
+
+	config.TxTypeAllowList = nil
+	legacyTx, err := types.NewTransaction(0, common.HexToAddress("0x1024"), nil, 21000, big.NewInt(1), nil).WithSignature(types.HomesteadSigner{}, make([]byte, 65))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := f.checkTransaction(legacyTx); status != params.StatusNotEIP155Protected {
+		t.Errorf("legacy tx status %d, want %d", status, params.StatusNotEIP155Protected)
+	}
+}
+
+func TestCheckCalldata(t *testing.T) {
+	token := common.HexToAddress("0x1024")
+	transfer := [4]byte{0xa9, 0x05, 0x9c, 0xbb} // transfer(address,uint256)
+	addressType, _ := abi.NewType("address", "", nil)
+	uint256Type, _ := abi.NewType("uint256", "", nil)
+	inputs := abi.Arguments{{Type: addressType}, {Type: uint256Type}}
+
+	config := params.DefaultConfig
+	config.MaxCalldataSize = 68
+	config.ContractRules = map[common.Address]*params.ContractRule{
+		token: {
+			AllowSelectors: map[[4]byte]struct{}{transfer: {}},
+			Inputs:         map[[4]byte]abi.Arguments{transfer: inputs},
+			ArgumentRules:  map[[4]byte][]params.ArgumentRule{transfer: {{Index: 1, Max: big.NewInt(100)}}},
+		},
+	}
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(selector [4]byte, amount int64) []byte {
+		args, err := inputs.Pack(common.HexToAddress("0x2048"), big.NewInt(amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(selector[:], args...)
+	}
+
+	tests := []struct {
+		data   []byte
+		status int
+	}{
+		{call(transfer, 100), params.StatusOK},
+		{call(transfer, 101), params.StatusArgumentOutOfRange},
+		{call([4]byte{0x09, 0x5e, 0xa7, 0xb3}, 1), params.StatusSelectorNotAllowed},
+		{nil, params.StatusSelectorNotAllowed},
+		{append(call(transfer, 1), 0), params.StatusCalldataTooLarge},
+	}
+	for i, test := range tests {
+		tx := types.NewTransaction(0, token, nil, 21000, big.NewInt(1), test.data)
+		if status := f.checkCalldata(tx); status != test.status {
+			t.Errorf("test %d: status %d, want %d", i, status, test.status)
+		}
+	}
+}
+
+func TestCheckToAddress(t *testing.T) {
+	contract := common.HexToAddress("0x3072")
+	eoa := common.HexToAddress("0x5120")
+	codeCache.SetDefault(contract.Hex(), true)
+	codeCache.SetDefault(eoa.Hex(), false)
+
+	config := params.DefaultConfig
+	config.ToWhiteList = map[common.Address]struct{}{contract: {}, eoa: {}}
+	config.RequireToType = params.ToTypeContract
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		to     common.Address
+		status int
+	}{
+		{contract, params.StatusOK},
+		{eoa, params.StatusToAddressNotContract},
+		{common.HexToAddress("0x4096"), params.StatusToAddressNotWhitelist},
+	}
+	for i, test := range tests {
+		to := test.to
+		tx := types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, To: &to, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1)})
+		if status := f.checkTransaction(tx); status != test.status {
+			t.Errorf("test %d: status %d, want %d", i, status, test.status)
+		}
+	}
+
+	// the Lua filter allowing all does not skip the checks
+	luaFile := filepath.Join(t.TempDir(), "guard.lua")
+	if err := ioutil.WriteFile(luaFile, []byte("function checkTx(hash, from, to)\n    return 200\nend\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.EnableLuaFilter = true
+	config.EnableFromCheck = false
+	config.LuaFile = luaFile
+	config.LuaCallFunctionName = "checkTx"
+	if f, err = NewFilter(&config, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		to := test.to
+		tx := types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, To: &to, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1)})
+		if status := f.checkTransaction(tx); status != test.status {
+			t.Errorf("lua test %d: status %d, want %d", i, status, test.status)
+		}
+	}
+	create := types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1)})
+	if status := f.checkTransaction(create); status != params.StatusToAddressNotWhitelist {
+		t.Errorf("lua contract creation: status %d, want %d", status, params.StatusToAddressNotWhitelist)
+	}
+}
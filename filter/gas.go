@@ -0,0 +1,128 @@
+package filter
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/newtonproject/newchain-guard/gasoracle"
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// gasPrice returns the gas price suggested within MinGasPriceInWEI and MaxGasPriceInWEI,
+// MinGasPriceInWEI if failed
+func (f *Filter) gasPrice(r *http.Request) *big.Int {
+	gasPrice, err := getGasPrice(r.Context(), f.config.RawURL)
+	if err != nil {
+		params.LogRequestWarn(r, f.ErrorLog, params.StatusInternalError, err.Error())
+		return big.NewInt(0).Set(f.config.MinGasPriceInWEI)
+	}
+	if gasPrice.Cmp(f.config.MinGasPriceInWEI) < 0 {
+		gasPrice.Set(f.config.MinGasPriceInWEI)
+	}
+	if f.config.MaxGasPriceInWEI != nil && gasPrice.Cmp(f.config.MaxGasPriceInWEI) > 0 {
+		gasPrice.Set(f.config.MaxGasPriceInWEI)
+	}
+	return gasPrice
+}
+
+// gasTipCap returns the gas tip cap suggested within MinGasTipCapInWEI and MaxGasTipCapInWEI,
+// MinGasTipCapInWEI if failed
+func (f *Filter) gasTipCap(r *http.Request) *big.Int {
+	gasTipCap, err := getGasTipCap(r.Context(), f.config.RawURL)
+	if err != nil {
+		params.LogRequestWarn(r, f.ErrorLog, params.StatusInternalError, err.Error())
+		return big.NewInt(0).Set(f.config.MinGasTipCapInWEI)
+	}
+	if gasTipCap.Cmp(f.config.MinGasTipCapInWEI) < 0 {
+		gasTipCap.Set(f.config.MinGasTipCapInWEI)
+	}
+	if f.config.MaxGasTipCapInWEI != nil && gasTipCap.Cmp(f.config.MaxGasTipCapInWEI) > 0 {
+		gasTipCap.Set(f.config.MaxGasTipCapInWEI)
+	}
+	return gasTipCap
+}
+
+// gasResult returns the result of the gas method in answered by the guard,
+// and false if the fee history can not be answered by the gas oracle
+func (f *Filter) gasResult(r *http.Request, in *jsonrpcMessage) (interface{}, bool) {
+	switch in.Method {
+	case "eth_gasPrice":
+		return hexutil.EncodeBig(f.gasPrice(r)), true
+	case "eth_maxPriorityFeePerGas":
+		return hexutil.EncodeBig(f.gasTipCap(r)), true
+	case "eth_feeHistory":
+		return feeHistory(in.Params)
+	}
+	return nil, false
+}
+
+// feeHistory returns the eth_feeHistory result of the gas oracle,
+// and false if the oracle is disabled, stale or can not answer the request
+func feeHistory(args json.RawMessage) (*gasoracle.FeeHistory, bool) {
+	o := gasoracle.Fresh()
+	if o == nil {
+		return nil, false
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(args, &raw); err != nil || len(raw) < 2 || len(raw) > 3 {
+		return nil, false
+	}
+
+	var blockCount hexutil.Uint64
+	if err := json.Unmarshal(raw[0], &blockCount); err != nil {
+		var n uint64
+		if err := json.Unmarshal(raw[0], &n); err != nil {
+			return nil, false
+		}
+		blockCount = hexutil.Uint64(n)
+	}
+
+	var tag string
+	if err := json.Unmarshal(raw[1], &tag); err != nil {
+		return nil, false
+	}
+	var newest *uint64
+	switch tag {
+	case "latest", "pending":
+	default:
+		if !strings.HasPrefix(tag, "0x") {
+			return nil, false
+		}
+		n, err := hexutil.DecodeUint64(tag)
+		if err != nil {
+			return nil, false
+		}
+		newest = &n
+	}
+
+	var percentiles []float64
+	if len(raw) == 3 {
+		if err := json.Unmarshal(raw[2], &percentiles); err != nil {
+			return nil, false
+		}
+	}
+
+	return o.FeeHistory(uint64(blockCount), newest, percentiles)
+}
+
+// responseResult responses the JSON-RPC result of request id
+func (f *Filter) responseResult(w http.ResponseWriter, r *http.Request, id json.RawMessage, result interface{}, body string) error {
+	ret, err := json.Marshal(params.JSONSuccessResponse{
+		Version: params.JSONRPCVersion,
+		ID:      id,
+		Result:  result,
+	})
+	if err != nil {
+		params.LogAndResponseJSONError(w, r, f.ErrorLog, params.StatusInternalError, id, body)
+		return params.ErrorInternalError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	params.LogAndResponseOK(w, r, f.ErrorLog, params.StatusOK, append(ret, '\n'), body)
+	return params.ErrorGuard
+}
@@ -0,0 +1,55 @@
+package filter
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+func TestBatchGasPrice(t *testing.T) {
+	config := params.DefaultConfig
+	config.RawURL = "http://127.0.0.1:1" // unreachable, the gas price falls back to MinGasPriceInWEI
+	config.MinGasPriceInWEI = big.NewInt(7)
+	config.MethodWhiteList = map[string]struct{}{"eth_gasPrice": {}, "eth_feeHistory": {}, "eth_blockNumber": {}}
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the gas price is answered by the guard, and the fee history without gas oracle is forwarded
+	body := `[{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice","params":[]},` +
+		`{"jsonrpc":"2.0","id":2,"method":"eth_feeHistory","params":["0x1","latest",[]]},` +
+		`{"jsonrpc":"2.0","id":3,"method":"eth_blockNumber","params":[]}]`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	if _, err := f.HandleJSONRequest(w, r, []byte(body)); err != nil {
+		t.Fatalf("batch err %v: %s", err, w.Body.String())
+	}
+	var forwarded []map[string]json.RawMessage
+	if err := json.Unmarshal(f.Body(), &forwarded); err != nil {
+		t.Fatal(err)
+	}
+	if len(forwarded) != 2 || string(forwarded[0]["id"]) != "2" || string(forwarded[1]["id"]) != "3" {
+		t.Errorf("forwarded %s, want the fee history and block number", f.Body())
+	}
+	responses := f.LocalResponses()
+	if len(responses) != 1 || !strings.Contains(string(responses[0]), `"result":"0x7"`) {
+		t.Errorf("local responses %s, want the min gas price", responses)
+	}
+
+	// the batch answered by the guard in whole
+	f, _ = NewFilter(&config, nil)
+	body = `[{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice","params":[]}]`
+	r = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	if _, err := f.HandleJSONRequest(w, r, []byte(body)); err != params.ErrorGuard {
+		t.Fatalf("batch err %v, want %v", err, params.ErrorGuard)
+	}
+	if !strings.Contains(w.Body.String(), `"result":"0x7"`) {
+		t.Errorf("response %s, want the min gas price", w.Body.String())
+	}
+}
@@ -0,0 +1,202 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/newtonproject/newchain-guard/params"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	fetchLocalTimeout = 5 * time.Second
+	fetchLocalBackoff = 10 * time.Second // the failed fetch is not retried within
+)
+
+// errLocalBackoff is returned if the last fetch of result failed recently
+var errLocalBackoff = errors.New("fetch failed recently")
+
+// localFetch is a fetch of result in flight, shared by the requests of the same key
+type localFetch struct {
+	done   chan struct{}
+	result json.RawMessage
+	err    error
+}
+
+var (
+	localMu       sync.Mutex
+	localResults  = make(map[string]json.RawMessage) // results fetched from the node by rpcurl and method
+	localFetches  = make(map[string]*localFetch)     // fetches in flight by key
+	localFailures = make(map[string]time.Time)       // the last failed fetch by key
+)
+
+// fetchLocalResult calls the method without params on the node at rpcurl, replaced in tests
+var fetchLocalResult = func(ctx context.Context, rpcurl, method string) (json.RawMessage, error) {
+	client, err := rpc.DialContext(ctx, rpcurl)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var result json.RawMessage
+	if err := client.CallContext(ctx, &result, method); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isLocalMethod returns true if the method is answered by the guard
+func (f *Filter) isLocalMethod(method string) bool {
+	_, ok := f.config.LocalMethods[method]
+	return ok
+}
+
+// localResult returns the result of method answered by the guard,
+// and false if the method is not local or the result is not available
+func (f *Filter) localResult(method string) (interface{}, bool) {
+	if !f.isLocalMethod(method) {
+		return nil, false
+	}
+
+	if result, ok := f.config.LocalResults[strings.ToLower(method)]; ok {
+		return result, true
+	}
+
+	switch method {
+	case "rpc_modules":
+		// the modules reachable through the guard
+		modules := make(map[string]string)
+		for m := range f.config.MethodWhiteList {
+			if i := strings.Index(m, serviceMethodSeparator); i > 0 {
+				modules[m[:i]] = "1.0"
+			}
+		}
+		return modules, true
+	case "eth_chainId":
+		// learned at startup, the net_version is fetched as the network ID may differ from the chain ID
+		if f.config.ChainID != nil {
+			return hexutil.EncodeBig(f.config.ChainID), true
+		}
+	}
+
+	result, err := f.fetchLocal(f.config.RawURL+" "+method, method)
+	if err != nil {
+		// forwarded to the node, and fetched again after fetchLocalBackoff
+		return nil, false
+	}
+	return result, true
+}
+
+// fetchLocal returns the result of method of key, fetched from the node once by the requests
+// of the same key, the other keys are not blocked by the fetch
+func (f *Filter) fetchLocal(key, method string) (json.RawMessage, error) {
+	localMu.Lock()
+	if result, ok := localResults[key]; ok {
+		localMu.Unlock()
+		return result, nil
+	}
+	if failed, ok := localFailures[key]; ok && time.Since(failed) < fetchLocalBackoff {
+		localMu.Unlock()
+		return nil, errLocalBackoff
+	}
+	fetch, ok := localFetches[key]
+	if !ok {
+		fetch = &localFetch{done: make(chan struct{})}
+		localFetches[key] = fetch
+	}
+	localMu.Unlock()
+
+	if ok {
+		select {
+		case <-fetch.done:
+			return fetch.result, fetch.err
+		case <-f.ctx.Done():
+			return nil, f.ctx.Err()
+		}
+	}
+
+	// not canceled with the request started it, as shared by the others
+	ctx, cancel := context.WithTimeout(context.Background(), fetchLocalTimeout)
+	defer cancel()
+	fetch.result, fetch.err = fetchLocalResult(ctx, f.config.RawURL, method)
+	if fetch.err != nil {
+		log.Warnf("fetch result of %s error: %v", method, fetch.err)
+	}
+
+	localMu.Lock()
+	if fetch.err == nil {
+		localResults[key] = fetch.result
+		delete(localFailures, key)
+	} else {
+		localFailures[key] = time.Now()
+	}
+	delete(localFetches, key)
+	localMu.Unlock()
+	close(fetch.done)
+
+	return fetch.result, fetch.err
+}
+
+// answerBatch answers the batch message at index by the guard with the response res,
+// the message is not forwarded
+func (f *Filter) answerBatch(index int, res interface{}) {
+	if f.answered == nil {
+		f.answered = make(map[int]bool)
+	}
+	f.answered[index] = true
+	if f.msgs[index].isNotification() {
+		return
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	f.localResponses = append(f.localResponses, b)
+}
+
+// isLocalBatch returns true if all the messages of batch are answered by the guard
+func (f *Filter) isLocalBatch(ins []*jsonrpcMessage) bool {
+	if len(ins) == 0 {
+		return false
+	}
+	for _, in := range ins {
+		if !f.isLocalMethod(in.Method) || in.isNotification() {
+			return false
+		}
+	}
+	return true
+}
+
+// responseLocalBatch responses the batch answered by the guard,
+// and returns false if any result is not available
+func (f *Filter) responseLocalBatch(w http.ResponseWriter, r *http.Request, ins []*jsonrpcMessage, body string) bool {
+	resList := make([]params.JSONSuccessResponse, 0, len(ins))
+	for _, in := range ins {
+		result, ok := f.localResult(in.Method)
+		if !ok {
+			return false
+		}
+		resList = append(resList, params.JSONSuccessResponse{
+			Version: params.JSONRPCVersion,
+			ID:      in.ID,
+			Result:  result,
+		})
+	}
+
+	ret, err := json.Marshal(resList)
+	if err != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	params.LogAndResponseOK(w, r, f.ErrorLog, params.StatusOK, append(ret, '\n'), body)
+	return true
+}
@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+func TestLocalResult(t *testing.T) {
+	var fetched []string
+	fetch := fetchLocalResult
+	fetchLocalResult = func(ctx context.Context, rpcurl, method string) (json.RawMessage, error) {
+		fetched = append(fetched, method)
+		if method == "eth_syncing" {
+			return nil, errors.New("connection refused")
+		}
+		return json.RawMessage(`"1007"`), nil
+	}
+	defer func() { fetchLocalResult = fetch }()
+
+	config := params.DefaultConfig
+	config.RawURL = "http://local-result"
+	config.ChainID = big.NewInt(1007)
+	config.MethodWhiteList = map[string]struct{}{"eth_getBalance": {}, "eth_call": {}, "net_version": {}, "rpc_modules": {}}
+	config.LocalMethods = map[string]struct{}{"net_version": {}, "eth_chainId": {}, "web3_clientVersion": {}, "rpc_modules": {}, "eth_syncing": {}}
+	config.LocalResults = map[string]json.RawMessage{"web3_clientversion": json.RawMessage(`"NewChain/guard"`)}
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		result string
+		ok     bool
+	}{
+		{"net_version", `"1007"`, true},
+		{"web3_clientVersion", `"NewChain/guard"`, true},
+		{"rpc_modules", `{"eth":"1.0","net":"1.0","rpc":"1.0"}`, true},
+		{"eth_chainId", `"0x3ef"`, true},
+		{"net_version", `"1007"`, true},
+		{"eth_syncing", ``, false},
+		{"eth_blockNumber", ``, false},
+	}
+	for i, test := range tests {
+		result, ok := f.localResult(test.method)
+		if ok != test.ok {
+			t.Errorf("%d: %s local %v, want %v", i, test.method, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		b, _ := json.Marshal(result)
+		if string(b) != test.result {
+			t.Errorf("%d: %s result %s, want %s", i, test.method, b, test.result)
+		}
+	}
+	if strings.Join(fetched, ",") != "net_version,eth_syncing" {
+		t.Errorf("fetched %v, want net_version once", fetched)
+	}
+
+	body := `[{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]},{"jsonrpc":"2.0","id":2,"method":"net_version","params":[]}]`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	if _, err := f.HandleJSONRequest(w, r, []byte(body)); err != params.ErrorGuard {
+		t.Fatalf("local batch err %v, want %v", err, params.ErrorGuard)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `[{"jsonrpc":"2.0","id":1,"result":"0x3ef"},{"jsonrpc":"2.0","id":2,"result":"1007"}]` {
+		t.Errorf("local batch response %s", got)
+	}
+
+	// forwarded with the others, even if not in the whitelist
+	body = `[{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]},{"jsonrpc":"2.0","id":2,"method":"eth_getBalance","params":[]}]`
+	r = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	if _, err := f.HandleJSONRequest(w, r, []byte(body)); err != nil {
+		t.Fatalf("mixed batch err %v: %s", err, w.Body.String())
+	}
+}
+
+func TestLocalResultFetch(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	release := make(chan struct{})
+	fetch := fetchLocalResult
+	fetchLocalResult = func(ctx context.Context, rpcurl, method string) (json.RawMessage, error) {
+		mu.Lock()
+		fetched[method]++
+		mu.Unlock()
+		switch method {
+		case "net_version":
+			<-release
+		case "eth_syncing":
+			return nil, errors.New("connection refused")
+		}
+		return json.RawMessage(`"0x3ff8"`), nil
+	}
+	defer func() { fetchLocalResult = fetch }()
+
+	config := params.DefaultConfig
+	config.RawURL = "http://local-fetch"
+	config.LocalMethods = map[string]struct{}{"net_version": {}, "web3_clientVersion": {}, "eth_syncing": {}}
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the requests of the same method share the fetch in flight
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := f.localResult("net_version"); !ok {
+				t.Error("net_version not local")
+			}
+		}()
+	}
+
+	// the other methods are not blocked by the fetch
+	if _, ok := f.localResult("web3_clientVersion"); !ok {
+		t.Error("web3_clientVersion not local")
+	}
+	close(release)
+	wg.Wait()
+
+	// the failed fetch is not retried within the backoff
+	for i := 0; i < 2; i++ {
+		if _, ok := f.localResult("eth_syncing"); ok {
+			t.Error("eth_syncing local after fetch failed")
+		}
+	}
+	if fetched["net_version"] != 1 || fetched["eth_syncing"] != 1 {
+		t.Errorf("fetched %v, want once", fetched)
+	}
+}
@@ -0,0 +1,434 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/breaker"
+	"github.com/newtonproject/newchain-guard/concurrency"
+	"github.com/newtonproject/newchain-guard/gasoracle"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/router"
+	"github.com/newtonproject/newchain-guard/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// logsBackend is the node to get logs from
+type logsBackend interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// dialLogsBackend returns the logs backend of rpcurl, replaced in tests
+var dialLogsBackend = func(rpcurl string) (logsBackend, error) {
+	return dialClient(rpcurl)
+}
+
+// logsHeadTTL is the cache time of the head block number got from the node
+const logsHeadTTL = time.Second
+
+var (
+	logsHeadMu sync.Mutex
+	logsHead   uint64
+	logsHeadAt time.Time
+)
+
+// errCircuitOpen is returned if the circuit of upstream is open
+var errCircuitOpen = errors.New("circuit open")
+
+// logsUpstream returns the upstream of eth_getLogs from block from, routed as the requests forwarded
+func (f *Filter) logsUpstream(from string) string {
+	rt := router.Default()
+	if rt == nil {
+		return f.config.RawURL
+	}
+	args, _ := json.Marshal([]map[string]string{{"fromBlock": from}})
+	return rt.Route("eth_getLogs", args).Next()
+}
+
+// callLogs calls the logs backend of upstream rawURL, guarded by its circuit breaker
+// and concurrency limit as the requests forwarded
+func callLogs(ctx context.Context, rawURL string, call func(logsBackend) error) error {
+	var ticket breaker.Ticket
+	b := breaker.Get(rawURL)
+	if b != nil {
+		var ok bool
+		if ticket, ok = b.Allow(time.Now()); !ok {
+			return errCircuitOpen
+		}
+	}
+	if ls := concurrency.Default(); ls != nil {
+		l := ls.Upstream(rawURL)
+		if err := l.Acquire(ctx, concurrency.PriorityOf(ctx)); err != nil {
+			if b != nil {
+				// not called, return the probe if half-open
+				b.Done(ticket, breaker.Ignored, 0, time.Now())
+			}
+			return err
+		}
+		start := time.Now()
+		defer func() {
+			latency := time.Since(start)
+			if errors.Is(ctx.Err(), context.Canceled) {
+				latency = 0
+			}
+			l.Release(latency, time.Now())
+		}()
+	}
+
+	start := time.Now()
+	backend, err := dialLogsBackend(rawURL)
+	if err == nil {
+		err = call(backend)
+	}
+	if b != nil {
+		outcome := breaker.Success
+		if err != nil {
+			outcome = breaker.Failure
+			if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+				// canceled by client, or by the other chunks failed
+				outcome = breaker.Ignored
+			}
+		}
+		b.Done(ticket, outcome, time.Since(start), time.Now())
+	}
+	return err
+}
+
+// logsStatus returns the status of the error of callLogs
+func logsStatus(err error) int {
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return params.StatusCircuitOpen
+	case errors.Is(err, concurrency.ErrShed):
+		return params.StatusLoadShed
+	default:
+		return params.StatusGetLogsError
+	}
+}
+
+// logsFilter is the filter object of eth_getLogs
+type logsFilter struct {
+	BlockHash *common.Hash      `json:"blockHash"`
+	FromBlock string            `json:"fromBlock"`
+	ToBlock   string            `json:"toBlock"`
+	Addresses interface{}       `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+
+	addresses []common.Address
+	topics    [][]common.Hash
+	from, to  uint64 // resolved block range, valid if ranged
+	ranged    bool
+}
+
+// parseLogsFilter parses the params of eth_getLogs
+func parseLogsFilter(args json.RawMessage) (*logsFilter, bool) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(args, &raw); err != nil || len(raw) != 1 {
+		return nil, false
+	}
+	var q logsFilter
+	if err := json.Unmarshal(raw[0], &q); err != nil {
+		return nil, false
+	}
+
+	for _, tag := range []string{q.FromBlock, q.ToBlock} {
+		switch tag {
+		case "", "earliest", "latest", "pending", "safe", "finalized":
+		default:
+			if _, err := hexutil.DecodeUint64(tag); err != nil {
+				return nil, false
+			}
+		}
+	}
+
+	switch addresses := q.Addresses.(type) {
+	case nil:
+	case string:
+		if !common.IsHexAddress(addresses) {
+			return nil, false
+		}
+		q.addresses = append(q.addresses, common.HexToAddress(addresses))
+	case []interface{}:
+		for _, address := range addresses {
+			s, ok := address.(string)
+			if !ok || !common.IsHexAddress(s) {
+				return nil, false
+			}
+			q.addresses = append(q.addresses, common.HexToAddress(s))
+		}
+	default:
+		return nil, false
+	}
+
+	for _, topic := range q.Topics {
+		var hashes []common.Hash
+		if err := json.Unmarshal(topic, &hashes); err != nil {
+			var hash *common.Hash
+			if err := json.Unmarshal(topic, &hash); err != nil {
+				return nil, false
+			}
+			if hash != nil {
+				hashes = append(hashes, *hash)
+			}
+		}
+		q.topics = append(q.topics, hashes)
+	}
+
+	return &q, true
+}
+
+// topicCount returns the number of topics of filter
+func (q *logsFilter) topicCount() int {
+	count := 0
+	for _, hashes := range q.topics {
+		count += len(hashes)
+	}
+	return count
+}
+
+// resolveRange resolves the block range of filter, the latest block is got by latest only if needed
+func (q *logsFilter) resolveRange(latestBlock func() (uint64, error)) error {
+	if q.BlockHash != nil {
+		return nil
+	}
+
+	var latest *uint64
+	resolve := func(tag string) (uint64, error) {
+		switch tag {
+		case "earliest":
+			return 0, nil
+		case "", "latest", "pending", "safe", "finalized":
+			if latest == nil {
+				n, err := latestBlock()
+				if err != nil {
+					return 0, err
+				}
+				latest = &n
+			}
+			return *latest, nil
+		}
+		return hexutil.DecodeUint64(tag)
+	}
+
+	var err error
+	if q.from, err = resolve(q.FromBlock); err != nil {
+		return err
+	}
+	if q.to, err = resolve(q.ToBlock); err != nil {
+		return err
+	}
+	q.ranged = true
+
+	return nil
+}
+
+// blockRange returns the number of blocks of filter, 0 if not ranged
+func (q *logsFilter) blockRange() uint64 {
+	if !q.ranged || q.from > q.to {
+		return 0
+	}
+	return q.to - q.from + 1
+}
+
+// checkLogs checks the filter of eth_getLogs,
+// and returns the filter to split if the range is too large and split is allowed
+func (f *Filter) checkLogs(args json.RawMessage, split bool) (*logsFilter, int) {
+	q, ok := parseLogsFilter(args)
+	if !ok {
+		// invalid filter is rejected by the node
+		return nil, params.StatusOK
+	}
+
+	if f.config.MaxLogsAddresses > 0 && len(q.addresses) > f.config.MaxLogsAddresses {
+		return nil, params.StatusLogsFilterTooLarge
+	}
+	if f.config.MaxLogsTopics > 0 && q.topicCount() > f.config.MaxLogsTopics {
+		return nil, params.StatusLogsFilterTooLarge
+	}
+
+	if f.config.MaxLogsBlockRange == 0 {
+		return nil, params.StatusOK
+	}
+	if err := q.resolveRange(f.latestBlock); err != nil {
+		return nil, logsStatus(err)
+	}
+	if q.blockRange() <= f.config.MaxLogsBlockRange {
+		return nil, params.StatusOK
+	}
+	if !split || !f.config.SplitLogsRange {
+		return nil, params.StatusLogsRangeTooLarge
+	}
+	chunks := (q.blockRange()-1)/f.config.MaxLogsBlockRange + 1
+	if f.config.MaxLogsChunks > 0 && chunks > uint64(f.config.MaxLogsChunks) {
+		return nil, params.StatusLogsRangeTooLarge
+	}
+
+	return q, params.StatusOK
+}
+
+// latestBlock returns the head block number, from the gas oracle if fresh,
+// or from the node cached for logsHeadTTL
+func (f *Filter) latestBlock() (uint64, error) {
+	if o := gasoracle.Fresh(); o != nil {
+		if head, ok := o.Head(); ok {
+			return head, nil
+		}
+	}
+	logsHeadMu.Lock()
+	head, ok := logsHead, time.Since(logsHeadAt) < logsHeadTTL
+	logsHeadMu.Unlock()
+	if ok {
+		return head, nil
+	}
+
+	err := callLogs(f.ctx, f.logsUpstream("latest"), func(backend logsBackend) (err error) {
+		head, err = backend.BlockNumber(f.ctx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	logsHeadMu.Lock()
+	logsHead, logsHeadAt = head, time.Now()
+	logsHeadMu.Unlock()
+	return head, nil
+}
+
+// splitLogs gets the logs of filter by chunks of MaxLogsBlockRange blocks,
+// and stops once the size of result exceeds MaxLogsResultSize
+func (f *Filter) splitLogs(q *logsFilter) ([]types.Log, int) {
+	ctx, span := tracing.Start(f.ctx, "filter.split_logs",
+		attribute.Int64("logs.from", int64(q.from)),
+		attribute.Int64("logs.to", int64(q.to)))
+	defer span.End()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var chunks []ethereum.FilterQuery
+	for from := q.from; from <= q.to; from += f.config.MaxLogsBlockRange {
+		to := from + f.config.MaxLogsBlockRange - 1
+		if to > q.to || to < from {
+			to = q.to
+		}
+		chunks = append(chunks, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+			Addresses: q.addresses,
+			Topics:    q.topics,
+		})
+		if to == q.to {
+			break
+		}
+	}
+
+	parallel := f.config.SplitLogsParallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		size    int
+		status  = params.StatusOK
+		results = make([][]types.Log, len(chunks))
+		sem     = make(chan struct{}, parallel)
+	)
+	fail := func(s int) {
+		mu.Lock()
+		if status == params.StatusOK {
+			status = s
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	for i := range chunks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// the chunks of old blocks are routed to the archive nodes
+			var logs []types.Log
+			rawURL := f.logsUpstream(hexutil.EncodeBig(chunks[i].FromBlock))
+			err := callLogs(ctx, rawURL, func(backend logsBackend) (err error) {
+				logs, err = backend.FilterLogs(ctx, chunks[i])
+				return err
+			})
+			if err != nil {
+				fail(logsStatus(err))
+				return
+			}
+			if f.config.MaxLogsResultSize > 0 {
+				b, err := json.Marshal(logs)
+				if err != nil {
+					fail(params.StatusInternalError)
+					return
+				}
+				mu.Lock()
+				size += len(b)
+				exceeded := size > f.config.MaxLogsResultSize
+				mu.Unlock()
+				if exceeded {
+					fail(params.StatusLogsResultTooLarge)
+					return
+				}
+			}
+			results[i] = logs
+		}(i)
+	}
+	wg.Wait()
+
+	if status != params.StatusOK {
+		return nil, status
+	}
+
+	logs := make([]types.Log, 0)
+	for _, result := range results {
+		logs = append(logs, result...)
+	}
+	span.SetAttributes(attribute.Int("logs.chunks", len(chunks)), attribute.Int("logs.count", len(logs)))
+
+	return logs, params.StatusOK
+}
+
+// responseLogs checks eth_getLogs, and responses the result if the range is split
+func (f *Filter) responseLogs(w http.ResponseWriter, r *http.Request, id, args json.RawMessage, body string) error {
+	q, status := f.checkLogs(args, true)
+	if status != params.StatusOK {
+		params.LogAndResponseJSONError(w, r, f.ErrorLog, status, id, body)
+		return params.GetStatusError(status)
+	}
+	if q == nil {
+		return nil
+	}
+
+	logs, status := f.splitLogs(q)
+	if status != params.StatusOK {
+		params.LogAndResponseJSONError(w, r, f.ErrorLog, status, id, body)
+		return params.GetStatusError(status)
+	}
+
+	return f.responseResult(w, r, id, logs, body)
+}
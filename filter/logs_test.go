@@ -0,0 +1,272 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/breaker"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/router"
+)
+
+// fakeLogsBackend has one log of each block
+type fakeLogsBackend struct {
+	mu     sync.Mutex
+	latest uint64
+	calls  [][2]uint64
+	heads  int // calls of BlockNumber
+	fail   bool
+}
+
+func (b *fakeLogsBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	b.mu.Lock()
+	b.heads++
+	b.mu.Unlock()
+	return b.latest, nil
+}
+
+func (b *fakeLogsBackend) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	b.mu.Lock()
+	b.calls = append(b.calls, [2]uint64{q.FromBlock.Uint64(), q.ToBlock.Uint64()})
+	b.mu.Unlock()
+	if b.fail {
+		return nil, errors.New("query timeout exceeded")
+	}
+	var logs []types.Log
+	for n := q.FromBlock.Uint64(); n <= q.ToBlock.Uint64(); n++ {
+		logs = append(logs, types.Log{Address: common.HexToAddress("0x2048"), BlockNumber: n, Topics: []common.Hash{}})
+	}
+	return logs, nil
+}
+
+// resetLogsHead clears the head cached by the other tests
+func resetLogsHead() {
+	logsHeadMu.Lock()
+	logsHeadAt = time.Time{}
+	logsHeadMu.Unlock()
+}
+
+func withLogsBackend(t *testing.T, b *fakeLogsBackend) {
+	resetLogsHead()
+	dial := dialLogsBackend
+	dialLogsBackend = func(string) (logsBackend, error) { return b, nil }
+	t.Cleanup(func() { dialLogsBackend = dial })
+}
+
+func TestCheckLogs(t *testing.T) {
+	withLogsBackend(t, &fakeLogsBackend{latest: 1000})
+
+	config := params.DefaultConfig
+	config.MaxLogsBlockRange = 100
+	config.MaxLogsAddresses = 2
+	config.MaxLogsTopics = 2
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic := `"0x0000000000000000000000000000000000000000000000000000000000000001"`
+	tests := []struct {
+		args   string
+		status int
+	}{
+		{`[{"fromBlock":"0x1","toBlock":"0x64"}]`, params.StatusOK},
+		{`[{"fromBlock":"0x1","toBlock":"0x65"}]`, params.StatusLogsRangeTooLarge},
+		{`[{"fromBlock":"0x385"}]`, params.StatusOK},
+		{`[{"fromBlock":"0x383","toBlock":"latest"}]`, params.StatusLogsRangeTooLarge},
+		{`[{"fromBlock":"earliest"}]`, params.StatusLogsRangeTooLarge},
+		{`[{"fromBlock":"0x65","toBlock":"0x1"}]`, params.StatusOK},
+		{`[{"blockHash":"0x0000000000000000000000000000000000000000000000000000000000000001"}]`, params.StatusOK},
+		{`[{"address":"0x0000000000000000000000000000000000002048"}]`, params.StatusOK},
+		{`[{"address":["0x0000000000000000000000000000000000002048","0x0000000000000000000000000000000000002049","0x000000000000000000000000000000000000204a"]}]`, params.StatusLogsFilterTooLarge},
+		{`[{"topics":[` + topic + `,null,[` + topic + `]]}]`, params.StatusOK},
+		{`[{"topics":[[` + topic + `,` + topic + `],` + topic + `]}]`, params.StatusLogsFilterTooLarge},
+		// invalid filter is left to the node
+		{`[{"fromBlock":"0xzz","toBlock":"0xffff"}]`, params.StatusOK},
+	}
+	for i, test := range tests {
+		if _, status := f.checkLogs(json.RawMessage(test.args), false); status != test.status {
+			t.Errorf("%d: status %d, want %d", i, status, test.status)
+		}
+	}
+
+	config.SplitLogsRange = true
+	if q, status := f.checkLogs(json.RawMessage(tests[1].args), true); status != params.StatusOK || q == nil {
+		t.Errorf("split status %d, filter %v", status, q)
+	}
+	// rejected before split into too many chunks
+	config.MaxLogsChunks = 2
+	if q, status := f.checkLogs(json.RawMessage(`[{"fromBlock":"0x1","toBlock":"0xc9"}]`), true); status != params.StatusLogsRangeTooLarge || q != nil {
+		t.Errorf("split status %d of 3 chunks, filter %v", status, q)
+	}
+	if q, status := f.checkLogs(json.RawMessage(tests[1].args), false); status != params.StatusLogsRangeTooLarge || q != nil {
+		t.Errorf("not split status %d, filter %v", status, q)
+	}
+}
+
+func TestSplitLogs(t *testing.T) {
+	for _, parallel := range []int{1, 4} {
+		b := &fakeLogsBackend{latest: 1000}
+		withLogsBackend(t, b)
+
+		config := params.DefaultConfig
+		config.MaxLogsBlockRange = 10
+		config.SplitLogsRange = true
+		config.SplitLogsParallel = parallel
+		f, err := NewFilter(&config, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, status := f.checkLogs(json.RawMessage(`[{"fromBlock":"0x5","toBlock":"0x22"}]`), true)
+		if status != params.StatusOK {
+			t.Fatalf("status %d", status)
+		}
+		logs, status := f.splitLogs(q)
+		if status != params.StatusOK {
+			t.Fatalf("split status %d", status)
+		}
+		if len(b.calls) != 3 {
+			t.Errorf("parallel %d: chunks %v, want 3", parallel, b.calls)
+		}
+		if len(logs) != 30 {
+			t.Fatalf("parallel %d: logs %d, want 30", parallel, len(logs))
+		}
+		for i, log := range logs {
+			if log.BlockNumber != uint64(i+5) {
+				t.Fatalf("parallel %d: log %d of block %d", parallel, i, log.BlockNumber)
+			}
+		}
+
+		// stop once the result is too large
+		b.calls = nil
+		one, _ := json.Marshal(logs[:10])
+		config.MaxLogsResultSize = len(one) + 1
+		if _, status := f.splitLogs(q); status != params.StatusLogsResultTooLarge {
+			t.Errorf("parallel %d: status %d, want %d", parallel, status, params.StatusLogsResultTooLarge)
+		}
+		if parallel == 1 && len(b.calls) != 2 {
+			t.Errorf("chunks %v requested after result too large", b.calls)
+		}
+
+		b.fail = true
+		config.MaxLogsResultSize = 0
+		if _, status := f.splitLogs(q); status != params.StatusGetLogsError {
+			t.Errorf("parallel %d: status %d, want %d", parallel, status, params.StatusGetLogsError)
+		}
+	}
+}
+
+func TestSplitLogsRouted(t *testing.T) {
+	b := &fakeLogsBackend{latest: 1000}
+	var mu sync.Mutex
+	upstreams := make(map[string]int)
+	dial := dialLogsBackend
+	dialLogsBackend = func(rawURL string) (logsBackend, error) {
+		mu.Lock()
+		upstreams[rawURL]++
+		mu.Unlock()
+		return b, nil
+	}
+	t.Cleanup(func() { dialLogsBackend = dial })
+	resetLogsHead()
+
+	rt, err := router.New(map[string][]string{
+		router.DefaultPool: {"http://latest"},
+		"archive":          {"http://archive"},
+	}, []router.Rule{{Method: "eth_getLogs", Block: router.BlockArchive, Pool: "archive"}}, 100, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.Enable(rt)
+	t.Cleanup(func() { router.Enable(nil) })
+
+	config := params.DefaultConfig
+	config.MaxLogsBlockRange = 500
+	config.SplitLogsRange = true
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the latest block and the recent chunk from the default pool, the old chunk from the archive pool
+	q, status := f.checkLogs(json.RawMessage(`[{"fromBlock":"0x1f4"}]`), true)
+	if status != params.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if _, status := f.splitLogs(q); status != params.StatusOK {
+		t.Fatalf("split status %d", status)
+	}
+	if upstreams["http://latest"] != 2 || upstreams["http://archive"] != 1 {
+		t.Errorf("upstreams %v", upstreams)
+	}
+
+	// failed fast if the circuit of upstream is open
+	breaker.Enable(breaker.NewBreakers(breaker.Config{MinRequests: 1, ErrorRate: 1}))
+	t.Cleanup(func() { breaker.Enable(nil) })
+	archive := breaker.Get("http://archive")
+	ticket, _ := archive.Allow(time.Now())
+	archive.Done(ticket, breaker.Failure, 0, time.Now())
+	if _, status := f.splitLogs(q); status != params.StatusCircuitOpen {
+		t.Errorf("status %d, want %d", status, params.StatusCircuitOpen)
+	}
+}
+
+func TestLatestBlock(t *testing.T) {
+	b := &fakeLogsBackend{latest: 1000}
+	withLogsBackend(t, b)
+
+	config := params.DefaultConfig
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if head, err := f.latestBlock(); err != nil || head != 1000 {
+			t.Fatalf("head %d %v, want 1000", head, err)
+		}
+	}
+	if b.heads != 1 {
+		t.Errorf("head got from the node %d times, want cached", b.heads)
+	}
+}
+
+func TestResponseLogs(t *testing.T) {
+	withLogsBackend(t, &fakeLogsBackend{latest: 1000})
+
+	config := params.DefaultConfig
+	config.MaxLogsBlockRange = 10
+	config.SplitLogsRange = true
+	config.SplitLogsParallel = 2
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"jsonrpc":"2.0","id":7,"method":"eth_getLogs","params":[{"fromBlock":"0x1","toBlock":"0x14"}]}`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	if err := f.responseLogs(w, r, json.RawMessage("7"), json.RawMessage(`[{"fromBlock":"0x1","toBlock":"0x14"}]`), body); err != params.ErrorGuard {
+		t.Fatalf("err %v, want %v", err, params.ErrorGuard)
+	}
+
+	var res struct {
+		ID     int         `json:"id"`
+		Result []types.Log `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != 7 || len(res.Result) != 20 {
+		t.Errorf("response %s", w.Body.String())
+	}
+}
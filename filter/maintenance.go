@@ -0,0 +1,16 @@
+package filter
+
+import (
+	"time"
+
+	"github.com/newtonproject/newchain-guard/maintenance"
+)
+
+// readOnlyMessage returns the error message if the method is rejected in read-only mode
+func (f *Filter) readOnlyMessage(method string) (string, bool) {
+	m := maintenance.Default()
+	if m == nil || !m.Blocked(method, time.Now()) {
+		return "", false
+	}
+	return m.Message(), true
+}
@@ -0,0 +1,59 @@
+package filter
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/newtonproject/newchain-guard/maintenance"
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+func TestReadOnly(t *testing.T) {
+	m, err := maintenance.New(nil, "under maintenance", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maintenance.Enable(m)
+	defer maintenance.Enable(nil)
+
+	config := params.DefaultConfig
+	config.MethodWhiteList = map[string]struct{}{"eth_sendRawTransaction": {}, "eth_getBalance": {}}
+	send := func(body string) (*httptest.ResponseRecorder, error) {
+		f, err := NewFilter(&config, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		_, err = f.HandleJSONRequest(w, httptest.NewRequest("POST", "/", strings.NewReader(body)), []byte(body))
+		return w, err
+	}
+
+	tx := `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x00"]}`
+	if w, _ := send(tx); strings.Contains(w.Body.String(), `"code":465`) {
+		t.Fatal("rejected as read-only before switched")
+	}
+
+	m.SetReadOnly(true, "test")
+	w, err := send(tx)
+	if err != params.ErrorGuard {
+		t.Fatalf("read-only err %v, want %v", err, params.ErrorGuard)
+	}
+	var res params.JSONErrResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Error.Code != params.StatusReadOnly || res.Error.Message != "under maintenance - 465" {
+		t.Errorf("read-only response %s", w.Body.String())
+	}
+
+	if _, err := send(`{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":[]}`); err != nil {
+		t.Errorf("read method err %v in read-only", err)
+	}
+
+	w, err = send(`[` + tx + `,{"jsonrpc":"2.0","id":2,"method":"eth_getBalance","params":[]}]`)
+	if err != params.ErrorGuard || !strings.Contains(w.Body.String(), `"code":465`) {
+		t.Errorf("read-only batch err %v: %s", err, w.Body.String())
+	}
+}
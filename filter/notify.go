@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/audit"
+	"github.com/newtonproject/newchain-guard/journal"
+	"github.com/newtonproject/newchain-guard/notify"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/tracker"
+)
+
+// notifyTx accepts the transaction passed the guard with status in JSON-RPC request id,
+// held until the upstream responded if the request is WithPending
+func (f *Filter) notifyTx(r *http.Request, id json.RawMessage, tx *types.Transaction, raw string, status int) {
+	if p := pendingOf(r); p != nil {
+		p.add(&pendingTx{f: f, id: id, tx: tx, raw: raw, status: status})
+		return
+	}
+	f.acceptTx(r, id, tx, raw, status, true)
+}
+
+// acceptTx publishes and audits the transaction accepted, and tracks and journals it
+// if succeeded in upstream and the tracker and journal enabled
+func (f *Filter) acceptTx(r *http.Request, id json.RawMessage, tx *types.Transaction, raw string, status int, succeeded bool) {
+	if succeeded && (tracker.Enabled() || journal.Enabled()) {
+		if from, status := f.sender(tx); status == params.StatusOK {
+			tracker.Track(tx.Hash(), from, tx.To())
+			journal.Add(tx, from)
+		}
+	}
+	if !f.config.EnableNotify && !audit.Enabled() {
+		return
+	}
+	msg := f.newTxMessage(r, tx, raw, notify.DecisionAccepted, status)
+	audit.Add(r, id, newAuditRecord(r, msg), true)
+	if f.config.EnableNotify {
+		notify.AddTx(msg)
+	}
+}
+
+// notifyRejectedTx publishes and audits the transaction rejected by the guard with status,
+// tx is nil if the transaction can not be decoded
+func (f *Filter) notifyRejectedTx(r *http.Request, tx *types.Transaction, raw string, status int) {
+	if !f.config.EnableNotify && !audit.Enabled() {
+		return
+	}
+	msg := f.newTxMessage(r, tx, raw, notify.DecisionRejected, status)
+	audit.Add(r, nil, newAuditRecord(r, msg), false)
+	if f.config.EnableNotify {
+		notify.AddRejectedTx(msg)
+	}
+}
+
+// newAuditRecord returns the audit record of the transaction message
+func newAuditRecord(r *http.Request, msg *notify.Message) *audit.Record {
+	rec := &audit.Record{
+		Time:      time.Unix(msg.Time, 0),
+		RequestID: params.GetRequestID(r),
+		ClientIP:  msg.ClientIP,
+		APIKey:    msg.APIKey,
+		TxHash:    msg.Hash,
+		From:      msg.From,
+		To:        msg.To,
+		Nonce:     msg.Nonce,
+		Decision:  msg.Decision,
+		Status:    msg.Status,
+	}
+	if msg.Status != params.StatusOK {
+		rec.Reason = params.GetStatusText(msg.Status)
+	}
+	return rec
+}
+
+// newTxMessage returns the notification message of tx with the guard decision
+func (f *Filter) newTxMessage(r *http.Request, tx *types.Transaction, raw, decision string, status int) *notify.Message {
+	msg := &notify.Message{
+		Raw:      raw,
+		ClientIP: params.GetRemoteIP(r),
+		APIKey:   params.GetAPIKey(r),
+		Decision: decision,
+		Status:   status,
+		Time:     time.Now().Unix(),
+	}
+	if status != params.StatusOK {
+		msg.Notes = append(msg.Notes, params.GetStatusText(status))
+	}
+	if tx == nil {
+		return msg
+	}
+
+	msg.Hash = tx.Hash().Hex()
+	if from, status := f.sender(tx); status == params.StatusOK {
+		msg.From = from.Hex()
+	}
+	if tx.To() != nil {
+		msg.To = tx.To().Hex()
+	}
+	msg.Value = tx.Value().String()
+	msg.Nonce = tx.Nonce()
+	msg.Gas = tx.Gas()
+	msg.Type = tx.Type()
+	if tx.Type() == types.DynamicFeeTxType {
+		msg.GasTipCap = tx.GasTipCap().String()
+		msg.GasFeeCap = tx.GasFeeCap().String()
+	} else {
+		msg.GasPrice = tx.GasPrice().String()
+	}
+
+	return msg
+}
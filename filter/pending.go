@@ -0,0 +1,146 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// pendingTx is the transaction accepted by the guard and waiting for the upstream response
+type pendingTx struct {
+	f      *Filter
+	id     json.RawMessage
+	tx     *types.Transaction
+	raw    string
+	status int
+}
+
+// pendingTxs is the accepted transactions of a request
+type pendingTxs struct {
+	mu  sync.Mutex
+	txs []*pendingTx
+}
+
+type contextKey struct{}
+
+// WithPending returns the request to hold the accepted transactions until Finish or Abort,
+// so that only those accepted by the upstream too are journaled and tracked
+func WithPending(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, &pendingTxs{}))
+}
+
+func pendingOf(r *http.Request) *pendingTxs {
+	if r == nil {
+		return nil
+	}
+	p, _ := r.Context().Value(contextKey{}).(*pendingTxs)
+	return p
+}
+
+// Pending returns whether the request holds accepted transactions
+func Pending(r *http.Request) bool {
+	p := pendingOf(r)
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.txs) > 0
+}
+
+func (p *pendingTxs) add(tx *pendingTx) {
+	p.mu.Lock()
+	p.txs = append(p.txs, tx)
+	p.mu.Unlock()
+}
+
+// take removes and returns the transactions of the JSON-RPC request ids, or all if ids is nil
+func (p *pendingTxs) take(ids map[string]bool) []*pendingTx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var taken, kept []*pendingTx
+	for _, ptx := range p.txs {
+		if ids == nil || ids[string(ptx.id)] {
+			taken = append(taken, ptx)
+		} else {
+			kept = append(kept, ptx)
+		}
+	}
+	p.txs = kept
+	return taken
+}
+
+// upstreamResponse is the JSON-RPC response of upstream
+type upstreamResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func (res *upstreamResponse) succeeded() bool {
+	return len(res.Error) == 0 && len(res.Result) > 0 && string(res.Result) != "null"
+}
+
+// Finish notifies the held transactions of request with the response body, and journals and tracks
+// those succeeded, the transaction without response such as upstream error is not journaled
+func Finish(r *http.Request, body []byte) {
+	p := pendingOf(r)
+	if p == nil {
+		return
+	}
+	txs := p.take(nil)
+	if len(txs) == 0 {
+		return
+	}
+
+	var responses []upstreamResponse
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		json.Unmarshal(trimmed, &responses)
+	} else {
+		var res upstreamResponse
+		if err := json.Unmarshal(trimmed, &res); err == nil {
+			// the response of a single request
+			res.ID = txs[0].id
+			responses = []upstreamResponse{res}
+		}
+	}
+	succeeded := make(map[string]bool, len(responses))
+	for i := range responses {
+		if responses[i].succeeded() {
+			succeeded[string(responses[i].ID)] = true
+		}
+	}
+	for _, ptx := range txs {
+		ptx.f.acceptTx(r, ptx.id, ptx.tx, ptx.raw, ptx.status, succeeded[string(ptx.id)])
+	}
+}
+
+// Abort notifies the held transactions in the request body as rejected with status, and uncounts them
+// in the velocity limits, as they are not forwarded
+func Abort(r *http.Request, body []byte, status int) {
+	p := pendingOf(r)
+	if p == nil {
+		return
+	}
+
+	var ids map[string]bool
+	var msgs []struct {
+		ID json.RawMessage `json:"id"`
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' && json.Unmarshal(trimmed, &msgs) == nil {
+		ids = make(map[string]bool, len(msgs))
+		for _, msg := range msgs {
+			ids[string(msg.ID)] = true
+		}
+	}
+	for _, ptx := range p.take(ids) {
+		ptx.f.releaseVelocity(ptx.tx)
+		ptx.f.notifyRejectedTx(r, ptx.tx, ptx.raw, status)
+	}
+}
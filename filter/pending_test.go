@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/tracker"
+	"github.com/newtonproject/newchain-guard/velocity"
+)
+
+func TestPendingTxs(t *testing.T) {
+	l, err := velocity.Open("", []velocity.Limit{{Window: time.Hour, MaxCount: 3}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	velocity.Enable(l)
+	defer velocity.Enable(nil)
+	tr, err := tracker.New(nil, time.Hour, time.Hour, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.Enable(tr)
+	defer tracker.Enable(nil)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := params.DefaultConfig
+	config.MethodWhiteList = map[string]struct{}{"eth_sendRawTransaction": {}}
+	to := common.HexToAddress("0x2048")
+	hashes := make([]common.Hash, 3)
+	msgs := make([]string, 3)
+	for i := range msgs {
+		tx := types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, Nonce: uint64(i), To: &to, Gas: 21000,
+			GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)})
+		tx = signTx(t, tx, NewSigner(config.ChainID), key, true)
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[i] = tx.Hash()
+		msgs[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_sendRawTransaction","params":["0x%x"]}`, i, raw)
+	}
+	body := "[" + strings.Join(msgs, ",") + "]"
+
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := WithPending(httptest.NewRequest("POST", "/", strings.NewReader(body)))
+	if _, err := f.HandleJSONRequest(httptest.NewRecorder(), r, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if !Pending(r) {
+		t.Fatal("not pending")
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	if _, ok := l.Allow(from, common.HexToHash("0x01"), big.NewInt(0), time.Now()); ok {
+		t.Fatal("velocity count not reached")
+	}
+
+	// the one not forwarded is uncounted
+	Abort(r, []byte("["+msgs[2]+"]"), params.StatusLoadShed)
+	if _, ok := l.Allow(from, common.HexToHash("0x01"), big.NewInt(0), time.Now()); !ok {
+		t.Error("velocity count not released after abort")
+	}
+
+	// only the one succeeded in upstream is tracked
+	Finish(r, []byte(`[{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"nonce too low"}},{"jsonrpc":"2.0","id":0,"result":"0x01"}]`))
+	for i, want := range []bool{true, false, false} {
+		if _, ok := tr.Get(hashes[i]); ok != want {
+			t.Errorf("tx %d tracked %v, want %v", i, ok, want)
+		}
+	}
+	if Pending(r) {
+		t.Error("pending after finish")
+	}
+}
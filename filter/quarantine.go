@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/quarantine"
+	log "github.com/sirupsen/logrus"
+)
+
+// matchQuarantine returns the rule name if the transaction should be held in quarantine
+func (f *Filter) matchQuarantine(tx *types.Transaction) (string, bool) {
+	q := quarantine.Default()
+	if q == nil {
+		return "", false
+	}
+	from, status := f.sender(tx)
+	if status != params.StatusOK {
+		return "", false
+	}
+	return q.Match(tx, from)
+}
+
+// holdTx holds the transaction in quarantine for reason
+func (f *Filter) holdTx(r *http.Request, tx *types.Transaction, reason string) int {
+	from, status := f.sender(tx)
+	if status != params.StatusOK {
+		return status
+	}
+	if _, err := quarantine.Default().Hold(r, tx, from, reason); err != nil {
+		log.Errorf("Quarantine hold %s error: %v", tx.Hash().Hex(), err)
+		return params.StatusQuarantineError
+	}
+	return params.StatusOK
+}
+
+// holdBatchTx holds the transaction of batch message at index, and answers the message by the guard
+func (f *Filter) holdBatchTx(r *http.Request, index int, tx *types.Transaction, reason string) {
+	in := f.msgs[index]
+	var res interface{}
+	if status := f.holdTx(r, tx, reason); status != params.StatusOK {
+		res = params.JSONErrResponse{
+			Version: params.JSONRPCVersion,
+			ID:      in.ID,
+			Error: params.JSONError{
+				Code:    status,
+				Message: fmt.Sprintf("%s - %d", params.ErrorInternalError.Error(), status),
+			},
+		}
+	} else {
+		res = params.JSONSuccessResponse{
+			Version: params.JSONRPCVersion,
+			ID:      in.ID,
+			Result:  tx.Hash(),
+		}
+	}
+
+	f.answerBatch(index, res)
+}
+
+// LocalResponses returns the responses of the batch messages answered by the guard,
+// which are not forwarded and should be appended to the responses of the node
+func (f *Filter) LocalResponses() []json.RawMessage {
+	return f.localResponses
+}
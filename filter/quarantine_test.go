@@ -0,0 +1,100 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/quarantine"
+)
+
+type quarantineBackend struct{}
+
+func (quarantineBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return nil
+}
+
+func TestHoldTransaction(t *testing.T) {
+	q, err := quarantine.Open("", quarantineBackend{}, []quarantine.Rule{{Name: "value", MinValue: big.NewInt(10)}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	quarantine.Enable(q)
+	defer quarantine.Enable(nil)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := params.DefaultConfig
+	config.MethodWhiteList = map[string]struct{}{"eth_sendRawTransaction": {}, "eth_getBalance": {}}
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0x2048")
+	newRawTx := func(nonce uint64, value int64) (string, common.Hash) {
+		tx := types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, Nonce: nonce, To: &to, Gas: 21000,
+			GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Value: big.NewInt(value)})
+		tx = signTx(t, tx, NewSigner(config.ChainID), key, true)
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hexutil.Encode(raw), tx.Hash()
+	}
+
+	raw, hash := newRawTx(0, 100)
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["%s"]}`, raw)
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	if _, err := f.HandleJSONRequest(w, r, []byte(body)); err != params.ErrorGuard {
+		t.Fatalf("held err %v, want %v", err, params.ErrorGuard)
+	}
+	var res struct {
+		Result common.Hash `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Result != hash {
+		t.Errorf("held response %s, want the hash %s", w.Body.String(), hash.Hex())
+	}
+	if _, err := q.Get(hash); err != nil {
+		t.Errorf("get held error %v", err)
+	}
+
+	// the held transaction is answered by the guard, and the others are forwarded
+	f, _ = NewFilter(&config, nil)
+	held, heldHash := newRawTx(1, 100)
+	passed, _ := newRawTx(2, 1)
+	body = fmt.Sprintf(`[{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["%s"]},`+
+		`{"jsonrpc":"2.0","id":2,"method":"eth_sendRawTransaction","params":["%s"]}]`, held, passed)
+	r = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	if _, err := f.HandleJSONRequest(w, r, []byte(body)); err != nil {
+		t.Fatalf("batch err %v: %s", err, w.Body.String())
+	}
+	var forwarded []map[string]json.RawMessage
+	if err := json.Unmarshal(f.Body(), &forwarded); err != nil {
+		t.Fatal(err)
+	}
+	if len(forwarded) != 1 || string(forwarded[0]["id"]) != "2" {
+		t.Errorf("forwarded %s, want the passed only", f.Body())
+	}
+	responses := f.LocalResponses()
+	if len(responses) != 1 || !strings.Contains(string(responses[0]), heldHash.Hex()) {
+		t.Errorf("local responses %s, want the held hash", responses)
+	}
+	if n := q.Len(); n != 2 {
+		t.Errorf("quarantine len %d, want 2", n)
+	}
+}
@@ -25,7 +25,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/crypto/sha3"
 )
@@ -37,6 +36,7 @@ var (
 	ErrInvalidSignatureLen = errors.New("invalid signature length")
 	ErrInvalidRecoveryID   = errors.New("invalid signature recovery id")
 	ErrInvalidKey          = errors.New("invalid private key")
+	ErrSecp256r1HalfN      = errors.New("signature s is larger than secp256r1HalfN")
 )
 
 var (
@@ -44,36 +44,84 @@ var (
 	secp256r1halfN = new(big.Int).Div(secp256r1N, big.NewInt(2))
 )
 
-// EIP155Transaction implements Signer using the EIP155 rules.
-type EIP155Signer struct {
+var (
+	big8  = big.NewInt(8)
+	big27 = big.NewInt(27)
+)
+
+// NewChainSigner implements types.Signer for legacy (EIP155), access list (EIP2930)
+// and dynamic fee (EIP1559) transactions signed on the secp256r1 curve.
+type NewChainSigner struct {
 	chainId, chainIdMul *big.Int
 }
 
-func NewEIP155Signer(chainId *big.Int) EIP155Signer {
+var _ types.Signer = NewChainSigner{}
+
+// NewSigner returns a signer that accepts all supported transaction types on chainId
+func NewSigner(chainId *big.Int) NewChainSigner {
 	if chainId == nil {
 		chainId = new(big.Int)
 	}
-	return EIP155Signer{
+	return NewChainSigner{
 		chainId:    chainId,
 		chainIdMul: new(big.Int).Mul(chainId, big.NewInt(2)),
 	}
 }
 
-var big8 = big.NewInt(8)
+func (s NewChainSigner) ChainID() *big.Int {
+	return s.chainId
+}
+
+func (s NewChainSigner) Equal(s2 types.Signer) bool {
+	x, ok := s2.(NewChainSigner)
+	return ok && x.chainId.Cmp(s.chainId) == 0
+}
 
-func (s EIP155Signer) Sender(tx *types.Transaction) (common.Address, error) {
-	if !tx.Protected() {
-		return common.Address{}, ErrNotEIP155
+func (s NewChainSigner) Sender(tx *types.Transaction) (common.Address, error) {
+	V, R, S := tx.RawSignatureValues()
+	switch tx.Type() {
+	case types.LegacyTxType:
+		if !tx.Protected() {
+			return common.Address{}, ErrNotEIP155
+		}
+		V = new(big.Int).Sub(V, s.chainIdMul)
+		V.Sub(V, big8)
+	case types.AccessListTxType, types.DynamicFeeTxType:
+		// ACL and DynamicFee txs are defined to use 0 and 1 as their recovery
+		// id, add 27 to become equivalent to unprotected Homestead signatures.
+		V = new(big.Int).Add(V, big27)
+	default:
+		return common.Address{}, types.ErrTxTypeNotSupported
 	}
 	if tx.ChainId().Cmp(s.chainId) != 0 {
 		return common.Address{}, ErrInvalidChainId
 	}
-	V, R, S := tx.RawSignatureValues()
-	V = new(big.Int).Sub(V, s.chainIdMul)
-	V.Sub(V, big8)
 	return recoverPlain(s.Hash(tx), R, S, V, true)
 }
 
+// SignatureValues returns signature values. This signature
+// needs to be in the [R || S || V] format where V is 0 or 1.
+func (s NewChainSigner) SignatureValues(tx *types.Transaction, sig []byte) (R, S, V *big.Int, err error) {
+	if len(sig) != 65 {
+		return nil, nil, nil, ErrInvalidSignatureLen
+	}
+	R = new(big.Int).SetBytes(sig[:32])
+	S = new(big.Int).SetBytes(sig[32:64])
+	switch tx.Type() {
+	case types.LegacyTxType:
+		V = big.NewInt(int64(sig[64]) + 35)
+		V.Add(V, s.chainIdMul)
+	case types.AccessListTxType, types.DynamicFeeTxType:
+		if tx.ChainId().Sign() != 0 && tx.ChainId().Cmp(s.chainId) != 0 {
+			return nil, nil, nil, ErrInvalidChainId
+		}
+		V = big.NewInt(int64(sig[64]))
+	default:
+		return nil, nil, nil, types.ErrTxTypeNotSupported
+	}
+	return R, S, V, nil
+}
+
 func rlpHash(x interface{}) (h common.Hash) {
 	hw := sha3.NewLegacyKeccak256()
 	rlp.Encode(hw, x)
@@ -81,9 +129,47 @@ func rlpHash(x interface{}) (h common.Hash) {
 	return h
 }
 
+// prefixedRlpHash writes the prefix into the hasher before rlp-encoding x.
+func prefixedRlpHash(prefix byte, x interface{}) (h common.Hash) {
+	hw := sha3.NewLegacyKeccak256()
+	hw.Write([]byte{prefix})
+	rlp.Encode(hw, x)
+	hw.Sum(h[:0])
+	return h
+}
+
 // Hash returns the hash to be signed by the sender.
 // It does not uniquely identify the transaction.
-func (s EIP155Signer) Hash(tx *types.Transaction) common.Hash {
+func (s NewChainSigner) Hash(tx *types.Transaction) common.Hash {
+	switch tx.Type() {
+	case types.AccessListTxType:
+		return prefixedRlpHash(
+			tx.Type(),
+			[]interface{}{
+				s.chainId,
+				tx.Nonce(),
+				tx.GasPrice(),
+				tx.Gas(),
+				tx.To(),
+				tx.Value(),
+				tx.Data(),
+				tx.AccessList(),
+			})
+	case types.DynamicFeeTxType:
+		return prefixedRlpHash(
+			tx.Type(),
+			[]interface{}{
+				s.chainId,
+				tx.Nonce(),
+				tx.GasTipCap(),
+				tx.GasFeeCap(),
+				tx.Gas(),
+				tx.To(),
+				tx.Value(),
+				tx.Data(),
+				tx.AccessList(),
+			})
+	}
 	return rlpHash([]interface{}{
 		tx.Nonce(),
 		tx.GasPrice(),
@@ -124,6 +210,9 @@ func recoverPlain(sighash common.Hash, R, S, Vb *big.Int, homestead bool) (commo
 		return common.Address{}, types.ErrInvalidSig
 	}
 	V := byte(Vb.Uint64() - 27)
+	if homestead && S.Cmp(secp256r1halfN) > 0 {
+		return common.Address{}, ErrSecp256r1HalfN
+	}
 	if !ValidateSignatureValues(V, R, S, homestead) {
 		return common.Address{}, types.ErrInvalidSig
 	}
@@ -154,14 +243,11 @@ func Ecrecover(hash, sig []byte) ([]byte, error) {
 	if err := checkSignature(sig); err != nil {
 		return nil, err
 	}
-	recId := int64(sig[len(sig)-1])
-	pubKey, err := ecRecovery2(hash, sig[:len(sig)-1], recId)
-	if pubKey == nil {
+	pubKey, err := recoverPubkey(hash, sig[:64], sig[64])
+	if err != nil {
 		return nil, err
 	}
-	bk := elliptic.Marshal(crypto.S256(), pubKey.X, pubKey.Y)
-	return bk, nil
-
+	return elliptic.Marshal(pubKey.Curve, pubKey.X, pubKey.Y), nil
 }
 
 func checkSignature(sig []byte) error {
@@ -174,113 +260,48 @@ func checkSignature(sig []byte) error {
 	return nil
 }
 
-// DecompressPubkey parses a public key in the 33-byte compressed format.
-func decompressPubkey2(x *big.Int, yBit byte) (*ecdsa.PublicKey, error) {
-	if (yBit != 0x02) && (yBit != 0x03) {
-		return nil, fmt.Errorf("invalid yBit")
-	}
-	if x == nil {
-		return nil, fmt.Errorf("invalid x")
-	}
-
-	xx := new(big.Int).Mul(x, x)
-	xxa := new(big.Int).Sub(xx, big.NewInt(3))
-	yy := new(big.Int).Mul(xxa, x)
-	yy.Add(yy, elliptic.P256().Params().B)
-	yy.Mod(yy, elliptic.P256().Params().P)
-
-	y1 := new(big.Int).ModSqrt(yy, elliptic.P256().Params().P)
-	if y1 == nil {
-		return nil, fmt.Errorf("can not revcovery public key")
-	}
-
-	getY2 := func(y1 *big.Int) *big.Int {
-		y2 := new(big.Int).Neg(y1)
-		y2.Mod(y2, elliptic.P256().Params().P)
-		return y2
-	}
-
-	y := new(big.Int)
-
-	if yBit == 0x02 {
-		if y1.Bit(0) == 0 {
-			y = y1
-		} else {
-			y = getY2(y1)
-		}
-	} else {
-		if y1.Bit(0) == 1 {
-			y = y1
-		} else {
-			y = getY2(y1)
-		}
-	}
-
-	return &ecdsa.PublicKey{X: x, Y: y, Curve: elliptic.P256()}, nil
-}
-func ecRecovery2(messageHash []byte, sig []byte, recId int64) (*ecdsa.PublicKey, error) {
-	if recId < 0 || recId > 3 {
-		return nil, fmt.Errorf("invalid value of v")
-	}
-
-	sigLen := len(sig)
-	r := new(big.Int).SetBytes(sig[:(sigLen / 2)])
-	s := new(big.Int).SetBytes(sig[(sigLen / 2):])
-	if r.Cmp(secp256r1N) > 0 {
-		return nil, fmt.Errorf("r can not big then n")
-	}
-	if s.Cmp(secp256r1N) > 0 {
-		return nil, fmt.Errorf("s can not big then half of n")
-	}
-
+// recoverPubkey recovers the public key Q = r^-1 * (s*R - e*G) from the [R || S]
+// signature. The point arithmetic is done by the P-256 implementation of
+// crypto/elliptic, which is constant-time.
+func recoverPubkey(hash, sig []byte, recId byte) (*ecdsa.PublicKey, error) {
 	p256 := elliptic.P256()
 	n := p256.Params().N
-	i := new(big.Int).SetInt64(recId / 2)
-	x := new(big.Int).Add(r, i.Mul(i, n))
 
-	prime := p256.Params().P
-	if x.Cmp(prime) > 0 {
-		return nil, fmt.Errorf("x can not big then q")
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	if r.Sign() <= 0 || r.Cmp(n) >= 0 || s.Sign() <= 0 || s.Cmp(n) >= 0 {
+		return nil, types.ErrInvalidSig
 	}
-	yBit := byte(0x02)
-	if recId%2 == 0 {
-		yBit = 0x02
-	} else {
-		yBit = 0x03
+
+	// R is the point of x = r + (recId / 2) * n and y of parity recId % 2
+	x := new(big.Int).Set(r)
+	if recId >= 2 {
+		x.Add(x, n)
 	}
-	R, err := decompressPubkey2(x, yBit)
-	if err != nil {
-		return nil, err
+	if x.Cmp(p256.Params().P) >= 0 {
+		return nil, fmt.Errorf("x can not big then p")
 	}
-
-	r1, r2 := p256.ScalarMult(R.X, R.Y, n.Bytes())
-	zero := new(big.Int)
-	if !((r1.Cmp(zero) == 0) && (r2.Cmp(zero) == 0)) {
-		return nil, fmt.Errorf("nR != point at infinity")
+	compressed := make([]byte, 33)
+	compressed[0] = 0x02 | recId&1
+	x.FillBytes(compressed[1:])
+	rx, ry := elliptic.UnmarshalCompressed(p256, compressed)
+	if rx == nil {
+		return nil, fmt.Errorf("can not revcovery public key")
 	}
 
-	e := new(big.Int).SetBytes(messageHash)
-	eInv := new(big.Int).SetInt64(0)
-	eInv.Sub(eInv, e)
-	eInv.Mod(eInv, n)
-
-	rInv := new(big.Int).Set(r)
-	rInv.ModInverse(rInv, n)
-
-	srInv := new(big.Int).Set(rInv)
-	srInv.Mul(srInv, s)
-	srInv.Mod(srInv, n)
-
-	eInvrInv := new(big.Int).Mul(rInv, eInv)
-	eInvrInv.Mod(eInvrInv, n)
-
-	krx, kry := p256.ScalarMult(R.X, R.Y, srInv.Bytes())
-	kgx, kgy := p256.ScalarBaseMult(eInvrInv.Bytes())
-	kx, ky := p256.Add(krx, kry, kgx, kgy)
-	if (kx.Cmp(zero) == 0) && (ky.Cmp(zero) == 0) {
+	rInv := new(big.Int).ModInverse(r, n)
+	e := new(big.Int).SetBytes(hash)
+	u1 := new(big.Int).Mul(e, rInv)
+	u1.Neg(u1).Mod(u1, n)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, n)
+
+	x1, y1 := p256.ScalarBaseMult(u1.FillBytes(make([]byte, 32)))
+	x2, y2 := p256.ScalarMult(rx, ry, u2.FillBytes(make([]byte, 32)))
+	qx, qy := p256.Add(x1, y1, x2, y2)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
 		return nil, fmt.Errorf("public key can not be zero")
 	}
-	rkey := ecdsa.PublicKey{Curve: p256, X: kx, Y: ky}
-	return &rkey, nil
 
+	return &ecdsa.PublicKey{Curve: p256, X: qx, Y: qy}, nil
 }
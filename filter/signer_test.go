@@ -0,0 +1,141 @@
+package filter
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// signTx signs tx on secp256r1 with the recovery id found by Ecrecover
+func signTx(t *testing.T, tx *types.Transaction, signer NewChainSigner, key *ecdsa.PrivateKey, lowS bool) *types.Transaction {
+	hash := signer.Hash(tx)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (s.Cmp(secp256r1halfN) > 0) == lowS {
+		s = new(big.Int).Sub(secp256r1N, s)
+	}
+	sig := make([]byte, 65)
+	copy(sig[32-len(r.Bytes()):32], r.Bytes())
+	copy(sig[64-len(s.Bytes()):64], s.Bytes())
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	for recID := byte(0); recID < 2; recID++ {
+		sig[64] = recID
+		pub, err := Ecrecover(hash[:], sig)
+		if err != nil || common.BytesToAddress(Keccak256(pub[1:])[12:]) != from {
+			continue
+		}
+		signed, err := tx.WithSignature(signer, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	t.Fatal("can not find recovery id")
+	return nil
+}
+
+func TestNewChainSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(16888)
+	signer := NewSigner(chainID)
+	to := common.HexToAddress("0x1024")
+
+	txs := []*types.Transaction{
+		types.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1), nil),
+		types.NewTx(&types.AccessListTx{ChainID: chainID, To: &to, Gas: 21000, GasPrice: big.NewInt(1),
+			AccessList: types.AccessList{{Address: to, StorageKeys: []common.Hash{{}}}}}),
+		types.NewTx(&types.DynamicFeeTx{ChainID: chainID, To: &to, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)}),
+	}
+	for _, tx := range txs {
+		signed := signTx(t, tx, signer, key, true)
+		sender, err := signer.Sender(signed)
+		if err != nil {
+			t.Fatalf("type %d: %v", tx.Type(), err)
+		}
+		if sender != from {
+			t.Errorf("type %d: sender %x, want %x", tx.Type(), sender, from)
+		}
+
+		signed = signTx(t, tx, signer, key, false)
+		if _, err := signer.Sender(signed); err != ErrSecp256r1HalfN {
+			t.Errorf("type %d: high s error %v, want %v", tx.Type(), err, ErrSecp256r1HalfN)
+		}
+	}
+
+	if _, err := NewSigner(big.NewInt(1)).Sender(signTx(t, txs[2], signer, key, true)); err != ErrInvalidChainId {
+		t.Errorf("chain id error %v, want %v", err, ErrInvalidChainId)
+	}
+}
+
+func TestSenderCache(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := params.DefaultConfig
+	f, err := NewFilter(&config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0x1024")
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, To: &to, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)})
+	tx = signTx(t, tx, NewSigner(config.ChainID), key, true)
+
+	from, status := f.sender(tx)
+	if status != params.StatusOK || from != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("sender %x status %d", from, status)
+	}
+	if cached, ok := senderCache.Get(tx.Hash()); !ok || cached.(common.Address) != from {
+		t.Errorf("sender cache %v, want %x", cached, from)
+	}
+
+	// the same transaction decoded in another request is not recovered again
+	recovered := 0
+	recover := recoverSender
+	recoverSender = func(signer types.Signer, tx *types.Transaction) (common.Address, error) {
+		recovered++
+		return recover(signer, tx)
+	}
+	defer func() { recoverSender = recover }()
+
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(types.Transaction)
+	if err := decoded.UnmarshalBinary(raw); err != nil {
+		t.Fatal(err)
+	}
+	if cached, status := f.sender(decoded); status != params.StatusOK || cached != from {
+		t.Errorf("cached sender %x status %d, want %x", cached, status, from)
+	}
+	if recovered != 0 {
+		t.Errorf("recovered %d times, want served from the cache", recovered)
+	}
+}
+
+func BenchmarkRecoverSender(b *testing.B) {
+	key, _ := crypto.GenerateKey()
+	chainID := big.NewInt(16888)
+	signer := NewSigner(chainID)
+	tx, _ := types.SignTx(types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Gas: 21000}), signer, key)
+	V, R, S := tx.RawSignatureValues()
+	hash := signer.Hash(tx)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recoverPlain(hash, R, S, new(big.Int).Add(V, big27), false)
+	}
+}
@@ -0,0 +1,50 @@
+package filter
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/velocity"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkVelocity counts the transaction passed the other checks in the velocity limits of its sender
+func (f *Filter) checkVelocity(tx *types.Transaction) int {
+	l := velocity.Default()
+	if l == nil {
+		return params.StatusOK
+	}
+	from, status := f.sender(tx)
+	if status != params.StatusOK {
+		return status
+	}
+	if limit, ok := l.Allow(from, tx.Hash(), tx.Value(), time.Now()); !ok {
+		log.Warnf("Velocity limit %v exceeded by %s with %s", limit, from.Hex(), tx.Hash().Hex())
+		return params.StatusVelocityLimitExceeded
+	}
+	return params.StatusOK
+}
+
+// releaseVelocity uncounts the transaction not forwarded, such as in the batch rejected
+func (f *Filter) releaseVelocity(tx *types.Transaction) {
+	l := velocity.Default()
+	if l == nil {
+		return
+	}
+	if from, status := f.sender(tx); status == params.StatusOK {
+		l.Release(from, tx.Hash())
+	}
+}
+
+// checkTransactionVelocity checks the transaction, and counts it in the velocity limits if passed
+func (f *Filter) checkTransactionVelocity(tx *types.Transaction) int {
+	status := f.checkTransaction(tx)
+	if status != params.StatusOK && status != params.StatusValueTooLarge {
+		return status
+	}
+	if velocityStatus := f.checkVelocity(tx); velocityStatus != params.StatusOK {
+		return velocityStatus
+	}
+	return status
+}
@@ -0,0 +1,74 @@
+package filter
+
+import (
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/velocity"
+)
+
+func TestCheckVelocity(t *testing.T) {
+	l, err := velocity.Open("", []velocity.Limit{{Window: time.Hour, MaxValue: big.NewInt(100)}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	velocity.Enable(l)
+	defer velocity.Enable(nil)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := params.DefaultConfig
+	config.MethodWhiteList = map[string]struct{}{"eth_sendRawTransaction": {}}
+	to := common.HexToAddress("0x2048")
+	newRawTx := func(nonce uint64, value int64) string {
+		tx := types.NewTx(&types.DynamicFeeTx{ChainID: config.ChainID, Nonce: nonce, To: &to, Gas: 21000,
+			GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Value: big.NewInt(value)})
+		raw, err := signTx(t, tx, NewSigner(config.ChainID), key, true).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hexutil.Encode(raw)
+	}
+	send := func(raws ...string) error {
+		msgs := make([]string, len(raws))
+		for i, raw := range raws {
+			msgs[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_sendRawTransaction","params":["%s"]}`, i, raw)
+		}
+		body := msgs[0]
+		if len(msgs) > 1 {
+			body = "[" + strings.Join(msgs, ",") + "]"
+		}
+		f, err := NewFilter(&config, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.HandleJSONRequest(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), []byte(body))
+		return err
+	}
+
+	if err := send(newRawTx(0, 60)); err != nil {
+		t.Fatalf("send within the limit error %v", err)
+	}
+	// the batch is rejected, and the passed one is not counted
+	if err := send(newRawTx(1, 30), newRawTx(2, 30)); err != params.ErrorGuard {
+		t.Fatalf("send batch above the limit error %v, want %v", err, params.ErrorGuard)
+	}
+	if err := send(newRawTx(1, 40)); err != nil {
+		t.Errorf("send within the limit after the batch rejected error %v", err)
+	}
+	if err := send(newRawTx(2, 1)); err == nil {
+		t.Error("sent above the limit")
+	}
+}
@@ -2,6 +2,7 @@ package filter
 
 import (
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/newtonproject/newchain-guard/tracing"
 	db "github.com/upper/db/v4"
 )
 
@@ -33,6 +34,9 @@ type Account struct {
 }
 
 func (f *Filter) isWhitelistTx(from, to common.Address) bool {
+	_, span := tracing.Start(f.ctx, "filter.whitelist_db")
+	defer span.End()
+
 	sdb, err := OpenDatabase(f.config.WhitelistDBAdapterName, f.config.WhitelistDBSettings)
 	if err != nil {
 		return false
@@ -0,0 +1,424 @@
+package gasoracle
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	ethparams "github.com/ethereum/go-ethereum/params"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	DefaultBlocks        = 20
+	DefaultPercentile    = 60
+	DefaultHistoryBlocks = 128
+	DefaultPollInterval  = 3 * time.Second
+	DefaultMaxAge        = time.Minute
+)
+
+const rpcTimeout = 5 * time.Second
+
+// Backend is the upstream node to read blocks from
+type Backend interface {
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+}
+
+// Config is the config of Oracle, the nil clamps are not applied
+type Config struct {
+	Blocks        int // number of recent blocks to suggest from
+	Percentile    int // percentile of the transaction prices in the blocks
+	HistoryBlocks int // number of recent blocks kept for eth_feeHistory
+	PollInterval  time.Duration
+	MaxAge        time.Duration // the suggestions are stale if not polled in MaxAge, Default 1m
+
+	MinGasPrice  *big.Int
+	MaxGasPrice  *big.Int
+	MinGasTipCap *big.Int
+	MaxGasTipCap *big.Int
+}
+
+// blockFees is the fee summary of a block
+type blockFees struct {
+	number       uint64
+	hash         common.Hash
+	parentHash   common.Hash
+	baseFee      *big.Int // nil before London
+	gasUsedRatio float64
+	gasUsed      uint64
+	gasLimit     uint64
+	prices       []*big.Int // sorted effective gas prices of the transactions
+	tips         []*big.Int // sorted effective tips of the transactions
+}
+
+// Oracle polls new blocks, and suggests the gas price and tip cap from the
+// percentile of transaction prices in recent blocks
+type Oracle struct {
+	backend Backend
+	config  Config
+
+	mu       sync.RWMutex
+	blocks   []*blockFees // ascending by number, at most HistoryBlocks
+	gasPrice *big.Int
+	tipCap   *big.Int
+	polledAt time.Time // the last successful poll
+
+	quit chan struct{}
+}
+
+// New returns the oracle, the zero config values are set to default
+func New(backend Backend, config Config) (*Oracle, error) {
+	if config.Blocks <= 0 {
+		config.Blocks = DefaultBlocks
+	}
+	if config.Percentile <= 0 {
+		config.Percentile = DefaultPercentile
+	}
+	if config.Percentile > 100 {
+		return nil, errors.New("gas oracle percentile larger than 100")
+	}
+	if config.HistoryBlocks < config.Blocks {
+		config.HistoryBlocks = DefaultHistoryBlocks
+		if config.HistoryBlocks < config.Blocks {
+			config.HistoryBlocks = config.Blocks
+		}
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+
+	o := &Oracle{
+		backend: backend,
+		config:  config,
+		quit:    make(chan struct{}),
+	}
+	o.gasPrice = o.clamp(new(big.Int), config.MinGasPrice, config.MaxGasPrice)
+	o.tipCap = o.clamp(new(big.Int), config.MinGasTipCap, config.MaxGasTipCap)
+	return o, nil
+}
+
+// Run polls the new blocks every poll interval until Stop
+func (o *Oracle) Run() {
+	o.update()
+	ticker := time.NewTicker(o.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			o.update()
+		case <-o.quit:
+			return
+		}
+	}
+}
+
+// Stop stops Run
+func (o *Oracle) Stop() {
+	close(o.quit)
+}
+
+// update reads the blocks after the last one read up to the latest, and updates the suggestions
+func (o *Oracle) update() {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	latest, err := o.backend.BlockByNumber(ctx, nil)
+	cancel()
+	if err != nil {
+		log.Warnln("Gas oracle get latest block error:", err)
+		return
+	}
+
+	head := latest.NumberU64()
+	o.mu.RLock()
+	next := uint64(0)
+	if n := len(o.blocks); n > 0 {
+		next = o.blocks[n-1].number + 1
+	}
+	unchanged := false
+	if next > head {
+		// no new block, unless the latest is reorged at the same height or lower
+		b := o.block(head)
+		unchanged = b == nil || b.hash == latest.Hash()
+		next = head
+	}
+	o.mu.RUnlock()
+	if unchanged {
+		o.mu.Lock()
+		o.polledAt = time.Now()
+		o.mu.Unlock()
+		return
+	}
+	if history := uint64(o.config.HistoryBlocks); head+1-next > history {
+		next = head + 1 - history
+	}
+
+	fees := make([]*blockFees, 0, head+1-next)
+	for number := next; number < head; number++ {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		block, err := o.backend.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+		cancel()
+		if err != nil {
+			log.Warnf("Gas oracle get block %d error: %v", number, err)
+			return
+		}
+		fees = append(fees, newBlockFees(block))
+	}
+	fees = append(fees, newBlockFees(latest))
+	// keep the blocks after the last reorg while reading
+	for i := len(fees) - 1; i > 0; i-- {
+		if fees[i].parentHash != fees[i-1].hash {
+			fees = fees[i:]
+			break
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.polledAt = time.Now()
+	// replace the blocks reorged at the same height or higher
+	for n := len(o.blocks); n > 0 && o.blocks[n-1].number >= fees[0].number; n-- {
+		o.blocks = o.blocks[:n-1]
+	}
+	if n := len(o.blocks); n > 0 && (o.blocks[n-1].number+1 != fees[0].number || o.blocks[n-1].hash != fees[0].parentHash) {
+		// reorg or gap, restart the history
+		o.blocks = nil
+	}
+	o.blocks = append(o.blocks, fees...)
+	if n := len(o.blocks); n > o.config.HistoryBlocks {
+		o.blocks = append([]*blockFees(nil), o.blocks[n-o.config.HistoryBlocks:]...)
+	}
+	o.suggest()
+}
+
+// block returns the block of number in memory, or nil
+func (o *Oracle) block(number uint64) *blockFees {
+	if len(o.blocks) == 0 || number < o.blocks[0].number || number > o.blocks[len(o.blocks)-1].number {
+		return nil
+	}
+	return o.blocks[number-o.blocks[0].number]
+}
+
+// Head returns the number of the latest block polled, false if none
+func (o *Oracle) Head() (uint64, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if len(o.blocks) == 0 {
+		return 0, false
+	}
+	return o.blocks[len(o.blocks)-1].number, true
+}
+
+// Stale returns whether the suggestions are not polled in MaxAge, such as the node is unreachable,
+// the requests should be forwarded to the node instead
+func (o *Oracle) Stale() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return time.Since(o.polledAt) > o.config.MaxAge
+}
+
+func newBlockFees(block *types.Block) *blockFees {
+	fees := &blockFees{
+		number:     block.NumberU64(),
+		hash:       block.Hash(),
+		parentHash: block.ParentHash(),
+		baseFee:    block.BaseFee(),
+		gasUsed:    block.GasUsed(),
+		gasLimit:   block.GasLimit(),
+	}
+	if block.GasLimit() > 0 {
+		fees.gasUsedRatio = float64(block.GasUsed()) / float64(block.GasLimit())
+	}
+	for _, tx := range block.Transactions() {
+		price := tx.GasPrice()
+		tip := tx.GasTipCap()
+		if fees.baseFee != nil {
+			tip, _ = tx.EffectiveGasTip(fees.baseFee)
+			if tip == nil || tip.Sign() < 0 {
+				tip = new(big.Int)
+			}
+			price = new(big.Int).Add(fees.baseFee, tip)
+		}
+		fees.prices = append(fees.prices, price)
+		fees.tips = append(fees.tips, tip)
+	}
+	sortBigs(fees.prices)
+	sortBigs(fees.tips)
+	return fees
+}
+
+func sortBigs(s []*big.Int) {
+	sort.Slice(s, func(i, j int) bool { return s[i].Cmp(s[j]) < 0 })
+}
+
+// percentile returns the p-th percentile of the sorted values
+func percentile(sorted []*big.Int, p float64) *big.Int {
+	if len(sorted) == 0 {
+		return new(big.Int)
+	}
+	i := int(float64(len(sorted)-1) * p / 100)
+	return new(big.Int).Set(sorted[i])
+}
+
+// suggest updates the suggestions from the recent Blocks, keeps the last
+// suggestions if there is no transaction
+func (o *Oracle) suggest() {
+	var prices, tips []*big.Int
+	start := len(o.blocks) - o.config.Blocks
+	if start < 0 {
+		start = 0
+	}
+	for _, b := range o.blocks[start:] {
+		prices = append(prices, b.prices...)
+		tips = append(tips, b.tips...)
+	}
+	if len(prices) == 0 {
+		return
+	}
+	sortBigs(prices)
+	sortBigs(tips)
+	p := float64(o.config.Percentile)
+	o.gasPrice = o.clamp(percentile(prices, p), o.config.MinGasPrice, o.config.MaxGasPrice)
+	o.tipCap = o.clamp(percentile(tips, p), o.config.MinGasTipCap, o.config.MaxGasTipCap)
+}
+
+func (o *Oracle) clamp(v, min, max *big.Int) *big.Int {
+	if min != nil && v.Cmp(min) < 0 {
+		v.Set(min)
+	}
+	if max != nil && v.Cmp(max) > 0 {
+		v.Set(max)
+	}
+	return v
+}
+
+// GasPrice returns the suggested gas price
+func (o *Oracle) GasPrice() *big.Int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return new(big.Int).Set(o.gasPrice)
+}
+
+// GasTipCap returns the suggested max priority fee per gas
+func (o *Oracle) GasTipCap() *big.Int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return new(big.Int).Set(o.tipCap)
+}
+
+// FeeHistory is the result of eth_feeHistory
+type FeeHistory struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas,omitempty"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+// FeeHistory returns the fee history of blockCount blocks up to newest, nil newest for the latest,
+// and false if the blocks are not all in memory
+func (o *Oracle) FeeHistory(blockCount uint64, newest *uint64, rewardPercentiles []float64) (*FeeHistory, bool) {
+	for i, p := range rewardPercentiles {
+		if p < 0 || p > 100 || (i > 0 && p < rewardPercentiles[i-1]) {
+			return nil, false
+		}
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if len(o.blocks) == 0 || blockCount == 0 {
+		return nil, false
+	}
+	first, last := o.blocks[0].number, o.blocks[len(o.blocks)-1].number
+	end := last
+	if newest != nil {
+		end = *newest
+	}
+	if end > last || end < first {
+		return nil, false
+	}
+	if blockCount > end-first+1 {
+		// the node returns the blocks available, but older blocks may be available there
+		return nil, false
+	}
+	start := end + 1 - blockCount
+
+	history := &FeeHistory{OldestBlock: (*hexutil.Big)(new(big.Int).SetUint64(start))}
+	london := true
+	for _, b := range o.blocks[start-first : end-first+1] {
+		history.GasUsedRatio = append(history.GasUsedRatio, b.gasUsedRatio)
+		if b.baseFee == nil {
+			london = false
+		} else {
+			history.BaseFee = append(history.BaseFee, (*hexutil.Big)(b.baseFee))
+		}
+		if len(rewardPercentiles) > 0 {
+			rewards := make([]*hexutil.Big, len(rewardPercentiles))
+			for i, p := range rewardPercentiles {
+				rewards[i] = (*hexutil.Big)(percentile(b.tips, p))
+			}
+			history.Reward = append(history.Reward, rewards)
+		}
+	}
+	if london {
+		history.BaseFee = append(history.BaseFee, (*hexutil.Big)(nextBaseFee(o.blocks[end-first])))
+	} else {
+		history.BaseFee = nil
+	}
+
+	return history, true
+}
+
+// nextBaseFee returns the base fee of the block after b by EIP-1559
+func nextBaseFee(b *blockFees) *big.Int {
+	target := b.gasLimit / ethparams.ElasticityMultiplier
+	if target == 0 || b.gasUsed == target {
+		return new(big.Int).Set(b.baseFee)
+	}
+	denominator := new(big.Int).SetUint64(ethparams.BaseFeeChangeDenominator)
+	if b.gasUsed > target {
+		delta := new(big.Int).SetUint64(b.gasUsed - target)
+		delta.Mul(delta, b.baseFee)
+		delta.Div(delta, new(big.Int).SetUint64(target))
+		delta.Div(delta, denominator)
+		if delta.Sign() == 0 {
+			delta.SetUint64(1)
+		}
+		return delta.Add(delta, b.baseFee)
+	}
+	delta := new(big.Int).SetUint64(target - b.gasUsed)
+	delta.Mul(delta, b.baseFee)
+	delta.Div(delta, new(big.Int).SetUint64(target))
+	delta.Div(delta, denominator)
+	next := new(big.Int).Sub(b.baseFee, delta)
+	if next.Sign() < 0 {
+		next.SetUint64(0)
+	}
+	return next
+}
+
+var std *Oracle
+
+// Enable sets the oracle answering the gas price requests
+func Enable(o *Oracle) {
+	std = o
+}
+
+// Default returns the oracle enabled, or nil
+func Default() *Oracle {
+	return std
+}
+
+// Fresh returns the oracle enabled and not stale, or nil
+func Fresh() *Oracle {
+	if std == nil || std.Stale() {
+		return nil
+	}
+	return std
+}
@@ -0,0 +1,176 @@
+package gasoracle
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type fakeBackend struct {
+	mu     sync.Mutex
+	blocks []*types.Block
+}
+
+func (b *fakeBackend) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if number == nil {
+		return b.blocks[len(b.blocks)-1], nil
+	}
+	if n := number.Uint64(); n < uint64(len(b.blocks)) {
+		return b.blocks[n], nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (b *fakeBackend) add(baseFee int64, gasUsed uint64, tips ...int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.push(baseFee, gasUsed, tips...)
+}
+
+// reorg replaces the latest block
+func (b *fakeBackend) reorg(baseFee int64, gasUsed uint64, tips ...int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blocks = b.blocks[:len(b.blocks)-1]
+	b.push(baseFee, gasUsed, tips...)
+}
+
+func (b *fakeBackend) push(baseFee int64, gasUsed uint64, tips ...int64) {
+	to := common.HexToAddress("0x1024")
+	var txs []*types.Transaction
+	for i, tip := range tips {
+		txs = append(txs, types.NewTx(&types.DynamicFeeTx{
+			Nonce:     uint64(i),
+			To:        &to,
+			Gas:       21000,
+			GasTipCap: big.NewInt(tip),
+			GasFeeCap: big.NewInt(baseFee + tip),
+		}))
+	}
+	header := &types.Header{
+		Number:   big.NewInt(int64(len(b.blocks))),
+		GasLimit: 1000000,
+		GasUsed:  gasUsed,
+		BaseFee:  big.NewInt(baseFee),
+	}
+	if n := len(b.blocks); n > 0 {
+		header.ParentHash = b.blocks[n-1].Hash()
+	}
+	b.blocks = append(b.blocks, types.NewBlockWithHeader(header).WithBody(txs, nil))
+}
+
+func TestOracle(t *testing.T) {
+	backend := &fakeBackend{}
+	backend.add(100, 500000)
+	backend.add(100, 1000000, 1, 2, 3, 4, 5)
+	backend.add(112, 0, 6, 7, 8, 9, 10)
+
+	o, err := New(backend, Config{Blocks: 2, Percentile: 50, MinGasTipCap: big.NewInt(2), MaxGasPrice: big.NewInt(104)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := o.GasTipCap(); got.Int64() != 2 {
+		t.Errorf("initial tip cap %s, want the min 2", got)
+	}
+	if _, ok := o.Head(); ok {
+		t.Error("head before polled")
+	}
+
+	o.update()
+	if head, ok := o.Head(); !ok || head != 2 {
+		t.Errorf("head %d %v, want 2", head, ok)
+	}
+	// tips 1..10, the 50th percentile is 5, gas prices are 101..105 and 118..122
+	if got := o.GasTipCap(); got.Int64() != 5 {
+		t.Errorf("tip cap %s, want 5", got)
+	}
+	if got := o.GasPrice(); got.Int64() != 104 {
+		t.Errorf("gas price %s, want the max 104", got)
+	}
+
+	history, ok := o.FeeHistory(2, nil, []float64{0, 100})
+	if !ok {
+		t.Fatal("fee history not answered")
+	}
+	if history.OldestBlock.ToInt().Int64() != 1 || len(history.GasUsedRatio) != 2 || history.GasUsedRatio[0] != 1 {
+		t.Errorf("fee history %+v", history)
+	}
+	if len(history.BaseFee) != 3 || history.BaseFee[1].ToInt().Int64() != 112 || history.BaseFee[2].ToInt().Int64() != 98 {
+		t.Errorf("base fees %v, want [100 112 98]", history.BaseFee)
+	}
+	if r := history.Reward[1]; r[0].ToInt().Int64() != 6 || r[1].ToInt().Int64() != 10 {
+		t.Errorf("rewards %v, want [6 10]", r)
+	}
+
+	if _, ok := o.FeeHistory(4, nil, nil); ok {
+		t.Error("fee history of blocks not in memory, want not answered")
+	}
+	newest := uint64(1)
+	if history, ok := o.FeeHistory(1, &newest, nil); !ok || history.BaseFee[1].ToInt().Int64() != 112 {
+		t.Errorf("fee history of block 1 %+v", history)
+	}
+
+	// the window slides to tips 6..10
+	backend.add(98, 0)
+	o.update()
+	if got := o.GasTipCap(); got.Int64() != 8 {
+		t.Errorf("tip cap %s, want 8", got)
+	}
+	// the window without transactions keeps the suggestion
+	backend.add(86, 0)
+	o.update()
+	if got := o.GasTipCap(); got.Int64() != 8 {
+		t.Errorf("tip cap %s, want 8", got)
+	}
+}
+
+func TestOracleReorg(t *testing.T) {
+	backend := &fakeBackend{}
+	backend.add(100, 0, 1, 2, 3)
+	backend.add(100, 0, 4, 5, 6)
+	o, err := New(backend, Config{Blocks: 1, Percentile: 50, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.Stale() {
+		t.Error("fresh before polled")
+	}
+	o.update()
+	if got := o.GasTipCap(); got.Int64() != 5 {
+		t.Errorf("tip cap %s, want 5", got)
+	}
+	if o.Stale() {
+		t.Error("stale after polled")
+	}
+
+	// the latest block replaced at the same height
+	backend.reorg(100, 1, 7, 8, 9)
+	o.update()
+	if got := o.GasTipCap(); got.Int64() != 8 {
+		t.Errorf("tip cap %s after reorg, want 8", got)
+	}
+	// the next block of the new chain is appended
+	backend.add(100, 0, 10, 11, 12)
+	o.update()
+	if got := o.GasTipCap(); got.Int64() != 11 {
+		t.Errorf("tip cap %s, want 11", got)
+	}
+	if history, ok := o.FeeHistory(3, nil, nil); !ok || history.OldestBlock.ToInt().Int64() != 0 {
+		t.Errorf("fee history after reorg %+v", history)
+	}
+
+	o.mu.Lock()
+	o.polledAt = time.Now().Add(-2 * time.Hour)
+	o.mu.Unlock()
+	if !o.Stale() {
+		t.Error("not stale after MaxAge")
+	}
+}
@@ -0,0 +1,284 @@
+package journal
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/maintenance"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	txPrefix    = []byte("t") // txPrefix + hash -> time(8) | from(20) | nonce(8) | raw tx
+	noncePrefix = []byte("n") // noncePrefix + from + nonce -> hash
+)
+
+var (
+	DefaultRebroadcastInterval = time.Minute
+	DefaultMaxAge              = time.Hour
+)
+
+const rpcTimeout = 5 * time.Second
+
+// Backend is an upstream node to rebroadcast transactions to
+type Backend interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// entry is a journaled transaction
+type entry struct {
+	time  time.Time
+	from  common.Address
+	nonce uint64
+	tx    *types.Transaction
+}
+
+// Journal keeps the accepted transactions in LevelDB, and rebroadcasts them
+// to upstreams until they are mined, superseded by nonce or older than MaxAge
+type Journal struct {
+	db        *leveldb.DB
+	upstreams []Backend // the first one is also used to get the nonce
+
+	interval time.Duration
+	maxAge   time.Duration
+
+	mu   sync.Mutex
+	quit chan struct{}
+}
+
+// Open opens the journal at path, or an in-memory journal if path is empty
+func Open(path string, upstreams []Backend, interval, maxAge time.Duration) (*Journal, error) {
+	if len(upstreams) == 0 {
+		return nil, errors.New("journal upstreams not set")
+	}
+	if interval <= 0 {
+		interval = DefaultRebroadcastInterval
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+
+	var (
+		db  *leveldb.DB
+		err error
+	)
+	if path == "" {
+		db, err = leveldb.Open(storage.NewMemStorage(), nil)
+	} else {
+		db, err = leveldb.OpenFile(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		db:        db,
+		upstreams: upstreams,
+		interval:  interval,
+		maxAge:    maxAge,
+		quit:      make(chan struct{}),
+	}, nil
+}
+
+func nonceKey(from common.Address, nonce uint64) []byte {
+	key := make([]byte, len(noncePrefix)+common.AddressLength+8)
+	copy(key, noncePrefix)
+	copy(key[len(noncePrefix):], from.Bytes())
+	binary.BigEndian.PutUint64(key[len(noncePrefix)+common.AddressLength:], nonce)
+	return key
+}
+
+func txKey(hash common.Hash) []byte {
+	return append(append([]byte{}, txPrefix...), hash.Bytes()...)
+}
+
+// Add journals the transaction sent from, the journaled transaction of the same from and nonce is replaced
+func (j *Journal) Add(tx *types.Transaction, from common.Address) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	value := make([]byte, 8+common.AddressLength+8+len(raw))
+	binary.BigEndian.PutUint64(value, uint64(time.Now().UnixNano()))
+	copy(value[8:], from.Bytes())
+	binary.BigEndian.PutUint64(value[8+common.AddressLength:], tx.Nonce())
+	copy(value[8+common.AddressLength+8:], raw)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	batch := new(leveldb.Batch)
+	nk := nonceKey(from, tx.Nonce())
+	if old, err := j.db.Get(nk, nil); err == nil {
+		batch.Delete(append(append([]byte{}, txPrefix...), old...))
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+	batch.Put(nk, tx.Hash().Bytes())
+	batch.Put(txKey(tx.Hash()), value)
+	return j.db.Write(batch, nil)
+}
+
+// Len returns the number of journaled transactions
+func (j *Journal) Len() int {
+	n := 0
+	iter := j.db.NewIterator(util.BytesPrefix(txPrefix), nil)
+	for iter.Next() {
+		n++
+	}
+	iter.Release()
+	return n
+}
+
+func (j *Journal) entries() ([]*entry, error) {
+	var entries []*entry
+	iter := j.db.NewIterator(util.BytesPrefix(txPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		value := iter.Value()
+		if len(value) < 8+common.AddressLength+8 {
+			continue
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(value[8+common.AddressLength+8:]); err != nil {
+			log.Warnf("Journal decode transaction %x error: %v", iter.Key()[len(txPrefix):], err)
+			continue
+		}
+		entries = append(entries, &entry{
+			time:  time.Unix(0, int64(binary.BigEndian.Uint64(value))),
+			from:  common.BytesToAddress(value[8 : 8+common.AddressLength]),
+			nonce: binary.BigEndian.Uint64(value[8+common.AddressLength:]),
+			tx:    tx,
+		})
+	}
+	return entries, iter.Error()
+}
+
+func (j *Journal) remove(e *entry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	batch := new(leveldb.Batch)
+	batch.Delete(txKey(e.tx.Hash()))
+	nk := nonceKey(e.from, e.nonce)
+	if hash, err := j.db.Get(nk, nil); err == nil && common.BytesToHash(hash) == e.tx.Hash() {
+		batch.Delete(nk)
+	}
+	if err := j.db.Write(batch, nil); err != nil {
+		log.Errorf("Journal remove %s error: %v", e.tx.Hash().Hex(), err)
+	}
+}
+
+// Run rebroadcasts the journaled transactions every interval until Close
+func (j *Journal) Run() {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			j.rebroadcast()
+		case <-j.quit:
+			return
+		}
+	}
+}
+
+// rebroadcast removes the transactions older than maxAge or with nonce lower than
+// the confirmed nonce of sender, and sends the others to all upstreams,
+// nothing is done while the transactions are blocked for maintenance
+func (j *Journal) rebroadcast() {
+	if m := maintenance.Default(); m != nil && m.Blocked("eth_sendRawTransaction", time.Now()) {
+		log.Infoln("Journal rebroadcast paused for maintenance")
+		return
+	}
+
+	entries, err := j.entries()
+	if err != nil {
+		log.Errorln("Journal read error:", err)
+		return
+	}
+
+	nonces := make(map[common.Address]uint64)
+	sent := 0
+	for _, e := range entries {
+		if time.Since(e.time) > j.maxAge {
+			j.remove(e)
+			continue
+		}
+
+		nonce, ok := nonces[e.from]
+		if !ok {
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			nonce, err = j.upstreams[0].NonceAt(ctx, e.from, nil)
+			cancel()
+			if err != nil {
+				log.Warnf("Journal get nonce of %s error: %v", e.from.Hex(), err)
+				continue
+			}
+			nonces[e.from] = nonce
+		}
+		if e.nonce < nonce {
+			// mined, or superseded by another transaction of the nonce
+			j.remove(e)
+			continue
+		}
+
+		for _, upstream := range j.upstreams {
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			err := upstream.SendTransaction(ctx, e.tx)
+			cancel()
+			if err != nil && !isKnownError(err) {
+				log.Warnf("Journal rebroadcast %s error: %v", e.tx.Hash().Hex(), err)
+			}
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Infof("Journal rebroadcast %d transactions", sent)
+	}
+}
+
+// isKnownError returns whether the error means the upstream has the transaction already
+func isKnownError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+// Close stops Run and closes the journal
+func (j *Journal) Close() error {
+	close(j.quit)
+	return j.db.Close()
+}
+
+var std *Journal
+
+// Enable sets the journal of Add
+func Enable(j *Journal) {
+	std = j
+}
+
+// Enabled returns whether the journal enabled
+func Enabled() bool {
+	return std != nil
+}
+
+// Add journals the transaction if the journal enabled
+func Add(tx *types.Transaction, from common.Address) {
+	if std == nil {
+		return
+	}
+	if err := std.Add(tx, from); err != nil {
+		log.Errorf("Journal add %s error: %v", tx.Hash().Hex(), err)
+	}
+}
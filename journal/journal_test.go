@@ -0,0 +1,97 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/maintenance"
+)
+
+type fakeBackend struct {
+	mu     sync.Mutex
+	nonces map[common.Address]uint64
+	sent   []common.Hash
+	err    error
+}
+
+func (b *fakeBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nonces[account], nil
+}
+
+func (b *fakeBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sent = append(b.sent, tx.Hash())
+	return b.err
+}
+
+func newTx(nonce uint64, gasPrice int64) *types.Transaction {
+	to := common.HexToAddress("0x1024")
+	return types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Gas: 21000, GasPrice: big.NewInt(gasPrice), Value: big.NewInt(1)})
+}
+
+func TestJournal(t *testing.T) {
+	from := common.HexToAddress("0x2048")
+	primary := &fakeBackend{nonces: map[common.Address]uint64{from: 1}}
+	secondary := &fakeBackend{err: errors.New("already known")}
+	j, err := Open("", []Backend{primary, secondary}, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	mined := newTx(0, 1)
+	replaced := newTx(1, 1)
+	replacement := newTx(1, 2)
+	pending := newTx(2, 1)
+	for _, tx := range []*types.Transaction{mined, replaced, replacement, pending} {
+		if err := j.Add(tx, from); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := j.Len(); n != 3 {
+		t.Fatalf("journal len %d, want 3 with the replaced removed", n)
+	}
+
+	// paused for maintenance
+	m, err := maintenance.New(nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetReadOnly(true, "upgrade")
+	maintenance.Enable(m)
+	j.rebroadcast()
+	maintenance.Enable(nil)
+	if n := j.Len(); n != 3 || len(primary.sent) != 0 || len(secondary.sent) != 0 {
+		t.Fatalf("journal len %d and sent %d, want nothing done for maintenance", n, len(primary.sent))
+	}
+
+	j.rebroadcast()
+	if n := j.Len(); n != 2 {
+		t.Errorf("journal len %d, want 2 with the mined removed", n)
+	}
+	for _, b := range []*fakeBackend{primary, secondary} {
+		if len(b.sent) != 2 {
+			t.Fatalf("sent %d, want 2", len(b.sent))
+		}
+		for _, hash := range b.sent {
+			if hash != replacement.Hash() && hash != pending.Hash() {
+				t.Errorf("sent %s, want the replacement and pending", hash.Hex())
+			}
+		}
+	}
+
+	j.maxAge = time.Nanosecond
+	j.rebroadcast()
+	if n := j.Len(); n != 0 {
+		t.Errorf("journal len %d, want 0 after max age", n)
+	}
+}
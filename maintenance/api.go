@@ -0,0 +1,55 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// API serves the admin API of mode under /maintenance, authorized by the bearer token:
+//
+//	GET  /maintenance          get the read-only status
+//	POST /maintenance/readonly switch the read-only mode on
+//	POST /maintenance/readwrite switch the read-only mode off
+type API struct {
+	Mode  *Mode
+	Token string
+}
+
+// NewAPI returns the admin API of mode, the token must not be empty
+func NewAPI(m *Mode, token string) *API {
+	return &API{Mode: m, Token: token}
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !params.Authorized(r, api.Token) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/maintenance"), "/")
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+	case path == "readonly" && r.Method == http.MethodPost:
+		api.Mode.SetReadOnly(true, "api")
+	case path == "readwrite" && r.Method == http.MethodPost:
+		api.Mode.SetReadOnly(false, "api")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, api.Mode.Status(time.Now()))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,189 @@
+package maintenance
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultMessage is the error message of the requests rejected in read-only mode
+const DefaultMessage = "the guard is read-only for maintenance"
+
+// WriteMethods are the methods writing to the chain or the node, rejected in read-only mode if AllWrites set
+var WriteMethods = []string{
+	"eth_sendRawTransaction",
+	"eth_sendTransaction",
+	"eth_signTransaction",
+	"eth_sign",
+	"eth_submitWork",
+	"eth_submitHashrate",
+	"personal_*",
+	"miner_*",
+	"admin_*",
+	"debug_*",
+}
+
+// Window is a scheduled maintenance window in [Start, End)
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Contains returns whether t is in the window
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Mode rejects the write methods if switched to read-only, or in a scheduled maintenance window
+type Mode struct {
+	methods  map[string]struct{}
+	prefixes []string // of the methods such as "personal_*"
+	message  string
+	windows  []Window
+
+	mu       sync.RWMutex
+	readOnly bool
+	reason   string
+	since    time.Time
+}
+
+// New returns the mode rejecting methods with message, "eth_sendRawTransaction" if methods is empty.
+// The method ends with "_*" matches all the methods with the prefix.
+func New(methods []string, message string, windows []Window) (*Mode, error) {
+	if len(methods) == 0 {
+		methods = []string{"eth_sendRawTransaction"}
+	}
+	if message == "" {
+		message = DefaultMessage
+	}
+	m := &Mode{
+		methods: make(map[string]struct{}, len(methods)),
+		message: message,
+		windows: windows,
+	}
+	for _, method := range methods {
+		if strings.HasSuffix(method, "_*") {
+			m.prefixes = append(m.prefixes, strings.TrimSuffix(method, "*"))
+			continue
+		}
+		m.methods[method] = struct{}{}
+	}
+	for _, w := range windows {
+		if !w.Start.Before(w.End) {
+			return nil, errors.New("maintenance window start not before end")
+		}
+	}
+	return m, nil
+}
+
+// Message returns the error message of the requests rejected
+func (m *Mode) Message() string {
+	return m.message
+}
+
+// SetReadOnly switches the read-only mode on or off for reason
+func (m *Mode) SetReadOnly(on bool, reason string) {
+	m.mu.Lock()
+	if m.readOnly == on {
+		m.mu.Unlock()
+		return
+	}
+	m.readOnly = on
+	m.reason = reason
+	m.since = time.Now()
+	m.mu.Unlock()
+
+	if on {
+		log.Warnf("Read-only mode is on by %s", reason)
+	} else {
+		log.Warnf("Read-only mode is off by %s", reason)
+	}
+	notify.AddEvent(notify.NewEvent(notify.EventReadOnly, "", map[string]interface{}{
+		"readOnly": on,
+		"reason":   reason,
+	}))
+}
+
+// Status is the read-only status at a time
+type Status struct {
+	Active      bool      `json:"active"`                // the write methods are rejected
+	ReadOnly    bool      `json:"readOnly"`              // switched to read-only
+	Reason      string    `json:"reason,omitempty"`      // of the last switch
+	Since       time.Time `json:"since"`                 // of the last switch
+	Maintenance *Window   `json:"maintenance,omitempty"` // the current window
+	Windows     []Window  `json:"windows,omitempty"`
+	Message     string    `json:"message"`
+}
+
+// Status returns the status at now
+func (m *Mode) Status(now time.Time) *Status {
+	m.mu.RLock()
+	s := &Status{
+		ReadOnly: m.readOnly,
+		Reason:   m.reason,
+		Since:    m.since,
+		Windows:  m.windows,
+		Message:  m.message,
+	}
+	m.mu.RUnlock()
+
+	for i := range m.windows {
+		if m.windows[i].Contains(now) {
+			w := m.windows[i]
+			s.Maintenance = &w
+			break
+		}
+	}
+	s.Active = s.ReadOnly || s.Maintenance != nil
+	return s
+}
+
+// Active returns whether the write methods are rejected at now
+func (m *Mode) Active(now time.Time) bool {
+	m.mu.RLock()
+	readOnly := m.readOnly
+	m.mu.RUnlock()
+	if readOnly {
+		return true
+	}
+	for _, w := range m.windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWrite returns whether the method is rejected in read-only mode
+func (m *Mode) isWrite(method string) bool {
+	if _, ok := m.methods[method]; ok {
+		return true
+	}
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocked returns whether the method is rejected at now
+func (m *Mode) Blocked(method string, now time.Time) bool {
+	return m.isWrite(method) && m.Active(now)
+}
+
+var std *Mode
+
+// Enable sets the mode checking the methods
+func Enable(m *Mode) {
+	std = m
+}
+
+// Default returns the mode enabled, or nil
+func Default() *Mode {
+	return std
+}
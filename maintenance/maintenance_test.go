@@ -0,0 +1,89 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMode(t *testing.T) {
+	now := time.Now()
+	m, err := New([]string{"eth_sendRawTransaction", "personal_*"}, "", []Window{{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Message() != DefaultMessage {
+		t.Errorf("message %s, want %s", m.Message(), DefaultMessage)
+	}
+
+	if m.Blocked("eth_sendRawTransaction", now) {
+		t.Error("blocked before read-only")
+	}
+	m.SetReadOnly(true, "test")
+	for _, method := range []string{"eth_sendRawTransaction", "personal_unlockAccount"} {
+		if !m.Blocked(method, now) {
+			t.Errorf("%s not blocked in read-only", method)
+		}
+	}
+	if m.Blocked("eth_getBalance", now) {
+		t.Error("read method blocked in read-only")
+	}
+	m.SetReadOnly(false, "test")
+	if m.Blocked("eth_sendRawTransaction", now) {
+		t.Error("blocked after read-write")
+	}
+
+	if !m.Blocked("eth_sendRawTransaction", now.Add(time.Hour)) {
+		t.Error("not blocked in maintenance window")
+	}
+	if s := m.Status(now.Add(90 * time.Minute)); !s.Active || s.ReadOnly || s.Maintenance == nil {
+		t.Errorf("status in window %+v", s)
+	}
+	if m.Blocked("eth_sendRawTransaction", now.Add(2*time.Hour)) {
+		t.Error("blocked after maintenance window")
+	}
+
+	if _, err := New(nil, "", []Window{{Start: now, End: now}}); err == nil {
+		t.Error("empty window accepted")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	m, err := New(nil, "down", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI(m, "secret")
+	do := func(method, path, token string) (int, *Status) {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		s := new(Status)
+		json.Unmarshal(w.Body.Bytes(), s)
+		return w.Code, s
+	}
+
+	if code, _ := do(http.MethodPost, "/maintenance/readonly", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("unauthorized status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if m.Active(time.Now()) {
+		t.Error("read-only by unauthorized request")
+	}
+	if code, s := do(http.MethodPost, "/maintenance/readonly", "secret"); code != http.StatusOK || !s.ReadOnly || s.Reason != "api" {
+		t.Errorf("readonly status %d %+v", code, s)
+	}
+	if code, s := do(http.MethodGet, "/maintenance", "secret"); code != http.StatusOK || !s.Active || s.Message != "down" {
+		t.Errorf("get status %d %+v", code, s)
+	}
+	if code, s := do(http.MethodPost, "/maintenance/readwrite", "secret"); code != http.StatusOK || s.Active {
+		t.Errorf("readwrite status %d %+v", code, s)
+	}
+	if code, _ := do(http.MethodGet, "/maintenance/readonly", "secret"); code != http.StatusNotFound {
+		t.Errorf("get readonly status %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,22 @@
+package maintenance
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleSignals switches the read-only mode on by SIGUSR1 and off by SIGUSR2 until stop closed
+func (m *Mode) HandleSignals(stop <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigs)
+	for {
+		select {
+		case sig := <-sigs:
+			m.SetReadOnly(sig == syscall.SIGUSR1, sig.String())
+		case <-stop:
+			return
+		}
+	}
+}
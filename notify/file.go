@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// FileNotifier appends notifications to the local file in JSON lines
+type FileNotifier struct {
+	Path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// fileLine is a line of FileNotifier, the payload is embedded if it is JSON,
+// a string if it is UTF-8, or base64 encoded bytes otherwise
+type fileLine struct {
+	Topic   string      `json:"topic"`
+	Time    int64       `json:"time"`
+	Payload interface{} `json:"payload"`
+}
+
+func (n *FileNotifier) Connect() error {
+	file, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	n.file = file
+	return nil
+}
+
+func (n *FileNotifier) Publish(topic string, payload []byte) error {
+	line := fileLine{Topic: topic, Time: time.Now().Unix()}
+	if json.Valid(payload) {
+		line.Payload = json.RawMessage(payload)
+	} else if utf8.Valid(payload) {
+		line.Payload = string(payload)
+	} else {
+		line.Payload = payload
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err := n.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return n.file.Sync()
+}
+
+func (n *FileNotifier) Close() error {
+	if n.file != nil {
+		return n.file.Close()
+	}
+	return nil
+}
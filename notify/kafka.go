@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaNotifier publishes to the Kafka brokers
+type KafkaNotifier struct {
+	Brokers      []string
+	RequiredAcks int // -1 for all replicas, 1 for the leader, 0 for none
+
+	writer *kafka.Writer
+}
+
+func (n *KafkaNotifier) Connect() error {
+	if len(n.Brokers) == 0 {
+		return errors.New("kafka brokers not set")
+	}
+	conn, err := kafka.Dial("tcp", n.Brokers[0])
+	if err != nil {
+		return err
+	}
+	conn.Close()
+
+	n.writer = &kafka.Writer{
+		Addr:         kafka.TCP(n.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequiredAcks(n.RequiredAcks),
+		WriteTimeout: PublishTimeout,
+	}
+	return nil
+}
+
+func (n *KafkaNotifier) Publish(topic string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), PublishTimeout)
+	defer cancel()
+	return n.writer.WriteMessages(ctx, kafka.Message{Topic: topic, Value: payload})
+}
+
+func (n *KafkaNotifier) Close() error {
+	if n.writer != nil {
+		return n.writer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The payload format of notification
+const (
+	FormatRaw      = "raw"      // raw transaction hex string, the legacy format
+	FormatJSON     = "json"     // Message in JSON
+	FormatProtobuf = "protobuf" // Message in protobuf, see message.proto
+)
+
+// ContentType returns the MIME type of the payload in format
+func ContentType(format string) string {
+	switch format {
+	case FormatRaw:
+		return "text/plain"
+	case FormatProtobuf:
+		return "application/x-protobuf"
+	default:
+		return "application/json"
+	}
+}
+
+// The guard decision of transaction
+const (
+	DecisionAccepted = "accepted"
+	DecisionRejected = "rejected"
+)
+
+// The type of guard event
+const (
+	EventBlacklist  = "blacklist"  // blacklist loaded
+	EventRateLimit  = "ratelimit"  // IP rate limit reached
+	EventTxMined    = "txmined"    // accepted transaction included with success receipt
+	EventTxFailed   = "txfailed"   // accepted transaction included with failed receipt
+	EventTxDropped  = "txdropped"  // accepted transaction not included in time
+	EventQuarantine = "quarantine" // transaction held, approved, denied or expired in quarantine
+	EventReadOnly   = "readonly"   // read-only mode switched on or off
+	EventCircuit    = "circuit"    // circuit breaker of upstream opened, half-opened or closed
+)
+
+// Event is the notification of a guard event, always encoded in JSON
+type Event struct {
+	Type     string                 `json:"type"`
+	ClientIP string                 `json:"clientIP,omitempty"`
+	Detail   map[string]interface{} `json:"detail,omitempty"`
+	Time     int64                  `json:"time"` // unix time in second
+}
+
+// NewEvent returns the event of type at now
+func NewEvent(eventType, clientIP string, detail map[string]interface{}) *Event {
+	return &Event{
+		Type:     eventType,
+		ClientIP: clientIP,
+		Detail:   detail,
+		Time:     time.Now().Unix(),
+	}
+}
+
+// Message is the notification of a transaction checked by the guard
+type Message struct {
+	Hash      string   `json:"hash"`
+	From      string   `json:"from,omitempty"`
+	To        string   `json:"to,omitempty"`
+	Value     string   `json:"value"`
+	Nonce     uint64   `json:"nonce"`
+	Gas       uint64   `json:"gas"`
+	GasPrice  string   `json:"gasPrice,omitempty"`
+	GasTipCap string   `json:"maxPriorityFeePerGas,omitempty"`
+	GasFeeCap string   `json:"maxFeePerGas,omitempty"`
+	Type      uint8    `json:"type"`
+	ClientIP  string   `json:"clientIP,omitempty"`
+	APIKey    string   `json:"apiKey,omitempty"`
+	Decision  string   `json:"decision"`
+	Status    int      `json:"status"`
+	Notes     []string `json:"notes,omitempty"`
+	Raw       string   `json:"raw"`
+	Time      int64    `json:"time"` // unix time in second
+}
+
+// Encode encodes the message in format
+func (m *Message) Encode(format string) ([]byte, error) {
+	switch format {
+	case FormatRaw:
+		return []byte(m.Raw), nil
+	case FormatJSON:
+		return json.Marshal(m)
+	case FormatProtobuf:
+		return m.marshalProtobuf(), nil
+	}
+	return nil, fmt.Errorf("notify format %s not supported", format)
+}
+
+// marshalProtobuf encodes the message as the Message of message.proto
+func (m *Message) marshalProtobuf() []byte {
+	var b []byte
+	appendString := func(num protowire.Number, s string) {
+		if s != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+	appendVarint := func(num protowire.Number, v uint64) {
+		if v != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, v)
+		}
+	}
+
+	appendString(1, m.Hash)
+	appendString(2, m.From)
+	appendString(3, m.To)
+	appendString(4, m.Value)
+	appendVarint(5, m.Nonce)
+	appendVarint(6, m.Gas)
+	appendString(7, m.GasPrice)
+	appendString(8, m.GasTipCap)
+	appendString(9, m.GasFeeCap)
+	appendVarint(10, uint64(m.Type))
+	appendString(11, m.ClientIP)
+	appendString(12, m.APIKey)
+	appendString(13, m.Decision)
+	appendVarint(14, uint64(m.Status))
+	for _, note := range m.Notes {
+		b = protowire.AppendTag(b, 15, protowire.BytesType)
+		b = protowire.AppendString(b, note)
+	}
+	appendString(16, m.Raw)
+	appendVarint(17, uint64(m.Time))
+
+	return b
+}
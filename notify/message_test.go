@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestMessageEncode(t *testing.T) {
+	msg := &Message{
+		Hash:     "0x01",
+		Value:    "1",
+		Nonce:    2,
+		Decision: DecisionAccepted,
+		Status:   200,
+		Notes:    []string{"a", "b"},
+		Raw:      "0xf8",
+	}
+
+	b, err := msg.Encode(FormatRaw)
+	if err != nil || string(b) != msg.Raw {
+		t.Errorf("raw %s, want %s", b, msg.Raw)
+	}
+
+	b, err = msg.Encode(FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(b, &decoded); err != nil || decoded.Hash != msg.Hash || len(decoded.Notes) != 2 {
+		t.Errorf("json %s", b)
+	}
+
+	b, err = msg.Encode(FormatProtobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[protowire.Number][]interface{})
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+	if fields[1][0] != msg.Hash || fields[5][0] != uint64(2) || fields[14][0] != uint64(200) || len(fields[15]) != 2 {
+		t.Errorf("protobuf fields %v", fields)
+	}
+
+	if _, err := msg.Encode("xml"); err == nil {
+		t.Errorf("unsupported format without error")
+	}
+}
@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+type warnLogger struct {
+	*log.Logger
+}
+
+func (e warnLogger) Println(v ...interface{}) {
+	e.Warnln(v...)
+}
+
+func (e warnLogger) Printf(format string, v ...interface{}) {
+	e.Warnf(format, v...)
+}
+
+// MQTTNotifier publishes to the MQTT broker such as Apache ActiveMQ
+type MQTTNotifier struct {
+	Server   string
+	Username string
+	Password string
+	ClientID string
+	QoS      byte
+
+	TLSConfig    *tls.Config // nil for the plain connection
+	CleanSession bool        // false to resume the persistent session of ClientID on the broker
+	KeepAlive    time.Duration
+
+	// the last will published by the broker when the guard disconnected unexpectedly, empty WillTopic to disable
+	WillTopic    string
+	WillPayload  string
+	WillQoS      byte
+	WillRetained bool
+	// OnlinePayload is published to WillTopic with the will QoS and retained flag once connected, empty to disable
+	OnlinePayload string
+
+	client mqtt.Client
+}
+
+// NewTLSConfig returns the TLS config trusting the CA certificates in caFile,
+// with the client certificate if certFile and keyFile set
+func NewTLSConfig(caFile, certFile, keyFile, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (n *MQTTNotifier) Connect() error {
+	if Logger != nil {
+		mqtt.ERROR = warnLogger{Logger}
+	}
+	opts := mqtt.NewClientOptions().AddBroker(n.Server).SetClientID(n.ClientID)
+	opts.SetUsername(n.Username)
+	opts.SetPassword(n.Password)
+	opts.SetCleanSession(n.CleanSession)
+	if n.TLSConfig != nil {
+		opts.SetTLSConfig(n.TLSConfig)
+	}
+	if n.KeepAlive > 0 {
+		opts.SetKeepAlive(n.KeepAlive)
+	}
+	if n.WillTopic != "" {
+		opts.SetWill(n.WillTopic, n.WillPayload, n.WillQoS, n.WillRetained)
+	}
+	opts.OnConnect = func(c mqtt.Client) {
+		Logger.Info("ActiveMQ Connected/Reconnected...")
+		if n.WillTopic != "" && n.OnlinePayload != "" {
+			c.Publish(n.WillTopic, n.WillQoS, n.WillRetained, n.OnlinePayload)
+		}
+	}
+
+	c := mqtt.NewClient(opts)
+	if token := c.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	n.client = c
+
+	return nil
+}
+
+// Publish waits for the acknowledgement of QoS
+func (n *MQTTNotifier) Publish(topic string, payload []byte) error {
+	token := n.client.Publish(topic, n.QoS, false, payload)
+	if !token.WaitTimeout(PublishTimeout) {
+		return errors.New("publish timeout")
+	}
+	return token.Error()
+}
+
+func (n *MQTTNotifier) Close() error {
+	if n.client != nil {
+		n.client.Disconnect(250)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "guard"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	config, err := NewTLSConfig(certFile, certFile, keyFile, "broker", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RootCAs == nil || len(config.Certificates) != 1 || config.ServerName != "broker" {
+		t.Errorf("tls config %+v", config)
+	}
+
+	if _, err := NewTLSConfig(keyFile, "", "", "", false); err == nil {
+		t.Error("CA file without certificate, want error")
+	}
+	if _, err := NewTLSConfig("", certFile, "", "", false); err == nil {
+		t.Error("client certificate without key, want error")
+	}
+}
@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+// NATSNotifier publishes to the NATS server
+type NATSNotifier struct {
+	URL      string
+	Username string
+	Password string
+
+	conn *nats.Conn
+}
+
+func (n *NATSNotifier) Connect() error {
+	opts := []nats.Option{nats.Name(ClientID), nats.MaxReconnects(-1)}
+	if n.Username != "" {
+		opts = append(opts, nats.UserInfo(n.Username, n.Password))
+	}
+	conn, err := nats.Connect(n.URL, opts...)
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	return nil
+}
+
+// Publish waits for the server processed the payload by flush
+func (n *NATSNotifier) Publish(topic string, payload []byte) error {
+	if err := n.conn.Publish(topic, payload); err != nil {
+		return err
+	}
+	return n.conn.FlushTimeout(PublishTimeout)
+}
+
+func (n *NATSNotifier) Close() error {
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	return nil
+}
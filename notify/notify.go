@@ -1,7 +1,10 @@
 package notify
 
 import (
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"encoding/json"
+	"net/http"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -9,73 +12,133 @@ var (
 	ClientID = "guard"
 	Topic    = "RawTransaction"
 	QoS      = byte(1)
+
+	// RejectedTopic and EventTopic are the topics of rejected transactions
+	// and guard events, empty to disable
+	RejectedTopic = ""
+	EventTopic    = ""
 )
 
-var (
-	TxChanMax = 4096
-	txCh      chan string
-	Logger    *log.Logger
+// The kind of notification
+const (
+	KindTransaction = "transaction"
+	KindRejected    = "rejected"
+	KindEvent       = "event"
 )
 
-type warnLogger struct {
-	*log.Logger
+// DefaultTopics returns the topics of notification kinds set by Topic, RejectedTopic and EventTopic
+func DefaultTopics() map[string]string {
+	return map[string]string{
+		KindTransaction: Topic,
+		KindRejected:    RejectedTopic,
+		KindEvent:       EventTopic,
+	}
 }
 
-func (e warnLogger) Println(v ...interface{}) {
-	e.Warnln(v)
-}
+var (
+	// PublishTimeout is the max time to wait for the acknowledgement of a publish
+	PublishTimeout = 10 * time.Second
 
-func (e warnLogger) Printf(format string, v ...interface{}) {
-	e.Warnf(format, v...)
-}
+	sinks  []*Sink
+	Logger = log.New()
+)
 
-func InitAndRunNotifyClient(server, username, password string, logger *log.Logger) {
-	if logger == nil {
-		logger = log.New()
+// AddSink registers the sink, notifications are fanned out to all sinks
+func AddSink(s *Sink) {
+	if depth := s.outbox.Depth(); depth > 0 {
+		Logger.Infof("Notify %s outbox has %d notifications to publish", s.Name, depth)
 	}
-	Logger = logger
-	c, err := newClient(server, username, password)
-	if err != nil {
-		logger.Warn(err)
-		return
+	sinks = append(sinks, s)
+}
+
+// Start runs the delivery of all sinks in background
+func Start() {
+	for _, s := range sinks {
+		go s.run()
 	}
+}
 
-	txCh = make(chan string, TxChanMax)
+// AddTx queues the transaction message to publish
+func AddTx(msg *Message) {
+	add(KindTransaction, msg)
+}
 
-	Run(c)
+// AddRejectedTx queues the rejected transaction message to publish
+func AddRejectedTx(msg *Message) {
+	add(KindRejected, msg)
 }
 
-func Run(client mqtt.Client) {
-	for txRaw := range txCh {
-		if client != nil {
-			client.Publish(Topic, QoS, false, txRaw)
+func add(kind string, msg *Message) {
+	for _, s := range sinks {
+		if !s.accepts(kind) {
+			continue
+		}
+		payload, err := msg.Encode(s.Format)
+		if err != nil {
+			Logger.Errorf("Notify %s encode message error: %v %s", s.Name, err, msg.Raw)
+			continue
 		}
+		s.put(kind, payload)
 	}
 }
 
-func newClient(server, username, password string) (mqtt.Client, error) {
-	if Logger != nil {
-		mqtt.ERROR = warnLogger{Logger}
+// AddEvent queues the guard event to publish
+func AddEvent(event *Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		Logger.Errorln("Notify encode event error:", err)
+		return
 	}
-	opts := mqtt.NewClientOptions().AddBroker(server).SetClientID(ClientID)
-	opts.SetUsername(username)
-	opts.SetPassword(password)
-	opts.OnConnect = func(c mqtt.Client) {
-		Logger.Info("ActiveMQ Connected/Reconnected...")
+	for _, s := range sinks {
+		if s.accepts(KindEvent) {
+			s.put(KindEvent, payload)
+		}
 	}
+}
 
-	c := mqtt.NewClient(opts)
-	if token := c.Connect(); token.Wait() && token.Error() != nil {
-		return nil, token.Error()
+// QueueDepth returns the number of notifications waiting to publish of all sinks
+func QueueDepth() int {
+	depth := 0
+	for _, s := range sinks {
+		depth += s.outbox.Depth()
 	}
+	return depth
+}
 
-	return c, nil
+// BacklogAge returns how long the oldest notification of all sinks has been waiting to publish
+func BacklogAge() time.Duration {
+	var age time.Duration
+	for _, s := range sinks {
+		if a := s.outbox.BacklogAge(); a > age {
+			age = a
+		}
+	}
+	return age
+}
+
+type sinkStatus struct {
+	QueueDepth int     `json:"queueDepth"`
+	BacklogAge float64 `json:"backlogAge"`
 }
 
-func AddTx(raw string) {
-	select {
-	case txCh <- raw:
-	default:
-		Logger.Warnln("discard raw transaction ", raw)
+// StatusHandler responses the queue depth and backlog age in seconds, in total and by sink
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		sinkStatus
+		Sinks map[string]sinkStatus `json:"sinks"`
+	}{
+		sinkStatus: sinkStatus{
+			QueueDepth: QueueDepth(),
+			BacklogAge: BacklogAge().Seconds(),
+		},
+		Sinks: make(map[string]sinkStatus, len(sinks)),
+	}
+	for _, s := range sinks {
+		status.Sinks[s.Name] = sinkStatus{
+			QueueDepth: s.outbox.Depth(),
+			BacklogAge: s.outbox.BacklogAge().Seconds(),
+		}
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
 }
@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var outboxPrefix = []byte("o")
+
+// Outbox is a FIFO queue of messages to publish backed by LevelDB,
+// messages are kept until they are acknowledged by the broker.
+type Outbox struct {
+	db *leveldb.DB
+
+	mu     sync.Mutex
+	seq    uint64
+	depth  int
+	oldest time.Time
+
+	ready chan struct{}
+}
+
+// OpenOutbox opens the outbox at path, or an in-memory outbox if path is empty
+func OpenOutbox(path string) (*Outbox, error) {
+	var (
+		db  *leveldb.DB
+		err error
+	)
+	if path == "" {
+		db, err = leveldb.Open(storage.NewMemStorage(), nil)
+	} else {
+		db, err = leveldb.OpenFile(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Outbox{db: db, ready: make(chan struct{}, 1)}
+	iter := db.NewIterator(util.BytesPrefix(outboxPrefix), nil)
+	for iter.Next() {
+		if o.depth == 0 {
+			o.oldest = decodeEnqueued(iter.Value())
+		}
+		o.depth++
+		o.seq = binary.BigEndian.Uint64(iter.Key()[len(outboxPrefix):])
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Put appends the payload of kind to the outbox
+func (o *Outbox) Put(kind string, payload []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	value := make([]byte, 9+len(kind)+len(payload))
+	binary.BigEndian.PutUint64(value, uint64(now.UnixNano()))
+	value[8] = byte(len(kind))
+	copy(value[9:], kind)
+	copy(value[9+len(kind):], payload)
+	if err := o.db.Put(outboxKey(o.seq+1), value, nil); err != nil {
+		return err
+	}
+	o.seq++
+	if o.depth == 0 {
+		o.oldest = now
+	}
+	o.depth++
+
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Peek returns the key, kind and payload of the oldest message
+func (o *Outbox) Peek() ([]byte, string, []byte, bool) {
+	iter := o.db.NewIterator(util.BytesPrefix(outboxPrefix), nil)
+	defer iter.Release()
+	if !iter.First() {
+		return nil, "", nil, false
+	}
+	key := append([]byte{}, iter.Key()...)
+	value := iter.Value()
+	if len(value) < 9 || len(value) < 9+int(value[8]) {
+		// broken message, return to be deleted
+		return key, "", nil, true
+	}
+	kindLen := int(value[8])
+	kind := string(value[9 : 9+kindLen])
+	payload := append([]byte{}, value[9+kindLen:]...)
+	return key, kind, payload, true
+}
+
+// Delete removes the message of key, and updates the backlog age
+func (o *Outbox) Delete(key []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.db.Delete(key, nil); err != nil {
+		return err
+	}
+	o.depth--
+	o.oldest = time.Time{}
+	iter := o.db.NewIterator(util.BytesPrefix(outboxPrefix), nil)
+	if iter.First() {
+		o.oldest = decodeEnqueued(iter.Value())
+	}
+	iter.Release()
+	return nil
+}
+
+// Ready returns a channel which receives when a message is put
+func (o *Outbox) Ready() <-chan struct{} {
+	return o.ready
+}
+
+// Depth returns the number of messages in the outbox
+func (o *Outbox) Depth() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.depth
+}
+
+// BacklogAge returns how long the oldest message has been waiting
+func (o *Outbox) BacklogAge() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.depth == 0 {
+		return 0
+	}
+	return time.Since(o.oldest)
+}
+
+// Close closes the outbox
+func (o *Outbox) Close() error {
+	return o.db.Close()
+}
+
+func outboxKey(seq uint64) []byte {
+	key := make([]byte, len(outboxPrefix)+8)
+	copy(key, outboxPrefix)
+	binary.BigEndian.PutUint64(key[len(outboxPrefix):], seq)
+	return key
+}
+
+func decodeEnqueued(value []byte) time.Time {
+	if len(value) < 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o, err := OpenOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{"0x01", "0x02", "0x03"} {
+		if err := o.Put(KindTransaction, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, kind, payload, ok := o.Peek()
+	if !ok || kind != KindTransaction || string(payload) != "0x01" {
+		t.Fatalf("peek %s, want 0x01", payload)
+	}
+	if err := o.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	o.Close()
+
+	// reopen, the remaining messages survive in order
+	o, err = OpenOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if depth := o.Depth(); depth != 2 {
+		t.Errorf("depth %d, want 2", depth)
+	}
+	if o.BacklogAge() <= 0 {
+		t.Errorf("backlog age %s, want positive", o.BacklogAge())
+	}
+	o.Put(KindRejected, []byte("0x04"))
+	for _, want := range []string{"0x02", "0x03", "0x04"} {
+		key, _, payload, ok := o.Peek()
+		if !ok || string(payload) != want {
+			t.Fatalf("peek %s, want %s", payload, want)
+		}
+		o.Delete(key)
+	}
+	if _, _, _, ok := o.Peek(); ok || o.Depth() != 0 || o.BacklogAge() != 0 {
+		t.Errorf("outbox not empty")
+	}
+}
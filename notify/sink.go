@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"time"
+)
+
+// Notifier publishes notifications to a broker or endpoint
+type Notifier interface {
+	// Connect connects to the broker, it is retried until success
+	Connect() error
+	// Publish publishes the payload to topic, and returns after the payload acknowledged
+	Publish(topic string, payload []byte) error
+	// Close disconnects from the broker
+	Close() error
+}
+
+// TypedNotifier is the Notifier sending the content type with the payload, such as webhook
+type TypedNotifier interface {
+	Notifier
+	// PublishTyped publishes the payload of contentType to topic
+	PublishTyped(topic, contentType string, payload []byte) error
+}
+
+// RetryPolicy is the policy of connect and publish retries
+type RetryPolicy struct {
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	MaxAttempts int // max attempts to publish a notification, 0 means retry forever
+}
+
+// DefaultRetryPolicy retries forever with backoff from one second to one minute
+var DefaultRetryPolicy = RetryPolicy{
+	MinInterval: time.Second,
+	MaxInterval: time.Minute,
+}
+
+func (p RetryPolicy) next(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > p.MaxInterval {
+		backoff = p.MaxInterval
+	}
+	return backoff
+}
+
+// Sink delivers the notifications queued in its outbox to the Notifier
+type Sink struct {
+	Name     string
+	Notifier Notifier
+	Topics   map[string]string // notification kind to topic, the kind without topic is not delivered
+	Format   string            // payload format of transaction messages
+	Retry    RetryPolicy
+
+	outbox *Outbox
+	quit   chan struct{}
+}
+
+// NewSink returns a sink with the outbox at outboxPath, or an in-memory outbox if outboxPath is empty
+func NewSink(name string, notifier Notifier, topics map[string]string, format string, retry RetryPolicy, outboxPath string) (*Sink, error) {
+	if format == "" {
+		format = FormatJSON
+	}
+	if _, err := (&Message{}).Encode(format); err != nil {
+		return nil, err
+	}
+	if retry.MinInterval <= 0 {
+		retry.MinInterval = DefaultRetryPolicy.MinInterval
+	}
+	if retry.MaxInterval < retry.MinInterval {
+		retry.MaxInterval = retry.MinInterval
+	}
+
+	o, err := OpenOutbox(outboxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sink{
+		Name:     name,
+		Notifier: notifier,
+		Topics:   topics,
+		Format:   format,
+		Retry:    retry,
+		outbox:   o,
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// accepts returns whether the sink delivers the kind of notification
+func (s *Sink) accepts(kind string) bool {
+	return s.Topics[kind] != ""
+}
+
+func (s *Sink) put(kind string, payload []byte) {
+	if err := s.outbox.Put(kind, payload); err != nil {
+		Logger.Errorf("Notify %s outbox put error: %v %s", s.Name, err, payload)
+	}
+}
+
+// sleep waits for d, returns false if the sink closed
+func (s *Sink) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.quit:
+		return false
+	}
+}
+
+// run connects the notifier, then publishes the notifications in outbox in order.
+// A notification is removed from outbox after acknowledged, or dropped after
+// Retry.MaxAttempts attempts.
+func (s *Sink) run() {
+	backoff := s.Retry.MinInterval
+	for {
+		err := s.Notifier.Connect()
+		if err == nil {
+			break
+		}
+		Logger.Warnf("Notify %s connect error: %v, retry in %s", s.Name, err, backoff)
+		if !s.sleep(backoff) {
+			return
+		}
+		backoff = s.Retry.next(backoff)
+	}
+	Logger.Infof("Notify %s connected", s.Name)
+
+	backoff = s.Retry.MinInterval
+	attempts := 0
+	for {
+		key, kind, payload, ok := s.outbox.Peek()
+		if !ok {
+			select {
+			case <-s.outbox.Ready():
+				continue
+			case <-s.quit:
+				return
+			}
+		}
+
+		topic := s.Topics[kind]
+		if topic == "" {
+			Logger.Warnf("Notify %s discard %s notification without topic", s.Name, kind)
+			s.delete(key)
+			continue
+		}
+
+		if err := s.publish(topic, kind, payload); err != nil {
+			attempts++
+			if s.Retry.MaxAttempts > 0 && attempts >= s.Retry.MaxAttempts {
+				Logger.Errorf("Notify %s publish error: %v, drop after %d attempts: %s", s.Name, err, attempts, payload)
+				s.delete(key)
+				attempts = 0
+				backoff = s.Retry.MinInterval
+				continue
+			}
+			Logger.Warnf("Notify %s publish error: %v, retry in %s", s.Name, err, backoff)
+			if !s.sleep(backoff) {
+				return
+			}
+			backoff = s.Retry.next(backoff)
+			continue
+		}
+		attempts = 0
+		backoff = s.Retry.MinInterval
+		s.delete(key)
+	}
+}
+
+// publish publishes the payload of kind with its content type if supported by the notifier,
+// the events are always in JSON
+func (s *Sink) publish(topic, kind string, payload []byte) error {
+	n, ok := s.Notifier.(TypedNotifier)
+	if !ok {
+		return s.Notifier.Publish(topic, payload)
+	}
+	format := s.Format
+	if kind == KindEvent {
+		format = FormatJSON
+	}
+	return n.PublishTyped(topic, ContentType(format), payload)
+}
+
+func (s *Sink) delete(key []byte) {
+	if err := s.outbox.Delete(key); err != nil {
+		Logger.Errorf("Notify %s outbox delete error: %v", s.Name, err)
+	}
+}
+
+// Close stops the delivery and closes the notifier and outbox
+func (s *Sink) Close() error {
+	close(s.quit)
+	s.Notifier.Close()
+	return s.outbox.Close()
+}
@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	type request struct {
+		topic, signature, contentType string
+		body                          []byte
+	}
+	requests := make(chan request, 4)
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		// the first delivery fails, and is retried
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		requests <- request{r.Header.Get(WebhookTopicHeader), r.Header.Get(WebhookSignatureHeader), r.Header.Get("Content-Type"), body}
+	}))
+	defer srv.Close()
+
+	retry := RetryPolicy{MinInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond}
+	s, err := NewSink("webhook", &WebhookNotifier{URL: srv.URL, Secret: "secret"},
+		map[string]string{KindTransaction: "tx", KindEvent: "event"}, FormatProtobuf, retry, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go s.run()
+
+	payload := []byte(`{"hash":"0x01"}`)
+	s.put(KindRejected, []byte(`{"hash":"0x00"}`)) // no topic, discarded
+	s.put(KindTransaction, payload)
+
+	select {
+	case req := <-requests:
+		if req.topic != "tx" || string(req.body) != string(payload) {
+			t.Errorf("webhook %s %s, want tx %s", req.topic, req.body, payload)
+		}
+		if want := "sha256=" + WebhookSignature("secret", payload); req.signature != want {
+			t.Errorf("signature %s, want %s", req.signature, want)
+		}
+		if req.contentType != "application/x-protobuf" {
+			t.Errorf("content type %s of protobuf message", req.contentType)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	// the events are always in JSON
+	s.put(KindEvent, []byte(`{"type":"readonly"}`))
+	select {
+	case req := <-requests:
+		if req.topic != "event" || req.contentType != "application/json" {
+			t.Errorf("event %s of content type %s", req.topic, req.contentType)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify.jsonl")
+
+	s, err := NewSink("file", &FileNotifier{Path: path}, DefaultTopics(), FormatJSON, DefaultRetryPolicy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.put(KindTransaction, []byte(`{"hash":"0x01"}`))
+	s.put(KindTransaction, []byte("0x02"))
+	go s.run()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.outbox.Depth() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []fileLine
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line fileLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 || lines[0].Topic != Topic || lines[1].Payload != "0x02" {
+		t.Fatalf("file lines %+v", lines)
+	}
+	if hash := lines[0].Payload.(map[string]interface{})["hash"]; hash != "0x01" {
+		t.Errorf("payload hash %v, want 0x01", hash)
+	}
+}
+
+type failNotifier struct{ attempts int }
+
+func (n *failNotifier) Connect() error { return nil }
+func (n *failNotifier) Publish(topic string, payload []byte) error {
+	n.attempts++
+	return os.ErrDeadlineExceeded
+}
+func (n *failNotifier) Close() error { return nil }
+
+func TestSinkDropAfterMaxAttempts(t *testing.T) {
+	n := &failNotifier{}
+	retry := RetryPolicy{MinInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxAttempts: 3}
+	s, err := NewSink("fail", n, DefaultTopics(), FormatJSON, retry, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.put(KindTransaction, []byte("0x01"))
+	go s.run()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.outbox.Depth() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+	if s.outbox.Depth() != 0 || n.attempts != 3 {
+		t.Errorf("depth %d attempts %d, want dropped after 3 attempts", s.outbox.Depth(), n.attempts)
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// The headers of webhook request
+const (
+	WebhookTopicHeader     = "X-Guard-Topic"
+	WebhookSignatureHeader = "X-Guard-Signature"
+)
+
+// WebhookNotifier posts the payload to URL, signed by HMAC-SHA256 of Secret if set
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+
+	client *http.Client
+}
+
+func (n *WebhookNotifier) Connect() error {
+	n.client = &http.Client{Timeout: PublishTimeout}
+	return nil
+}
+
+func (n *WebhookNotifier) Publish(topic string, payload []byte) error {
+	return n.PublishTyped(topic, ContentType(FormatJSON), payload)
+}
+
+func (n *WebhookNotifier) PublishTyped(topic, contentType string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(WebhookTopicHeader, topic)
+	if n.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+WebhookSignature(n.Secret, payload))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook response status %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) Close() error {
+	return nil
+}
+
+// WebhookSignature returns the hex-encoded HMAC-SHA256 of payload with secret
+func WebhookSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -3,8 +3,10 @@ package params
 import (
 	"encoding/json"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	db "github.com/upper/db/v4"
 )
 
@@ -12,6 +14,27 @@ var (
 	Big1NEW = big.NewInt(1000000000000000000)
 )
 
+// The type of to address required by RequireToType
+const (
+	ToTypeContract = "contract"
+	ToTypeEOA      = "eoa"
+)
+
+// DefaultCodeCacheTTL is the default cache time of code lookup
+const DefaultCodeCacheTTL = 10 * time.Minute
+
+// DefaultMaxLogsChunks is the default max number of chunks of split eth_getLogs range
+const DefaultMaxLogsChunks = 100
+
+// TxTypeNames maps the transaction type name used in config to the transaction type
+var TxTypeNames = map[string]uint8{
+	"legacy":     types.LegacyTxType,
+	"accesslist": types.AccessListTxType,
+	"eip2930":    types.AccessListTxType,
+	"dynamicfee": types.DynamicFeeTxType,
+	"eip1559":    types.DynamicFeeTxType,
+}
+
 type Config struct {
 	RawURL string
 
@@ -25,10 +48,43 @@ type Config struct {
 	// to address
 	DisableContractCreate bool
 	ToBlackList           map[common.Address]struct{}
+	ToWhiteList           map[common.Address]struct{} // if not empty, other to addresses are rejected
+	RequireToType         string                      // ToTypeContract, ToTypeEOA or empty for any
+	CodeCacheTTL          time.Duration               // cache time of code lookup for RequireToType
 
 	// hash
 	TxHashBlackList map[common.Hash]struct{}
 
+	// transaction type
+	TxTypeAllowList          map[uint8]struct{} // empty means all types allowed
+	RequireEIP155            bool               // reject legacy transaction without replay protection
+	MaxAccessListSize        int                // max number of access list tuples, 0 means no limit
+	MaxAccessListStorageKeys int                // max number of storage keys in access list, 0 means no limit
+
+	// calldata
+	MaxCalldataSize int // max size of transaction data in bytes, 0 means no limit
+	ContractRules   map[common.Address]*ContractRule
+
+	// eth_call and eth_estimateGas
+	MaxCallGas         uint64        // cap of the gas field, injected if absent, 0 means no cap
+	AllowStateOverride bool          // allow the state override argument
+	CallTimeout        time.Duration // upstream timeout of calls, 0 means no timeout
+	EstimateGasPadding int           // percentage added to the eth_estimateGas result
+
+	// eth_getLogs
+	MaxLogsBlockRange uint64 // max block range of filter, 0 means no limit
+	MaxLogsAddresses  int    // max number of addresses of filter, 0 means no limit
+	MaxLogsTopics     int    // max number of topics of filter, 0 means no limit
+	SplitLogsRange    bool   // split the range larger than MaxLogsBlockRange instead of rejecting
+	SplitLogsParallel int    // number of chunks requested in parallel when split
+	MaxLogsChunks     int    // max number of chunks of split range, larger is rejected, 0 means no limit
+	MaxLogsResultSize int    // max size of split result in bytes, 0 means no limit
+
+	// hedged requests of read methods
+	HedgeUpstream   string        // the second upstream hedged to, empty means no hedging
+	HedgePercentile float64       // hedge after the latency percentile of the first upstream
+	HedgeMinDelay   time.Duration // hedge no earlier than the delay
+
 	// value
 	EnableMaxValueVerify bool
 	MaxValueInWEI        *big.Int // value in WEI
@@ -51,8 +107,14 @@ type Config struct {
 	// ChainID
 	ChainID *big.Int
 
+	// methods answered by the guard, from LocalResults or fetched from the node once
+	LocalMethods map[string]struct{}
+	LocalResults map[string]json.RawMessage // static results by lowercase method name
+
 	// Apache ActiveMQ
 	EnableActiveMQ bool
+	// EnableNotify is set if ActiveMQ or any notify sink enabled
+	EnableNotify bool
 
 	// Whitelist from DB
 	EnableWhitelistDB      bool
@@ -79,11 +141,20 @@ var (
 		FromBlackList: make(map[common.Address]struct{}),
 
 		// to address
-		ToBlackList: make(map[common.Address]struct{}),
+		ToBlackList:  make(map[common.Address]struct{}),
+		ToWhiteList:  make(map[common.Address]struct{}),
+		CodeCacheTTL: DefaultCodeCacheTTL,
+
+		// eth_getLogs
+		SplitLogsParallel: 1,
+		MaxLogsChunks:     DefaultMaxLogsChunks,
 
 		// hash
 		TxHashBlackList: make(map[common.Hash]struct{}),
 
+		// transaction type
+		TxTypeAllowList: make(map[uint8]struct{}),
+
 		// value
 		EnableMaxValueVerify: false,
 		MaxValueInWEI:        big.NewInt(0).Mul(big.NewInt(1000000), Big1NEW), // 1000000 NEW
@@ -116,6 +187,7 @@ func Copy(c *Config) *Config {
 		MinGasTipCapInWEI:       big.NewInt(0).Set(c.MinGasTipCapInWEI),
 		ChainID:                 c.ChainID,
 		EnableActiveMQ:          c.EnableActiveMQ,
+		EnableNotify:            c.EnableNotify,
 	}
 
 	if methodWhitelist := c.MethodWhiteList; len(methodWhitelist) > 0 {
@@ -152,37 +224,83 @@ func Copy(c *Config) *Config {
 // MarshalJSON encodes to json format.
 func (c *Config) MarshalJSON() ([]byte, error) {
 	type config struct {
-		RawURL                  string
-		MethodWhiteList         []string
-		FromBlackList           int
-		DisableContractCreate   bool
-		ToBlackList             int
-		TxHashBlackList         int
-		EnableMaxValueVerify    bool
-		MaxValueInWEI           *big.Int
-		EnableMaxGasLimitVerify bool
-		MaxGasLimit             uint64
-		MinGasLimit             uint64
-		MinGasPriceInWEI        *big.Int
-		MinGasTipCapInWEI       *big.Int
-		ChainID                 *big.Int
-		EnableActiveMQ          bool
+		RawURL                   string
+		MethodWhiteList          []string
+		FromBlackList            int
+		DisableContractCreate    bool
+		ToBlackList              int
+		ToWhiteList              int
+		RequireToType            string
+		TxHashBlackList          int
+		TxTypeAllowList          []uint8
+		RequireEIP155            bool
+		MaxAccessListSize        int
+		MaxAccessListStorageKeys int
+		MaxCalldataSize          int
+		ContractRules            int
+		MaxCallGas               uint64
+		AllowStateOverride       bool
+		CallTimeout              string
+		EstimateGasPadding       int
+		MaxLogsBlockRange        uint64
+		MaxLogsAddresses         int
+		MaxLogsTopics            int
+		SplitLogsRange           bool
+		SplitLogsParallel        int
+		MaxLogsChunks            int
+		MaxLogsResultSize        int
+		HedgeUpstream            string
+		HedgePercentile          float64
+		HedgeMinDelay            string
+		LocalMethods             []string
+		EnableMaxValueVerify     bool
+		MaxValueInWEI            *big.Int
+		EnableMaxGasLimitVerify  bool
+		MaxGasLimit              uint64
+		MinGasLimit              uint64
+		MinGasPriceInWEI         *big.Int
+		MinGasTipCapInWEI        *big.Int
+		ChainID                  *big.Int
+		EnableActiveMQ           bool
+		EnableNotify             bool
 	}
 	enc := &config{
-		RawURL:                  c.RawURL,
-		FromBlackList:           len(c.FromBlackList),
-		DisableContractCreate:   c.DisableContractCreate,
-		ToBlackList:             len(c.ToBlackList),
-		TxHashBlackList:         len(c.TxHashBlackList),
-		EnableMaxValueVerify:    c.EnableMaxValueVerify,
-		MaxValueInWEI:           big.NewInt(0).Set(c.MaxValueInWEI),
-		EnableMaxGasLimitVerify: c.EnableMaxGasLimitVerify,
-		MaxGasLimit:             c.MaxGasLimit,
-		MinGasLimit:             c.MinGasLimit,
-		MinGasPriceInWEI:        big.NewInt(0).Set(c.MinGasPriceInWEI),
-		MinGasTipCapInWEI:       big.NewInt(0).Set(c.MinGasTipCapInWEI),
-		ChainID:                 c.ChainID,
-		EnableActiveMQ:          c.EnableActiveMQ,
+		RawURL:                   c.RawURL,
+		FromBlackList:            len(c.FromBlackList),
+		DisableContractCreate:    c.DisableContractCreate,
+		ToBlackList:              len(c.ToBlackList),
+		ToWhiteList:              len(c.ToWhiteList),
+		RequireToType:            c.RequireToType,
+		TxHashBlackList:          len(c.TxHashBlackList),
+		RequireEIP155:            c.RequireEIP155,
+		MaxAccessListSize:        c.MaxAccessListSize,
+		MaxAccessListStorageKeys: c.MaxAccessListStorageKeys,
+		MaxCalldataSize:          c.MaxCalldataSize,
+		ContractRules:            len(c.ContractRules),
+		MaxCallGas:               c.MaxCallGas,
+		AllowStateOverride:       c.AllowStateOverride,
+		CallTimeout:              c.CallTimeout.String(),
+		EstimateGasPadding:       c.EstimateGasPadding,
+		MaxLogsBlockRange:        c.MaxLogsBlockRange,
+		MaxLogsAddresses:         c.MaxLogsAddresses,
+		MaxLogsTopics:            c.MaxLogsTopics,
+		SplitLogsRange:           c.SplitLogsRange,
+		SplitLogsParallel:        c.SplitLogsParallel,
+		MaxLogsChunks:            c.MaxLogsChunks,
+		MaxLogsResultSize:        c.MaxLogsResultSize,
+		HedgeUpstream:            c.HedgeUpstream,
+		HedgePercentile:          c.HedgePercentile,
+		HedgeMinDelay:            c.HedgeMinDelay.String(),
+		EnableMaxValueVerify:     c.EnableMaxValueVerify,
+		MaxValueInWEI:            big.NewInt(0).Set(c.MaxValueInWEI),
+		EnableMaxGasLimitVerify:  c.EnableMaxGasLimitVerify,
+		MaxGasLimit:              c.MaxGasLimit,
+		MinGasLimit:              c.MinGasLimit,
+		MinGasPriceInWEI:         big.NewInt(0).Set(c.MinGasPriceInWEI),
+		MinGasTipCapInWEI:        big.NewInt(0).Set(c.MinGasTipCapInWEI),
+		ChainID:                  c.ChainID,
+		EnableActiveMQ:           c.EnableActiveMQ,
+		EnableNotify:             c.EnableNotify,
 	}
 
 	if methodWhitelist := c.MethodWhiteList; len(methodWhitelist) > 0 {
@@ -192,5 +310,19 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		}
 	}
 
+	if localMethods := c.LocalMethods; len(localMethods) > 0 {
+		enc.LocalMethods = make([]string, 0, len(localMethods))
+		for method := range localMethods {
+			enc.LocalMethods = append(enc.LocalMethods, method)
+		}
+	}
+
+	if txTypeAllowList := c.TxTypeAllowList; len(txTypeAllowList) > 0 {
+		enc.TxTypeAllowList = make([]uint8, 0)
+		for txType := range txTypeAllowList {
+			enc.TxTypeAllowList = append(enc.TxTypeAllowList, txType)
+		}
+	}
+
 	return json.Marshal(&enc)
 }
@@ -0,0 +1,24 @@
+package params
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// ContractRule is the function selector policy of a contract
+type ContractRule struct {
+	AllowSelectors map[[4]byte]struct{} // empty means all selectors allowed
+	DenySelectors  map[[4]byte]struct{}
+
+	// Inputs of the methods with argument rules, used to decode calldata
+	Inputs        map[[4]byte]abi.Arguments
+	ArgumentRules map[[4]byte][]ArgumentRule
+}
+
+// ArgumentRule bounds an integer argument of a function call
+type ArgumentRule struct {
+	Index int
+	Min   *big.Int // nil means no limit
+	Max   *big.Int // nil means no limit
+}
@@ -0,0 +1,171 @@
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Redacted replaces the redacted values in logs
+const Redacted = "[REDACTED]"
+
+// LogPolicy controls how requests and responses are logged
+type LogPolicy struct {
+	// MethodLevels is the level to log successful requests of method, keyed
+	// by lower case method name, default info
+	MethodLevels map[string]log.Level
+	// MaxBodySize is the max bytes of request or response body logged, 0 for unlimited
+	MaxBodySize int
+	// SampleRate is the ratio of successful read calls logged
+	SampleRate float64
+	// WriteMethods are the methods always logged, keyed by lower case method name
+	WriteMethods map[string]struct{}
+	// RedactParams is the indexes of params redacted, keyed by lower case method name
+	RedactParams map[string][]int
+	// RedactQuery is the query params redacted in the request URI
+	RedactQuery []string
+}
+
+// DefaultLogPolicy logs everything at info level except the API key
+var DefaultLogPolicy = LogPolicy{
+	SampleRate: 1,
+	WriteMethods: map[string]struct{}{
+		"eth_sendrawtransaction": {},
+		"eth_sendtransaction":    {},
+	},
+	RedactQuery: []string{"apikey"},
+}
+
+var logPolicy = &DefaultLogPolicy
+
+// SetLogPolicy sets the policy of request logs
+func SetLogPolicy(p *LogPolicy) {
+	logPolicy = p
+}
+
+type logMessage struct {
+	Version string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// parseLogBody returns the JSON-RPC messages in body, and whether it is a batch
+func parseLogBody(body string) ([]*logMessage, bool) {
+	body = strings.TrimSpace(body)
+	if strings.HasPrefix(body, "[") {
+		var msgs []*logMessage
+		if err := json.Unmarshal([]byte(body), &msgs); err != nil {
+			return nil, true
+		}
+		return msgs, true
+	}
+	var msg logMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return nil, false
+	}
+	return []*logMessage{&msg}, false
+}
+
+// successLevel returns the level to log the successful request body, and false if not sampled
+func (p *LogPolicy) successLevel(reqBody string) (log.Level, bool) {
+	msgs, _ := parseLogBody(reqBody)
+	level := log.InfoLevel
+	read := len(msgs) > 0
+	for i, msg := range msgs {
+		method := strings.ToLower(msg.Method)
+		l, ok := p.MethodLevels[method]
+		if !ok {
+			l = log.InfoLevel
+		}
+		// the batch is logged at the most severe level of its methods
+		if i == 0 || l < level {
+			level = l
+		}
+		if _, ok := p.WriteMethods[method]; ok {
+			read = false
+		}
+	}
+	if read && p.SampleRate < 1 && rand.Float64() >= p.SampleRate {
+		return level, false
+	}
+	return level, true
+}
+
+// redactBody redacts the params of request body, and truncates to MaxBodySize
+func (p *LogPolicy) redactBody(body string) string {
+	if len(p.RedactParams) > 0 {
+		if msgs, batch := parseLogBody(body); len(msgs) > 0 {
+			redacted := false
+			for _, msg := range msgs {
+				indexes, ok := p.RedactParams[strings.ToLower(msg.Method)]
+				if !ok {
+					continue
+				}
+				var params []json.RawMessage
+				if err := json.Unmarshal(msg.Params, &params); err != nil {
+					continue
+				}
+				for _, i := range indexes {
+					if i >= 0 && i < len(params) {
+						params[i] = json.RawMessage(`"` + Redacted + `"`)
+						redacted = true
+					}
+				}
+				msg.Params, _ = json.Marshal(params)
+			}
+			if redacted {
+				var b []byte
+				if batch {
+					b, _ = json.Marshal(msgs)
+				} else {
+					b, _ = json.Marshal(msgs[0])
+				}
+				body = string(b)
+			}
+		}
+	}
+	return p.truncate(body)
+}
+
+// truncate truncates s to MaxBodySize
+func (p *LogPolicy) truncate(s string) string {
+	if p.MaxBodySize > 0 && len(s) > p.MaxBodySize {
+		return fmt.Sprintf("%s...(%d bytes truncated)", s[:p.MaxBodySize], len(s)-p.MaxBodySize)
+	}
+	return s
+}
+
+// redactURI redacts the RedactQuery params of request URI
+func (p *LogPolicy) redactURI(uri string) string {
+	i := strings.IndexByte(uri, '?')
+	if i < 0 || len(p.RedactQuery) == 0 {
+		return uri
+	}
+	query, err := url.ParseQuery(uri[i+1:])
+	if err != nil {
+		return uri[:i] + "?" + Redacted
+	}
+	redacted := false
+	for _, key := range p.RedactQuery {
+		for k := range query {
+			if strings.EqualFold(k, key) {
+				query[k] = []string{Redacted}
+				redacted = true
+			}
+		}
+	}
+	if !redacted {
+		return uri
+	}
+	return uri[:i] + "?" + query.Encode()
+}
+
+// CaptureLimit returns the max bytes of response body to capture for logs, 0 for unlimited
+func CaptureLimit() int {
+	return logPolicy.MaxBodySize
+}
@@ -0,0 +1,37 @@
+package params
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestLogPolicy(t *testing.T) {
+	p := DefaultLogPolicy
+	p.MaxBodySize = 16
+	p.SampleRate = 0
+	p.MethodLevels = map[string]log.Level{"eth_getlogs": log.DebugLevel}
+	p.RedactParams = map[string][]int{"personal_unlockaccount": {1}}
+
+	if level, sampled := p.successLevel(`{"method":"eth_getLogs","params":[]}`); level != log.DebugLevel || sampled {
+		t.Errorf("eth_getLogs level %s sampled %v, want debug and not sampled", level, sampled)
+	}
+	if level, sampled := p.successLevel(`[{"method":"eth_getLogs"},{"method":"eth_sendRawTransaction"}]`); level != log.InfoLevel || !sampled {
+		t.Errorf("batch level %s sampled %v, want info and sampled", level, sampled)
+	}
+
+	p.MaxBodySize = 0
+	body := p.redactBody(`{"jsonrpc":"2.0","id":1,"method":"personal_unlockAccount","params":["0x01","secret",10]}`)
+	if strings.Contains(body, "secret") || !strings.Contains(body, Redacted) || !strings.Contains(body, "0x01") {
+		t.Errorf("redacted body %s", body)
+	}
+	p.MaxBodySize = 4
+	if s := p.truncate("0x0102"); s != "0x01...(2 bytes truncated)" {
+		t.Errorf("truncated %s", s)
+	}
+
+	if uri := p.redactURI("/rpc?apikey=secret&chain=1"); strings.Contains(uri, "secret") || !strings.Contains(uri, "chain=1") {
+		t.Errorf("redacted uri %s", uri)
+	}
+}
@@ -0,0 +1,81 @@
+package params
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// GetRemoteIP returns the client IP of request
+func GetRemoteIP(r *http.Request) string {
+	return getRemoteIP(r)
+}
+
+// GetAPIKey returns the API key of request from the X-API-Key header or the apikey query
+func GetAPIKey(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("apikey")
+}
+
+// RequestIDHeader is the header of request ID
+const RequestIDHeader = "X-Request-ID"
+
+// MaxRequestIDLength is the max length of request ID honoured
+const MaxRequestIDLength = 128
+
+// GetRequestID returns the request ID of request from the X-Request-ID header,
+// empty if it is not a valid request ID
+func GetRequestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	id := r.Header.Get(RequestIDHeader)
+	if !ValidRequestID(id) {
+		return ""
+	}
+	return id
+}
+
+// ValidRequestID returns whether id is of [A-Za-z0-9._-] and no longer than MaxRequestIDLength
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Authorized returns whether the request has the bearer token, always false if token is empty
+func Authorized(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1
+}
+
+// RequireToken returns the handler serving the requests authorized by the bearer token only
+func RequireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Authorized(r, token) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
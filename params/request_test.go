@@ -0,0 +1,50 @@
+package params
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	h := RequireToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for auth, want := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/tracker/status", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("authorization %q: code %d, want %d", auth, w.Code, want)
+		}
+	}
+
+	if Authorized(httptest.NewRequest(http.MethodGet, "/", nil), "") {
+		t.Error("authorized with empty token")
+	}
+}
+
+func TestGetRequestID(t *testing.T) {
+	for id, want := range map[string]string{
+		"req-1.a_B":              "req-1.a_B",
+		"":                       "",
+		"id with space":          "",
+		"id\nInjected: header":   "",
+		"<script>":               "",
+		strings.Repeat("a", 128): strings.Repeat("a", 128),
+		strings.Repeat("a", 129): "",
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set(RequestIDHeader, id)
+		if got := GetRequestID(r); got != want {
+			t.Errorf("request ID %q got %q, want %q", id, got, want)
+		}
+	}
+}
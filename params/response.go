@@ -16,12 +16,17 @@ func LogAndResponseError(w http.ResponseWriter, r *http.Request, logger *log.Log
 }
 
 func LogAndResponseJSONError(w http.ResponseWriter, r *http.Request, logger *log.Logger, status int, ID json.RawMessage, body string) {
+	LogAndResponseJSONErrorMessage(w, r, logger, status, ID, ErrorInternalError.Error(), body)
+}
+
+// LogAndResponseJSONErrorMessage responses the JSON-RPC error of status with message instead of "Internal Error"
+func LogAndResponseJSONErrorMessage(w http.ResponseWriter, r *http.Request, logger *log.Logger, status int, ID json.RawMessage, message, body string) {
 	out := &JSONErrResponse{
 		Version: JSONRPCVersion,
 		ID:      ID,
 		Error: JSONError{
 			Code:    status,
-			Message: fmt.Sprintf("%s - %d", ErrorInternalError.Error(), status),
+			Message: fmt.Sprintf("%s - %d", message, status),
 		},
 	}
 	buf, err := json.Marshal(out)
@@ -40,10 +45,13 @@ func LogAndResponseOK(w http.ResponseWriter, r *http.Request, logger *log.Logger
 }
 
 func LogRequestInfo(r *http.Request, logger *log.Logger, status int, body string) {
-	if r != nil {
+	level, sampled := logPolicy.successLevel(body)
+	if r != nil && sampled {
+		body = logPolicy.redactBody(body)
 		xForwardedFor := r.Header.Get("X-Forwarded-For")
+		requestID := GetRequestID(r)
 		remoteIP := getRemoteIP(r)
-		request := fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
+		request := fmt.Sprintf("%s %s %s", r.Method, logPolicy.redactURI(r.RequestURI), r.Proto)
 		server := r.Host
 
 		if logger != nil {
@@ -57,17 +65,24 @@ func LogRequestInfo(r *http.Request, logger *log.Logger, status int, body string
 				if xForwardedFor != "" {
 					fields["X-Forwarded-For"] = xForwardedFor
 				}
-				logger.WithFields(fields).Info(body)
+				if requestID != "" {
+					fields["requestId"] = requestID
+				}
+				logger.WithFields(fields).Log(level, body)
 			}()
 		}
 	}
 }
 
 func LogRequestAndResponseInfo(r *http.Request, logger *log.Logger, status int, body, resBody string) {
-	if r != nil {
+	level, sampled := logPolicy.successLevel(body)
+	if r != nil && sampled {
+		body = logPolicy.redactBody(body)
+		resBody = logPolicy.truncate(resBody)
 		xForwardedFor := r.Header.Get("X-Forwarded-For")
+		requestID := GetRequestID(r)
 		remoteIP := getRemoteIP(r)
-		request := fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
+		request := fmt.Sprintf("%s %s %s", r.Method, logPolicy.redactURI(r.RequestURI), r.Proto)
 		server := r.Host
 
 		if logger != nil {
@@ -82,7 +97,10 @@ func LogRequestAndResponseInfo(r *http.Request, logger *log.Logger, status int,
 				if xForwardedFor != "" {
 					fields["X-Forwarded-For"] = xForwardedFor
 				}
-				logger.WithFields(fields).Info(body)
+				if requestID != "" {
+					fields["requestId"] = requestID
+				}
+				logger.WithFields(fields).Log(level, body)
 			}()
 		}
 	}
@@ -90,9 +108,12 @@ func LogRequestAndResponseInfo(r *http.Request, logger *log.Logger, status int,
 
 func LogRequestError(r *http.Request, logger *log.Logger, status int, body string, resBody string) {
 	if r != nil {
+		body = logPolicy.redactBody(body)
+		resBody = logPolicy.truncate(resBody)
 		xForwardedFor := r.Header.Get("X-Forwarded-For")
+		requestID := GetRequestID(r)
 		remoteIP := getRemoteIP(r)
-		request := fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
+		request := fmt.Sprintf("%s %s %s", r.Method, logPolicy.redactURI(r.RequestURI), r.Proto)
 		server := r.Host
 
 		if logger != nil {
@@ -107,6 +128,9 @@ func LogRequestError(r *http.Request, logger *log.Logger, status int, body strin
 				if xForwardedFor != "" {
 					fields["X-Forwarded-For"] = xForwardedFor
 				}
+				if requestID != "" {
+					fields["requestId"] = requestID
+				}
 				logger.WithFields(fields).Error(body)
 			}()
 		}
@@ -115,9 +139,11 @@ func LogRequestError(r *http.Request, logger *log.Logger, status int, body strin
 
 func LogRequestWarn(r *http.Request, logger *log.Logger, status int, body string) {
 	if r != nil {
+		body = logPolicy.redactBody(body)
 		xForwardedFor := r.Header.Get("X-Forwarded-For")
+		requestID := GetRequestID(r)
 		remoteIP := getRemoteIP(r)
-		request := fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
+		request := fmt.Sprintf("%s %s %s", r.Method, logPolicy.redactURI(r.RequestURI), r.Proto)
 		server := r.Host
 
 		if logger != nil {
@@ -131,6 +157,9 @@ func LogRequestWarn(r *http.Request, logger *log.Logger, status int, body string
 				if xForwardedFor != "" {
 					fields["X-Forwarded-For"] = xForwardedFor
 				}
+				if requestID != "" {
+					fields["requestId"] = requestID
+				}
 				logger.WithFields(fields).Warn(body)
 			}()
 		}
@@ -146,7 +175,8 @@ func LogBatchRequestAndResponse(w http.ResponseWriter, r *http.Request, logger *
 	w.Write(resBody)
 }
 
-func LogBatchRequestStructInfo(lr *LogRequest, resBody string) {
+// LogRequestResponse logs the request forwarded to upstream with the response body as the log policy
+func LogRequestResponse(lr *LogRequest, resBody string) {
 	if !lr.IsBatch && len(lr.StatusList) > 0 {
 		LogRequestAndResponseInfo(lr.R, lr.Logger, lr.StatusList[0], string(lr.ReqBody), resBody)
 	} else {
@@ -155,10 +185,21 @@ func LogBatchRequestStructInfo(lr *LogRequest, resBody string) {
 }
 
 func LogBatchRequestInfo(r *http.Request, logger *log.Logger, statusList []int, reqBody, resBody string) {
-	if r != nil {
+	level, sampled := logPolicy.successLevel(reqBody)
+	for _, status := range statusList {
+		if status != StatusOK {
+			// the rejected batch is always logged
+			level, sampled = log.InfoLevel, true
+			break
+		}
+	}
+	if r != nil && sampled {
+		reqBody = logPolicy.redactBody(reqBody)
+		resBody = logPolicy.truncate(resBody)
 		xForwardedFor := r.Header.Get("X-Forwarded-For")
+		requestID := GetRequestID(r)
 		remoteIP := getRemoteIP(r)
-		request := fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
+		request := fmt.Sprintf("%s %s %s", r.Method, logPolicy.redactURI(r.RequestURI), r.Proto)
 		server := r.Host
 
 		if logger != nil {
@@ -175,7 +216,10 @@ func LogBatchRequestInfo(r *http.Request, logger *log.Logger, statusList []int,
 				if xForwardedFor != "" {
 					fields["X-Forwarded-For"] = xForwardedFor
 				}
-				logger.WithFields(fields).Info(reqBody)
+				if requestID != "" {
+					fields["requestId"] = requestID
+				}
+				logger.WithFields(fields).Log(level, reqBody)
 			}()
 		}
 	}
@@ -41,13 +41,36 @@ const (
 	StatusIPCDialError             = 434
 	StatusIPCWriteError            = 435
 	StatusIPCReadError             = 436
+	StatusTxTypeNotAllowed         = 437
+	StatusNotEIP155Protected       = 438
+	StatusAccessListTooLarge       = 439
 
 	StatusLuaInitError      = 440
 	StatusLuaCallError      = 441
 	StatusLuaReturnError    = 442
 	StatusLuaFileNotDoError = 443
 
+	StatusCalldataTooLarge        = 450
+	StatusSelectorNotAllowed      = 451
+	StatusArgumentOutOfRange      = 452
+	StatusToAddressNotWhitelist   = 453
+	StatusToAddressNotContract    = 454
+	StatusToAddressNotEOA         = 455
+	StatusGetCodeError            = 456
+	StatusStateOverrideNotAllowed = 457
+	StatusCallArgsError           = 458
+	StatusLogsRangeTooLarge       = 459
+	StatusLogsFilterTooLarge      = 460
+	StatusLogsResultTooLarge      = 461
+	StatusGetLogsError            = 462
+	StatusQuarantineError         = 463
+	StatusVelocityLimitExceeded   = 464
+	StatusReadOnly                = 465
+	StatusLoadShed                = 466
+
 	StatusInternalError = 500
+	StatusUpstreamError = 502
+	StatusCircuitOpen   = 503
 )
 
 var statusText = map[int]string{
@@ -69,7 +92,7 @@ var statusText = map[int]string{
 	StatusIllegalChainID:           "illegal chainID",
 	StatusSignatureVerifyFailed:    "signature verification failed",
 	StatusGasPriceError:            "gas price is less than the minimum value",
-	StatusSecp256r1HalfN:           "signature s is big than secp256r1HalfN",
+	StatusSecp256r1HalfN:           "signature s is larger than secp256r1HalfN",
 	StatusTransactionHashNil:       "empty transaction hash",
 	StatusTransactionHashBlackList: "black list transaction hash",
 	StatusToAddressBlackList:       "black list to address",
@@ -81,13 +104,36 @@ var statusText = map[int]string{
 	StatusIPCDialError:             "IPC dial error",
 	StatusIPCWriteError:            "IPC write error",
 	StatusIPCReadError:             "IPC read error",
+	StatusTxTypeNotAllowed:         "transaction type not allowed",
+	StatusNotEIP155Protected:       "transaction not replay protected",
+	StatusAccessListTooLarge:       "access list too large",
 
 	StatusLuaInitError:      "lua init error",
 	StatusLuaCallError:      "lua call error",
 	StatusLuaReturnError:    "lua return error",
 	StatusLuaFileNotDoError: "lua do file error",
 
+	StatusCalldataTooLarge:        "calldata too large",
+	StatusSelectorNotAllowed:      "function selector not allowed",
+	StatusArgumentOutOfRange:      "function argument out of range",
+	StatusToAddressNotWhitelist:   "to address not in whitelist",
+	StatusToAddressNotContract:    "to address not contract",
+	StatusToAddressNotEOA:         "to address not externally owned account",
+	StatusGetCodeError:            "get code of to address error",
+	StatusStateOverrideNotAllowed: "state override not allowed",
+	StatusCallArgsError:           "invalid call arguments",
+	StatusLogsRangeTooLarge:       "block range of logs too large",
+	StatusLogsFilterTooLarge:      "too many addresses or topics of logs",
+	StatusLogsResultTooLarge:      "result of logs too large",
+	StatusGetLogsError:            "get logs error",
+	StatusQuarantineError:         "hold transaction in quarantine error",
+	StatusVelocityLimitExceeded:   "sender value velocity limit exceeded",
+	StatusReadOnly:                "the guard is read-only",
+	StatusLoadShed:                "request shed by overload",
+
 	StatusInternalError: "Internal Error",
+	StatusUpstreamError: "upstream error",
+	StatusCircuitOpen:   "upstream circuit open",
 }
 
 var statusError = map[int]error{
@@ -117,12 +163,35 @@ var statusError = map[int]error{
 	StatusIPCDialError:             errors.New(statusText[StatusIPCDialError]),
 	StatusIPCWriteError:            errors.New(statusText[StatusIPCWriteError]),
 	StatusIPCReadError:             errors.New(statusText[StatusIPCReadError]),
+	StatusTxTypeNotAllowed:         errors.New(statusText[StatusTxTypeNotAllowed]),
+	StatusNotEIP155Protected:       errors.New(statusText[StatusNotEIP155Protected]),
+	StatusAccessListTooLarge:       errors.New(statusText[StatusAccessListTooLarge]),
 
 	StatusLuaInitError:   errors.New(statusText[StatusLuaInitError]),
 	StatusLuaCallError:   errors.New(statusText[StatusLuaCallError]),
 	StatusLuaReturnError: errors.New(statusText[StatusLuaReturnError]),
 
+	StatusCalldataTooLarge:        errors.New(statusText[StatusCalldataTooLarge]),
+	StatusSelectorNotAllowed:      errors.New(statusText[StatusSelectorNotAllowed]),
+	StatusArgumentOutOfRange:      errors.New(statusText[StatusArgumentOutOfRange]),
+	StatusToAddressNotWhitelist:   errors.New(statusText[StatusToAddressNotWhitelist]),
+	StatusToAddressNotContract:    errors.New(statusText[StatusToAddressNotContract]),
+	StatusToAddressNotEOA:         errors.New(statusText[StatusToAddressNotEOA]),
+	StatusGetCodeError:            errors.New(statusText[StatusGetCodeError]),
+	StatusStateOverrideNotAllowed: errors.New(statusText[StatusStateOverrideNotAllowed]),
+	StatusCallArgsError:           errors.New(statusText[StatusCallArgsError]),
+	StatusLogsRangeTooLarge:       errors.New(statusText[StatusLogsRangeTooLarge]),
+	StatusLogsFilterTooLarge:      errors.New(statusText[StatusLogsFilterTooLarge]),
+	StatusLogsResultTooLarge:      errors.New(statusText[StatusLogsResultTooLarge]),
+	StatusGetLogsError:            errors.New(statusText[StatusGetLogsError]),
+	StatusQuarantineError:         errors.New(statusText[StatusQuarantineError]),
+	StatusVelocityLimitExceeded:   errors.New(statusText[StatusVelocityLimitExceeded]),
+	StatusReadOnly:                errors.New(statusText[StatusReadOnly]),
+	StatusLoadShed:                errors.New(statusText[StatusLoadShed]),
+
 	StatusInternalError: errors.New(statusText[StatusInternalError]),
+	StatusUpstreamError: errors.New(statusText[StatusUpstreamError]),
+	StatusCircuitOpen:   errors.New(statusText[StatusCircuitOpen]),
 }
 
 var (
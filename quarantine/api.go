@@ -0,0 +1,106 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// API serves the admin API of queue under /quarantine/, authorized by the bearer token:
+//
+//	GET  /quarantine/tx                list the held transactions
+//	GET  /quarantine/tx/<hash>         get the held transaction
+//	POST /quarantine/tx/<hash>/approve forward the held transaction to upstream
+//	POST /quarantine/tx/<hash>/deny    drop the held transaction
+type API struct {
+	Queue *Queue
+	Token string
+}
+
+// NewAPI returns the admin API of queue, the token must not be empty
+func NewAPI(q *Queue, token string) *API {
+	return &API{Queue: q, Token: token}
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !params.Authorized(r, api.Token) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/quarantine/tx"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		entries, err := api.Queue.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		hash, ok := parseHash(parts[0])
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid transaction hash")
+			return
+		}
+		e, err := api.Queue.Get(hash)
+		writeEntry(w, e, err)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		hash, ok := parseHash(parts[0])
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid transaction hash")
+			return
+		}
+		switch parts[1] {
+		case "approve":
+			e, err := api.Queue.Approve(hash)
+			writeEntry(w, e, err)
+		case "deny":
+			e, err := api.Queue.Deny(hash)
+			writeEntry(w, e, err)
+		default:
+			writeError(w, http.StatusNotFound, "not found")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func parseHash(s string) (common.Hash, bool) {
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != common.HashLength {
+		return common.Hash{}, false
+	}
+	return common.BytesToHash(b), true
+}
+
+func writeEntry(w http.ResponseWriter, e *Entry, err error) {
+	switch err {
+	case nil:
+		writeJSON(w, http.StatusOK, e)
+	case ErrNotFound:
+		writeError(w, http.StatusNotFound, err.Error())
+	case ErrApproving:
+		writeError(w, http.StatusConflict, err.Error())
+	case ErrReadOnly:
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		writeError(w, http.StatusBadGateway, err.Error())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,460 @@
+package quarantine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/newtonproject/newchain-guard/audit"
+	"github.com/newtonproject/newchain-guard/journal"
+	"github.com/newtonproject/newchain-guard/maintenance"
+	"github.com/newtonproject/newchain-guard/notify"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/router"
+	"github.com/newtonproject/newchain-guard/tracker"
+	"github.com/newtonproject/newchain-guard/velocity"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var entryPrefix = []byte("q") // entryPrefix + hash -> Entry in JSON
+
+var (
+	DefaultExpire   = 24 * time.Hour
+	expireInterval  = time.Minute
+	forwardTimeout  = 10 * time.Second
+	ErrNotFound     = errors.New("transaction not in quarantine")
+	ErrApproving    = errors.New("transaction being approved")
+	ErrReadOnly     = errors.New("transaction not forwarded as the guard is read-only for maintenance")
+	errInvalidEntry = errors.New("invalid quarantine entry")
+)
+
+// The decision of held transaction
+const (
+	DecisionHeld     = "held"
+	DecisionApproved = "approved"
+	DecisionDenied   = "denied"
+	DecisionExpired  = "expired"
+)
+
+// Backend is the upstream node to forward the approved transactions to
+type Backend interface {
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// routedBackend sends the transactions to the upstream routed for eth_sendRawTransaction,
+// or rawURL if the router not enabled
+type routedBackend struct {
+	rawURL string
+
+	mu      sync.Mutex
+	clients map[string]*ethclient.Client
+}
+
+// NewRoutedBackend returns the backend of the upstreams routed for eth_sendRawTransaction, Default rawURL
+func NewRoutedBackend(rawURL string) Backend {
+	return &routedBackend{rawURL: rawURL, clients: make(map[string]*ethclient.Client)}
+}
+
+func (b *routedBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	rawURL := b.rawURL
+	if rt := router.Default(); rt != nil {
+		rawURL = rt.Route("eth_sendRawTransaction", nil).Next()
+	}
+
+	b.mu.Lock()
+	client, ok := b.clients[rawURL]
+	if !ok {
+		var err error
+		if client, err = ethclient.DialContext(ctx, rawURL); err != nil {
+			b.mu.Unlock()
+			return err
+		}
+		b.clients[rawURL] = client
+	}
+	b.mu.Unlock()
+
+	return client.SendTransaction(ctx, tx)
+}
+
+// Rule holds the transaction matched all the fields set
+type Rule struct {
+	Name     string
+	From     *common.Address
+	To       *common.Address
+	Selector []byte   // the first 4 bytes of data
+	MinValue *big.Int // hold if value is larger than MinValue
+}
+
+// Match returns whether the transaction sent from matches the rule
+func (rule *Rule) Match(tx *types.Transaction, from common.Address) bool {
+	if rule.From == nil && rule.To == nil && rule.Selector == nil && rule.MinValue == nil {
+		return false
+	}
+	if rule.From != nil && *rule.From != from {
+		return false
+	}
+	if rule.To != nil && (tx.To() == nil || *tx.To() != *rule.To) {
+		return false
+	}
+	if rule.Selector != nil && !bytes.HasPrefix(tx.Data(), rule.Selector) {
+		return false
+	}
+	if rule.MinValue != nil && tx.Value().Cmp(rule.MinValue) <= 0 {
+		return false
+	}
+	return true
+}
+
+// Entry is a transaction held in quarantine
+type Entry struct {
+	Hash      string    `json:"hash"`
+	From      string    `json:"from"`
+	To        string    `json:"to,omitempty"`
+	Value     string    `json:"value"`
+	Nonce     uint64    `json:"nonce"`
+	Raw       string    `json:"raw"`
+	Reason    string    `json:"reason"`
+	ClientIP  string    `json:"clientIP,omitempty"`
+	APIKey    string    `json:"apiKey,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	Time      time.Time `json:"time"`
+	Expire    time.Time `json:"expire"`
+}
+
+// Queue holds the transactions matched rules in LevelDB until approved,
+// denied or expired, the approved transactions are forwarded to backend
+type Queue struct {
+	db      *leveldb.DB
+	backend Backend
+	rules   []Rule
+	expire  time.Duration
+
+	mu        sync.Mutex
+	approving map[common.Hash]bool // forwarding to backend, not denied or expired meanwhile
+	quit      chan struct{}
+}
+
+// Open opens the queue at path, or an in-memory queue if path is empty
+func Open(path string, backend Backend, rules []Rule, expire time.Duration) (*Queue, error) {
+	if backend == nil {
+		return nil, errors.New("quarantine backend not set")
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("quarantine rules not set")
+	}
+	if expire <= 0 {
+		expire = DefaultExpire
+	}
+
+	var (
+		db  *leveldb.DB
+		err error
+	)
+	if path == "" {
+		db, err = leveldb.Open(storage.NewMemStorage(), nil)
+	} else {
+		db, err = leveldb.OpenFile(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Queue{
+		db:        db,
+		backend:   backend,
+		rules:     rules,
+		expire:    expire,
+		approving: make(map[common.Hash]bool),
+		quit:      make(chan struct{}),
+	}, nil
+}
+
+func entryKey(hash common.Hash) []byte {
+	return append(append([]byte{}, entryPrefix...), hash.Bytes()...)
+}
+
+// Match returns the name of the first rule the transaction matched
+func (q *Queue) Match(tx *types.Transaction, from common.Address) (string, bool) {
+	for i := range q.rules {
+		if q.rules[i].Match(tx, from) {
+			return q.rules[i].Name, true
+		}
+	}
+	return "", false
+}
+
+// Hold holds the transaction sent from in request r for reason, the entry held already is returned if any
+func (q *Queue) Hold(r *http.Request, tx *types.Transaction, from common.Address, reason string) (*Entry, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if e, err := q.get(tx.Hash()); err == nil {
+		return e, nil
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+
+	now := time.Now()
+	e := &Entry{
+		Hash:      tx.Hash().Hex(),
+		From:      from.Hex(),
+		Value:     tx.Value().String(),
+		Nonce:     tx.Nonce(),
+		Raw:       hexutil.Encode(raw),
+		Reason:    reason,
+		ClientIP:  params.GetRemoteIP(r),
+		APIKey:    params.GetAPIKey(r),
+		RequestID: params.GetRequestID(r),
+		Time:      now,
+		Expire:    now.Add(q.expire),
+	}
+	if tx.To() != nil {
+		e.To = tx.To().Hex()
+	}
+	value, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.db.Put(entryKey(tx.Hash()), value, nil); err != nil {
+		return nil, err
+	}
+	decide(e, DecisionHeld)
+
+	return e, nil
+}
+
+func (q *Queue) get(hash common.Hash) (*Entry, error) {
+	value, err := q.db.Get(entryKey(hash), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	e := new(Entry)
+	if err := json.Unmarshal(value, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Get returns the entry of hash
+func (q *Queue) Get(hash common.Hash) (*Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.get(hash)
+}
+
+// List returns the held entries in order of time
+func (q *Queue) List() ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	iter := q.db.NewIterator(util.BytesPrefix(entryPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		e := new(Entry)
+		if err := json.Unmarshal(iter.Value(), e); err != nil {
+			log.Warnf("Quarantine decode entry %x error: %v", iter.Key()[len(entryPrefix):], err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
+
+// Len returns the number of held transactions
+func (q *Queue) Len() int {
+	n := 0
+	iter := q.db.NewIterator(util.BytesPrefix(entryPrefix), nil)
+	for iter.Next() {
+		n++
+	}
+	iter.Release()
+	return n
+}
+
+// Approve forwards the held transaction of hash to backend, and removes it if forwarded,
+// the queue is not locked while forwarding
+func (q *Queue) Approve(hash common.Hash) (*Entry, error) {
+	// kept until the maintenance ends
+	if m := maintenance.Default(); m != nil && m.Blocked("eth_sendRawTransaction", time.Now()) {
+		return nil, ErrReadOnly
+	}
+
+	q.mu.Lock()
+	e, err := q.get(hash)
+	if err == nil && q.approving[hash] {
+		err = ErrApproving
+	}
+	if err != nil {
+		q.mu.Unlock()
+		return nil, err
+	}
+	q.approving[hash] = true
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		delete(q.approving, hash)
+		q.mu.Unlock()
+	}()
+
+	raw, err := hexutil.Decode(e.Raw)
+	if err != nil {
+		return nil, errInvalidEntry
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, errInvalidEntry
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+	defer cancel()
+	if err := q.backend.SendTransaction(ctx, tx); err != nil {
+		return nil, fmt.Errorf("forward error: %v", err)
+	}
+	q.mu.Lock()
+	err = q.db.Delete(entryKey(hash), nil)
+	q.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	from := common.HexToAddress(e.From)
+	tracker.Track(tx.Hash(), from, tx.To())
+	journal.Add(tx, from)
+	decide(e, DecisionApproved)
+
+	return e, nil
+}
+
+// Deny removes the held transaction of hash without forwarding
+func (q *Queue) Deny(hash common.Hash) (*Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.approving[hash] {
+		return nil, ErrApproving
+	}
+	e, err := q.get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.db.Delete(entryKey(hash), nil); err != nil {
+		return nil, err
+	}
+	release(e)
+	decide(e, DecisionDenied)
+
+	return e, nil
+}
+
+// expireEntries removes the entries expired before now
+func (q *Queue) expireEntries(now time.Time) {
+	entries, err := q.List()
+	if err != nil {
+		log.Errorln("Quarantine read error:", err)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range entries {
+		if now.Before(e.Expire) || q.approving[common.HexToHash(e.Hash)] {
+			continue
+		}
+		if err := q.db.Delete(entryKey(common.HexToHash(e.Hash)), nil); err != nil {
+			log.Errorf("Quarantine remove %s error: %v", e.Hash, err)
+			continue
+		}
+		release(e)
+		decide(e, DecisionExpired)
+	}
+}
+
+// Run expires the held transactions until Close
+func (q *Queue) Run() {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.expireEntries(time.Now())
+		case <-q.quit:
+			return
+		}
+	}
+}
+
+// Close stops Run and closes the queue
+func (q *Queue) Close() error {
+	close(q.quit)
+	return q.db.Close()
+}
+
+// release uncounts the transaction of entry not forwarded in the velocity limits
+func release(e *Entry) {
+	if l := velocity.Default(); l != nil {
+		l.Release(common.HexToAddress(e.From), common.HexToHash(e.Hash))
+	}
+}
+
+// decide audits and notifies the decision of entry
+func decide(e *Entry, decision string) {
+	log.Infof("Quarantine %s %s", decision, e.Hash)
+	audit.Add(nil, nil, &audit.Record{
+		Time:      time.Now(),
+		RequestID: e.RequestID,
+		ClientIP:  e.ClientIP,
+		APIKey:    e.APIKey,
+		TxHash:    e.Hash,
+		From:      e.From,
+		To:        e.To,
+		Nonce:     e.Nonce,
+		Decision:  decision,
+		Reason:    e.Reason,
+	}, false)
+	notify.AddEvent(notify.NewEvent(notify.EventQuarantine, e.ClientIP, map[string]interface{}{
+		"decision": decision,
+		"hash":     e.Hash,
+		"from":     e.From,
+		"to":       e.To,
+		"value":    e.Value,
+		"reason":   e.Reason,
+	}))
+}
+
+var std *Queue
+
+// Enable sets the queue holding the transactions
+func Enable(q *Queue) {
+	std = q
+}
+
+// Default returns the queue enabled, or nil
+func Default() *Queue {
+	return std
+}
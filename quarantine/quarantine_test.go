@@ -0,0 +1,323 @@
+package quarantine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/newtonproject/newchain-guard/maintenance"
+	"github.com/newtonproject/newchain-guard/router"
+	"github.com/newtonproject/newchain-guard/velocity"
+)
+
+type fakeBackend struct {
+	mu    sync.Mutex
+	sent  []common.Hash
+	err   error
+	block chan struct{} // SendTransaction waits until closed if set
+}
+
+func (b *fakeBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if b.block != nil {
+		<-b.block
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.sent = append(b.sent, tx.Hash())
+	return nil
+}
+
+func newTx(nonce uint64, to common.Address, value int64, data []byte) *types.Transaction {
+	return types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Gas: 21000, GasPrice: big.NewInt(1), Value: big.NewInt(value), Data: data})
+}
+
+func TestRuleMatch(t *testing.T) {
+	from := common.HexToAddress("0x2048")
+	to := common.HexToAddress("0x1024")
+	other := common.HexToAddress("0x4096")
+
+	tests := []struct {
+		name string
+		rule Rule
+		tx   *types.Transaction
+		want bool
+	}{
+		{"empty", Rule{}, newTx(0, to, 100, nil), false},
+		{"value above", Rule{MinValue: big.NewInt(10)}, newTx(0, to, 100, nil), true},
+		{"value equal", Rule{MinValue: big.NewInt(100)}, newTx(0, to, 100, nil), false},
+		{"to", Rule{To: &to}, newTx(0, to, 0, nil), true},
+		{"to other", Rule{To: &other}, newTx(0, to, 0, nil), false},
+		{"from", Rule{From: &from}, newTx(0, to, 0, nil), true},
+		{"from other", Rule{From: &other}, newTx(0, to, 0, nil), false},
+		{"selector", Rule{Selector: []byte{0xa9, 0x05, 0x9c, 0xbb}}, newTx(0, to, 0, []byte{0xa9, 0x05, 0x9c, 0xbb, 0x00}), true},
+		{"selector other", Rule{Selector: []byte{0xa9, 0x05, 0x9c, 0xbb}}, newTx(0, to, 0, []byte{0x09, 0x5e, 0xa7, 0xb3}), false},
+		{"all fields", Rule{To: &to, MinValue: big.NewInt(10)}, newTx(0, to, 1, nil), false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Match(tt.tx, from); got != tt.want {
+			t.Errorf("%s: match %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	backend := &fakeBackend{}
+	to := common.HexToAddress("0x1024")
+	from := common.HexToAddress("0x2048")
+	q, err := Open("", backend, []Rule{{Name: "value", MinValue: big.NewInt(10)}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if _, ok := q.Match(newTx(0, to, 1, nil), from); ok {
+		t.Error("matched the transaction below the value")
+	}
+	approved, denied, expired := newTx(0, to, 100, nil), newTx(1, to, 100, nil), newTx(2, to, 100, nil)
+	for _, tx := range []*types.Transaction{approved, denied, expired} {
+		reason, ok := q.Match(tx, from)
+		if !ok || reason != "value" {
+			t.Fatalf("match %s %v, want value", reason, ok)
+		}
+		if _, err := q.Hold(httptest.NewRequest(http.MethodPost, "/", nil), tx, from, reason); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := q.Hold(httptest.NewRequest(http.MethodPost, "/", nil), approved, from, "value"); err != nil {
+		t.Fatal(err)
+	}
+	if n := q.Len(); n != 3 {
+		t.Fatalf("quarantine len %d, want 3", n)
+	}
+	if len(backend.sent) != 0 {
+		t.Fatalf("sent %d before approved", len(backend.sent))
+	}
+
+	m, err := maintenance.New(nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetReadOnly(true, "upgrade")
+	maintenance.Enable(m)
+	if _, err := q.Approve(approved.Hash()); err != ErrReadOnly {
+		t.Errorf("approve error %v, want %v for maintenance", err, ErrReadOnly)
+	}
+	maintenance.Enable(nil)
+
+	backend.err = errors.New("upstream down")
+	if _, err := q.Approve(approved.Hash()); err == nil {
+		t.Error("approved with the upstream down")
+	}
+	if n := q.Len(); n != 3 {
+		t.Fatalf("quarantine len %d, want 3 with the failed approval kept", n)
+	}
+	backend.err = nil
+	if _, err := q.Approve(approved.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.sent) != 1 || backend.sent[0] != approved.Hash() {
+		t.Errorf("sent %v, want the approved", backend.sent)
+	}
+
+	if _, err := q.Deny(denied.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Deny(denied.Hash()); err != ErrNotFound {
+		t.Errorf("deny twice error %v, want %v", err, ErrNotFound)
+	}
+	if _, err := q.Approve(denied.Hash()); err != ErrNotFound {
+		t.Errorf("approve denied error %v, want %v", err, ErrNotFound)
+	}
+
+	q.expireEntries(time.Now())
+	if n := q.Len(); n != 1 {
+		t.Fatalf("quarantine len %d, want 1 before expired", n)
+	}
+	q.expireEntries(time.Now().Add(2 * time.Hour))
+	if n := q.Len(); n != 0 {
+		t.Fatalf("quarantine len %d, want 0 after expired", n)
+	}
+	if len(backend.sent) != 1 {
+		t.Errorf("sent %d, want only the approved", len(backend.sent))
+	}
+}
+
+func TestQueueRelease(t *testing.T) {
+	l, err := velocity.Open("", []velocity.Limit{{Window: time.Hour, MaxCount: 2}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	velocity.Enable(l)
+	defer velocity.Enable(nil)
+
+	backend := &fakeBackend{block: make(chan struct{})}
+	to := common.HexToAddress("0x1024")
+	from := common.HexToAddress("0x2048")
+	q, err := Open("", backend, []Rule{{Name: "to", To: &to}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	approved, denied, expired := newTx(0, to, 0, nil), newTx(1, to, 0, nil), newTx(2, to, 0, nil)
+	for _, tx := range []*types.Transaction{approved, denied, expired} {
+		l.Allow(from, tx.Hash(), tx.Value(), time.Now())
+		if _, err := q.Hold(httptest.NewRequest(http.MethodPost, "/", nil), tx, from, "to"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the queue is not locked while forwarding, and the transaction approving is kept
+	done := make(chan error, 1)
+	go func() {
+		_, err := q.Approve(approved.Hash())
+		done <- err
+	}()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		q.mu.Lock()
+		approving := q.approving[approved.Hash()]
+		q.mu.Unlock()
+		if approving {
+			break
+		}
+	}
+	if _, err := q.Deny(approved.Hash()); err != ErrApproving {
+		t.Errorf("deny approving error %v, want %v", err, ErrApproving)
+	}
+	if _, err := q.Approve(approved.Hash()); err != ErrApproving {
+		t.Errorf("approve twice error %v, want %v", err, ErrApproving)
+	}
+	q.expireEntries(time.Now().Add(2 * time.Hour))
+	if _, err := q.Get(approved.Hash()); err != nil {
+		t.Errorf("approving transaction expired: %v", err)
+	}
+	close(backend.block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the denied and expired transactions are uncounted
+	if _, ok := l.Allow(from, common.HexToHash("0x01"), big.NewInt(0), time.Now()); !ok {
+		t.Error("velocity not released by deny and expiry")
+	}
+	if _, ok := l.Allow(from, common.HexToHash("0x02"), big.NewInt(0), time.Now()); ok {
+		t.Error("velocity of the approved transaction released")
+	}
+}
+
+func TestRoutedBackend(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]int)
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				ID     json.RawMessage `json:"id"`
+				Method string          `json:"method"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			received[name+" "+req.Method]++
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x%064x"}`, req.ID, 1)
+		}))
+	}
+	def, txs := upstream("default"), upstream("tx")
+	defer def.Close()
+	defer txs.Close()
+
+	tx := newTx(0, common.HexToAddress("0x1024"), 0, nil)
+	backend := NewRoutedBackend(def.URL)
+	if err := backend.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := router.New(map[string][]string{
+		router.DefaultPool: {def.URL},
+		"tx":               {txs.URL},
+	}, []router.Rule{{Method: "eth_sendRawTransaction", Pool: "tx"}}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.Enable(rt)
+	defer router.Enable(nil)
+	if err := backend.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	if received["default eth_sendRawTransaction"] != 1 || received["tx eth_sendRawTransaction"] != 1 {
+		t.Errorf("received %v, want one by default and one routed", received)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	backend := &fakeBackend{}
+	to := common.HexToAddress("0x1024")
+	q, err := Open("", backend, []Rule{{Name: "to", To: &to}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	tx := newTx(0, to, 0, nil)
+	if _, err := q.Hold(httptest.NewRequest(http.MethodPost, "/", nil), tx, common.HexToAddress("0x2048"), "to"); err != nil {
+		t.Fatal(err)
+	}
+
+	api := NewAPI(q, "secret")
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/quarantine/tx", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("list without token status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := do(http.MethodGet, "/quarantine/tx", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("list with wrong token status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w := do(http.MethodGet, "/quarantine/tx", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status %d, want %d", w.Code, http.StatusOK)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Hash != tx.Hash().Hex() || entries[0].Reason != "to" {
+		t.Fatalf("list %+v, want the held transaction", entries)
+	}
+
+	if w := do(http.MethodGet, "/quarantine/tx/0x1234", "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("get invalid hash status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := do(http.MethodGet, "/quarantine/tx/"+tx.Hash().Hex(), "secret"); w.Code != http.StatusOK {
+		t.Errorf("get status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := do(http.MethodPost, "/quarantine/tx/"+tx.Hash().Hex()+"/approve", "secret"); w.Code != http.StatusOK {
+		t.Errorf("approve status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := do(http.MethodPost, "/quarantine/tx/"+tx.Hash().Hex()+"/deny", "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("deny approved status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if len(backend.sent) != 1 || backend.sent[0] != tx.Hash() {
+		t.Errorf("sent %v, want the approved", backend.sent)
+	}
+}
@@ -0,0 +1,121 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// Group is the messages of request routed to the same pool
+type Group struct {
+	Pool *Pool
+	Body []byte // body to forward, a batch of the messages if the request is batch
+
+	indexes []int             // indexes of messages in the request
+	ids     []json.RawMessage // ids of messages, nil for notification
+}
+
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Plan groups the messages of request by pool in order of first appearance,
+// and returns the number of messages, only the batch may have more than one group
+func (r *Router) Plan(body []byte) ([]*Group, int) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		var msg message
+		json.Unmarshal(trimmed, &msg)
+		return []*Group{{Pool: r.Route(msg.Method, msg.Params), Body: body, indexes: []int{0}, ids: []json.RawMessage{msg.ID}}}, 1
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(trimmed, &raws); err != nil {
+		return []*Group{{Pool: r.pools[DefaultPool], Body: body}}, 0
+	}
+
+	var (
+		groups []*Group
+		byPool = make(map[*Pool]*Group)
+		msgs   = make(map[*Group][]json.RawMessage)
+	)
+	for i, raw := range raws {
+		var msg message
+		json.Unmarshal(raw, &msg)
+		pool := r.Route(msg.Method, msg.Params)
+		g, ok := byPool[pool]
+		if !ok {
+			g = &Group{Pool: pool}
+			byPool[pool] = g
+			groups = append(groups, g)
+		}
+		g.indexes = append(g.indexes, i)
+		g.ids = append(g.ids, msg.ID)
+		msgs[g] = append(msgs[g], raw)
+	}
+	if len(groups) == 1 {
+		groups[0].Body = body
+		return groups, len(raws)
+	}
+	for _, g := range groups {
+		g.Body, _ = json.Marshal(msgs[g])
+	}
+
+	return groups, len(raws)
+}
+
+// Merge reassembles the responses of groups in order of the messages of request,
+// the nil response means the group failed, and errors are responded for its messages
+func Merge(groups []*Group, size int, responses [][]byte) []byte {
+	results := make([]json.RawMessage, size)
+	for i, g := range groups {
+		// the responses of a batch may be in any order, match by id
+		byID := make(map[string][]json.RawMessage)
+		var raws []json.RawMessage
+		if err := json.Unmarshal(responses[i], &raws); err == nil {
+			for _, raw := range raws {
+				var msg message
+				if err := json.Unmarshal(raw, &msg); err != nil {
+					continue
+				}
+				id := string(bytes.TrimSpace(msg.ID))
+				byID[id] = append(byID[id], raw)
+			}
+		}
+
+		for j, index := range g.indexes {
+			if g.ids[j] == nil {
+				// notification has no response
+				continue
+			}
+			id := string(bytes.TrimSpace(g.ids[j]))
+			if matched := byID[id]; len(matched) > 0 {
+				results[index] = matched[0]
+				byID[id] = matched[1:]
+				continue
+			}
+			results[index], _ = json.Marshal(params.JSONErrResponse{
+				Version: params.JSONRPCVersion,
+				ID:      g.ids[j],
+				Error: params.JSONError{
+					Code:    params.StatusUpstreamError,
+					Message: fmt.Sprintf("%s - %d", params.GetStatusText(params.StatusUpstreamError), params.StatusUpstreamError),
+				},
+			})
+		}
+	}
+
+	merged := make([]json.RawMessage, 0, size)
+	for _, result := range results {
+		if result != nil {
+			merged = append(merged, result)
+		}
+	}
+	b, _ := json.Marshal(merged)
+
+	return append(b, '\n')
+}
@@ -0,0 +1,277 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultPool is the name of pool of the RawURL, routed to if no rule matches
+const DefaultPool = "default"
+
+// Block kinds of rule
+const (
+	BlockLatest  = "latest"  // the block tags, or the number within ArchiveDepth of head
+	BlockArchive = "archive" // earliest, block hash, or the number older than ArchiveDepth of head
+)
+
+// DefaultArchiveDepth is the default number of recent blocks not archive
+const DefaultArchiveDepth = 128
+
+const (
+	headTTL     = time.Second
+	headTimeout = 5 * time.Second
+)
+
+// Backend is the node to get the head block number from
+type Backend interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// Pool is the named upstreams, requests are balanced by round robin
+type Pool struct {
+	Name string
+	URLs []string
+
+	next uint32
+}
+
+// Next returns the upstream of next request
+func (p *Pool) Next() string {
+	n := atomic.AddUint32(&p.next, 1)
+	return p.URLs[(n-1)%uint32(len(p.URLs))]
+}
+
+// Rule routes the method to pool, the first matched rule is applied
+type Rule struct {
+	Method string // method name, "*" for all methods, or prefix such as "debug_*"
+	Block  string // BlockLatest, BlockArchive or empty for any
+	Pool   string
+}
+
+func (rule *Rule) matchMethod(method string) bool {
+	if rule.Method == "*" {
+		return true
+	}
+	if strings.HasSuffix(rule.Method, "*") {
+		return strings.HasPrefix(method, strings.TrimSuffix(rule.Method, "*"))
+	}
+	return rule.Method == method
+}
+
+// Router routes the requests to pools by method and block
+type Router struct {
+	pools        map[string]*Pool
+	rules        []Rule
+	archiveDepth uint64
+	backend      Backend
+
+	mu         sync.Mutex
+	head       uint64
+	headUpdate time.Time
+}
+
+// New returns a Router, the pools must include DefaultPool,
+// and the backend is used to get the head if any rule routes by block
+func New(pools map[string][]string, rules []Rule, archiveDepth uint64, backend Backend) (*Router, error) {
+	r := &Router{
+		pools:        make(map[string]*Pool, len(pools)),
+		archiveDepth: archiveDepth,
+		backend:      backend,
+	}
+	for name, urls := range pools {
+		if len(urls) == 0 {
+			return nil, fmt.Errorf("pool %s has no upstream", name)
+		}
+		name = strings.ToLower(name)
+		r.pools[name] = &Pool{Name: name, URLs: urls}
+	}
+	if _, ok := r.pools[DefaultPool]; !ok {
+		return nil, errors.New("default pool not set")
+	}
+
+	for _, rule := range rules {
+		rule.Pool = strings.ToLower(rule.Pool)
+		if rule.Method == "" {
+			return nil, errors.New("rule without method")
+		}
+		if _, ok := r.pools[rule.Pool]; !ok {
+			return nil, fmt.Errorf("pool %s of rule %s not found", rule.Pool, rule.Method)
+		}
+		switch rule.Block {
+		case "", BlockLatest, BlockArchive:
+			if rule.Block != "" && backend == nil {
+				return nil, errors.New("backend required to route by block")
+			}
+		default:
+			return nil, fmt.Errorf("block %s of rule %s not supported", rule.Block, rule.Method)
+		}
+		r.rules = append(r.rules, rule)
+	}
+
+	return r, nil
+}
+
+// Pool returns the pool of name
+func (r *Router) Pool(name string) *Pool {
+	return r.pools[name]
+}
+
+// Route returns the pool of method with params
+func (r *Router) Route(method string, args json.RawMessage) *Pool {
+	block := ""
+	for _, rule := range r.rules {
+		if !rule.matchMethod(method) {
+			continue
+		}
+		if rule.Block != "" {
+			if block == "" {
+				block = r.blockKind(method, args)
+			}
+			if block != rule.Block {
+				continue
+			}
+		}
+		return r.pools[rule.Pool]
+	}
+
+	return r.pools[DefaultPool]
+}
+
+// blockParamIndex is the index of block param of methods
+var blockParamIndex = map[string]int{
+	"eth_getBalance":                          1,
+	"eth_getCode":                             1,
+	"eth_getTransactionCount":                 1,
+	"eth_getStorageAt":                        2,
+	"eth_call":                                1,
+	"eth_estimateGas":                         1,
+	"eth_getProof":                            2,
+	"eth_feeHistory":                          1,
+	"eth_getBlockByNumber":                    0,
+	"eth_getBlockTransactionCountByNumber":    0,
+	"eth_getTransactionByBlockNumberAndIndex": 0,
+	"eth_getUncleCountByBlockNumber":          0,
+	"eth_getUncleByBlockNumberAndIndex":       0,
+	"eth_getBlockReceipts":                    0,
+}
+
+// blockKind returns the kind of block in params, BlockLatest if none
+func (r *Router) blockKind(method string, args json.RawMessage) string {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(args, &raw); err != nil {
+		return BlockLatest
+	}
+
+	var block json.RawMessage
+	if method == "eth_getLogs" {
+		if len(raw) == 0 {
+			return BlockLatest
+		}
+		var q struct {
+			BlockHash json.RawMessage `json:"blockHash"`
+			FromBlock json.RawMessage `json:"fromBlock"`
+		}
+		if err := json.Unmarshal(raw[0], &q); err != nil {
+			return BlockLatest
+		}
+		if q.BlockHash != nil {
+			return BlockArchive
+		}
+		block = q.FromBlock
+	} else {
+		i, ok := blockParamIndex[method]
+		if !ok || i >= len(raw) {
+			return BlockLatest
+		}
+		block = raw[i]
+	}
+
+	block = bytes.TrimSpace(block)
+	if len(block) == 0 || bytes.Equal(block, []byte("null")) {
+		return BlockLatest
+	}
+	if block[0] == '{' {
+		// EIP-1898 block number or hash
+		var b struct {
+			BlockNumber json.RawMessage `json:"blockNumber"`
+			BlockHash   json.RawMessage `json:"blockHash"`
+		}
+		if err := json.Unmarshal(block, &b); err != nil {
+			return BlockLatest
+		}
+		if b.BlockHash != nil {
+			return BlockArchive
+		}
+		block = b.BlockNumber
+	}
+
+	var tag string
+	if err := json.Unmarshal(block, &tag); err != nil {
+		return BlockLatest
+	}
+	switch tag {
+	case "", "latest", "pending", "safe", "finalized":
+		return BlockLatest
+	case "earliest":
+		return BlockArchive
+	}
+	if len(tag) == 66 {
+		// block hash of eth_getBlockByHash alike methods
+		return BlockArchive
+	}
+	number, err := hexutil.DecodeUint64(tag)
+	if err != nil {
+		return BlockLatest
+	}
+
+	head, err := r.headNumber()
+	if err != nil {
+		log.Warnln("router get head error:", err)
+		return BlockLatest
+	}
+	if number+r.archiveDepth < head {
+		return BlockArchive
+	}
+	return BlockLatest
+}
+
+// headNumber returns the head block number, cached for headTTL
+func (r *Router) headNumber() (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.headUpdate) < headTTL {
+		return r.head, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), headTimeout)
+	defer cancel()
+	head, err := r.backend.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.head, r.headUpdate = head, time.Now()
+
+	return head, nil
+}
+
+var std *Router
+
+// Enable sets the router of requests
+func Enable(r *Router) {
+	std = r
+}
+
+// Default returns the router enabled, or nil
+func Default() *Router {
+	return std
+}
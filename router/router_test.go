@@ -0,0 +1,138 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+type fakeBackend uint64
+
+func (b fakeBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	return uint64(b), nil
+}
+
+func newTestRouter(t *testing.T) *Router {
+	r, err := New(map[string][]string{
+		DefaultPool: {"http://full1", "http://full2"},
+		"archive":   {"http://archive"},
+		"Tx":        {"http://tx"},
+	}, []Rule{
+		{Method: "eth_sendRawTransaction", Pool: "tx"},
+		{Method: "debug_*", Pool: "archive"},
+		{Method: "*", Block: BlockArchive, Pool: "archive"},
+	}, 100, fakeBackend(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(map[string][]string{"tx": {"http://tx"}}, nil, 0, nil); err == nil {
+		t.Error("new without default pool")
+	}
+	if _, err := New(map[string][]string{DefaultPool: {"http://full"}}, []Rule{{Method: "*", Pool: "archive"}}, 0, nil); err == nil {
+		t.Error("new with rule of unknown pool")
+	}
+	if _, err := New(map[string][]string{DefaultPool: {"http://full"}}, []Rule{{Method: "*", Block: BlockArchive, Pool: DefaultPool}}, 0, nil); err == nil {
+		t.Error("new routing by block without backend")
+	}
+	if _, err := New(map[string][]string{DefaultPool: {"http://full"}}, []Rule{{Method: "*", Block: "old", Pool: DefaultPool}}, 0, fakeBackend(0)); err == nil {
+		t.Error("new with unknown block")
+	}
+}
+
+func TestRoute(t *testing.T) {
+	r := newTestRouter(t)
+
+	tests := []struct {
+		method string
+		args   string
+		pool   string
+	}{
+		{"eth_sendRawTransaction", `["0x"]`, "tx"},
+		{"debug_traceTransaction", `["0x01"]`, "archive"},
+		{"eth_blockNumber", `[]`, DefaultPool},
+		{"eth_getBalance", `["0x0000000000000000000000000000000000002048","latest"]`, DefaultPool},
+		{"eth_getBalance", `["0x0000000000000000000000000000000000002048"]`, DefaultPool},
+		{"eth_getBalance", `["0x0000000000000000000000000000000000002048","0x384"]`, DefaultPool},
+		{"eth_getBalance", `["0x0000000000000000000000000000000000002048","0x383"]`, "archive"},
+		{"eth_getBalance", `["0x0000000000000000000000000000000000002048","earliest"]`, "archive"},
+		{"eth_getBalance", `["0x0000000000000000000000000000000000002048",{"blockHash":"0x0000000000000000000000000000000000000000000000000000000000000001"}]`, "archive"},
+		{"eth_getBalance", `["0x0000000000000000000000000000000000002048",{"blockNumber":"0x1"}]`, "archive"},
+		{"eth_getStorageAt", `["0x0000000000000000000000000000000000002048","0x0","0x1"]`, "archive"},
+		{"eth_getBlockByNumber", `["0x3e8",false]`, DefaultPool},
+		{"eth_getBlockByNumber", `["0x1",false]`, "archive"},
+		{"eth_getLogs", `[{"fromBlock":"0x1","toBlock":"latest"}]`, "archive"},
+		{"eth_getLogs", `[{"blockHash":"0x0000000000000000000000000000000000000000000000000000000000000001"}]`, "archive"},
+		{"eth_getLogs", `[{}]`, DefaultPool},
+	}
+	for i, test := range tests {
+		if pool := r.Route(test.method, json.RawMessage(test.args)); pool.Name != test.pool {
+			t.Errorf("%d: %s routed to %s, want %s", i, test.method, pool.Name, test.pool)
+		}
+	}
+
+	pool := r.Pool(DefaultPool)
+	if a, b, c := pool.Next(), pool.Next(), pool.Next(); a != "http://full1" || b != "http://full2" || c != a {
+		t.Errorf("round robin %s %s %s", a, b, c)
+	}
+}
+
+func TestPlanAndMerge(t *testing.T) {
+	r := newTestRouter(t)
+
+	single := []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x"]}`)
+	if groups, size := r.Plan(single); len(groups) != 1 || size != 1 || groups[0].Pool.Name != "tx" || string(groups[0].Body) != string(single) {
+		t.Fatalf("plan single %v", groups)
+	}
+
+	batch := []byte(`[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]},` +
+		`{"jsonrpc":"2.0","id":2,"method":"eth_sendRawTransaction","params":["0x"]},` +
+		`{"jsonrpc":"2.0","method":"eth_blockNumber","params":[]},` +
+		`{"jsonrpc":"2.0","id":3,"method":"eth_chainId","params":[]},` +
+		`{"jsonrpc":"2.0","id":4,"method":"debug_traceTransaction","params":["0x01"]}]`)
+	groups, size := r.Plan(batch)
+	if len(groups) != 3 || size != 5 {
+		t.Fatalf("plan batch %d groups of %d messages", len(groups), size)
+	}
+	want := []struct {
+		pool string
+		body string
+	}{
+		{DefaultPool, `[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]},{"jsonrpc":"2.0","method":"eth_blockNumber","params":[]},{"jsonrpc":"2.0","id":3,"method":"eth_chainId","params":[]}]`},
+		{"tx", `[{"jsonrpc":"2.0","id":2,"method":"eth_sendRawTransaction","params":["0x"]}]`},
+		{"archive", `[{"jsonrpc":"2.0","id":4,"method":"debug_traceTransaction","params":["0x01"]}]`},
+	}
+	for i, g := range groups {
+		if g.Pool.Name != want[i].pool || string(g.Body) != want[i].body {
+			t.Errorf("group %d: %s %s, want %s %s", i, g.Pool.Name, g.Body, want[i].pool, want[i].body)
+		}
+	}
+
+	merged := Merge(groups, size, [][]byte{
+		[]byte(`[{"jsonrpc":"2.0","id":3,"result":"0x1"},{"jsonrpc":"2.0","id":1,"result":"0x10"}]`),
+		[]byte(`[{"jsonrpc":"2.0","id":2,"result":"0x02"}]`),
+		nil,
+	})
+	var results []struct {
+		ID     int             `json:"id"`
+		Result string          `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(merged, &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("merged %s", merged)
+	}
+	for i, result := range results[:3] {
+		if result.ID != i+1 || result.Result == "" {
+			t.Errorf("result %d: %s", i, merged)
+		}
+	}
+	if results[3].ID != 4 || results[3].Error == nil {
+		t.Errorf("failed result %s", merged)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxAuditBody is the max bytes of response body captured for audit
+const maxAuditBody = 64 * 1024
+
+// auditResponseWriter captures the status code and body of response for audit,
+// the body is captured in full if unlimited, such as the transactions pending on it
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	unlimited bool
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.unlimited {
+		w.body.Write(b)
+	} else if n := maxAuditBody - w.body.Len(); n > 0 {
+		if n > len(b) {
+			n = len(b)
+		}
+		w.body.Write(b[:n])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (w *auditResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// Body returns the captured body, decompressed if gzip encoded
+func (w *auditResponseWriter) Body() []byte {
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		return w.body.Bytes()
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(w.body.Bytes()))
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	body, _ := ioutil.ReadAll(zr)
+	return body
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/breaker"
+)
+
+// breakerTransport records the outcome of the request to upstream in its circuit breaker,
+// the request must be allowed by the breaker with ticket before
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *breaker.Breaker
+	ticket  breaker.Ticket
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	t.breaker.Done(t.ticket, outcomeOf(req.Context(), res, err), time.Since(start), time.Now())
+	return res, err
+}
+
+// outcomeOf returns the outcome of the request in ctx for the circuit breaker
+func outcomeOf(ctx context.Context, res *http.Response, err error) breaker.Outcome {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+			// canceled by client, or the loser of hedged requests
+			return breaker.Ignored
+		}
+		return breaker.Failure
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		return breaker.Failure
+	}
+	return breaker.Success
+}
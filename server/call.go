@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// estimateGasPadding pads the eth_estimateGas results of response
+type estimateGasPadding struct {
+	ids     map[string]struct{}
+	percent int
+	max     uint64 // cap of the padded result, 0 means no cap
+}
+
+func newEstimateGasPadding(ids []json.RawMessage, percent int, max uint64) *estimateGasPadding {
+	if len(ids) == 0 || percent <= 0 {
+		return nil
+	}
+	p := &estimateGasPadding{ids: make(map[string]struct{}, len(ids)), percent: percent, max: max}
+	for _, id := range ids {
+		p.ids[string(bytes.TrimSpace(id))] = struct{}{}
+	}
+	return p
+}
+
+// pad returns the body with the results padded, or the body itself if nothing padded
+func (p *estimateGasPadding) pad(body []byte) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return body
+	}
+
+	var (
+		msgs   []map[string]json.RawMessage
+		batch  = trimmed[0] == '['
+		padded bool
+	)
+	if batch {
+		if err := json.Unmarshal(trimmed, &msgs); err != nil {
+			return body
+		}
+	} else {
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &msg); err != nil {
+			return body
+		}
+		msgs = append(msgs, msg)
+	}
+
+	for _, msg := range msgs {
+		if _, ok := p.ids[string(bytes.TrimSpace(msg["id"]))]; !ok {
+			continue
+		}
+		var gas hexutil.Big
+		if err := json.Unmarshal(msg["result"], &gas); err != nil {
+			continue
+		}
+		result := new(big.Int).Mul(gas.ToInt(), big.NewInt(int64(100+p.percent)))
+		result.Div(result, big.NewInt(100))
+		if p.max != 0 && result.Cmp(new(big.Int).SetUint64(p.max)) > 0 {
+			result.SetUint64(p.max)
+		}
+		if result.Cmp(gas.ToInt()) < 0 {
+			// never pad below the estimation, such as the estimation above the cap
+			continue
+		}
+		raw, err := json.Marshal((*hexutil.Big)(result))
+		if err != nil {
+			continue
+		}
+		msg["result"] = raw
+		padded = true
+	}
+	if !padded {
+		return body
+	}
+
+	var (
+		ret []byte
+		err error
+	)
+	if batch {
+		ret, err = json.Marshal(msgs)
+	} else {
+		ret, err = json.Marshal(msgs[0])
+	}
+	if err != nil {
+		return body
+	}
+	return append(ret, '\n')
+}
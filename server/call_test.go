@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestEstimateGasPadding(t *testing.T) {
+	if newEstimateGasPadding(nil, 20, 0) != nil {
+		t.Error("padding without ids")
+	}
+	if newEstimateGasPadding([]json.RawMessage{json.RawMessage("1")}, 0, 0) != nil {
+		t.Error("padding without percent")
+	}
+
+	p := newEstimateGasPadding([]json.RawMessage{json.RawMessage("1"), json.RawMessage(`"b"`)}, 20, 30000)
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"jsonrpc":"2.0","id":1,"result":"0x5208"}`, `{"id":1,"jsonrpc":"2.0","result":"0x6270"}` + "\n"},
+		{`{"jsonrpc":"2.0","id":2,"result":"0x5208"}`, `{"jsonrpc":"2.0","id":2,"result":"0x5208"}`},
+		{`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"execution reverted"}}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"execution reverted"}}`},
+		// capped by the max call gas
+		{`[{"jsonrpc":"2.0","id":"b","result":"0x6d60"},{"jsonrpc":"2.0","id":1,"result":"0x1"}]`,
+			`[{"id":"b","jsonrpc":"2.0","result":"0x7530"},{"id":1,"jsonrpc":"2.0","result":"0x1"}]` + "\n"},
+		// not padded below the estimation
+		{`{"jsonrpc":"2.0","id":1,"result":"0x9c40"}`, `{"jsonrpc":"2.0","id":1,"result":"0x9c40"}`},
+	}
+	for i, test := range tests {
+		if got := string(p.pad([]byte(test.body))); got != test.want {
+			t.Errorf("%d: padded %s, want %s", i, got, test.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(tests[0].body))
+	zw.Close()
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       ioutil.NopCloser(&buf),
+	}
+	if err := bodyModifier(p.pad).modifyResponse(res); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != tests[0].want || res.Header.Get("Content-Encoding") != "" || res.ContentLength != int64(len(body)) {
+		t.Errorf("modified response %s, header %v", body, res.Header)
+	}
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/concurrency"
+)
+
+// acquire admits the request to limiter l by its priority, and returns the release
+// sampling the latency of request unless canceled by client
+func acquire(r *http.Request, l *concurrency.Limiter) (func(), error) {
+	if err := l.Acquire(r.Context(), concurrency.PriorityOf(r.Context())); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	return func() {
+		latency := time.Since(start)
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			latency = 0
+		}
+		l.Release(latency, time.Now())
+	}, nil
+}
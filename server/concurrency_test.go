@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/newtonproject/newchain-guard/concurrency"
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+func TestServeHTTPLoadShed(t *testing.T) {
+	var calls int32
+	node := newNamedUpstream("node", 100*time.Millisecond, new(int32), &calls)
+	defer node.Close()
+
+	ls := concurrency.NewLimiters(concurrency.Config{InitialLimit: 1, MaxQueue: -1}, concurrency.Config{},
+		concurrency.DefaultHighMethods, concurrency.DefaultLowMethods, nil)
+	concurrency.Enable(ls)
+	defer concurrency.Enable(nil)
+
+	config := params.DefaultConfig
+	config.RawURL = node.URL
+	config.MethodWhiteList = map[string]struct{}{"eth_blockNumber": {}}
+	s := NewServer(&config)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serveBody(s, `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	}()
+	for deadline := time.Now().Add(time.Second); ls.Global().Status().InFlight == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := serveBody(s, `[{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber","params":[]}]`)
+	var res []params.JSONErrResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if len(res) != 1 || res[0].Error.Code != params.StatusLoadShed || string(res[0].ID) != "2" {
+		t.Errorf("shed response %s", w.Body.String())
+	}
+
+	w = <-done
+	var ok params.JSONSuccessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &ok); err != nil || ok.Result != "node" {
+		t.Errorf("admitted response %s", w.Body.String())
+	}
+	if s := ls.Status(); s[0].InFlight != 0 || s[1].InFlight != 0 || s[0].Shed["normal"] != 1 {
+		t.Errorf("status %+v %+v", s[0], s[1])
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("status code %d", w.Code)
+	}
+}
+
+func TestServeHTTPLoadShedAbort(t *testing.T) {
+	var calls int32
+	node := newNamedUpstream("node", 100*time.Millisecond, new(int32), &calls)
+	defer node.Close()
+	l := withVelocity(t)
+
+	config := params.DefaultConfig
+	config.RawURL = node.URL
+	config.MethodWhiteList = map[string]struct{}{"eth_blockNumber": {}, "eth_sendRawTransaction": {}}
+	s := NewServer(&config)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	// shed by the global limit before checked, or by the upstream limit after checked
+	defer concurrency.Enable(nil)
+	for i, globalLimit := range []int{1, 2} {
+		ls := concurrency.NewLimiters(concurrency.Config{InitialLimit: globalLimit, MaxQueue: -1},
+			concurrency.Config{InitialLimit: 1, MaxQueue: -1}, concurrency.DefaultHighMethods, concurrency.DefaultLowMethods, nil)
+		concurrency.Enable(ls)
+
+		done := make(chan struct{})
+		go func() {
+			serveBody(s, `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+			close(done)
+		}()
+		upstream := ls.Upstream(node.URL)
+		for deadline := time.Now().Add(time.Second); upstream.Status().InFlight == 0 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+
+		w := serveBody(s, newRawTx(t, i, config.ChainID, key))
+		var res params.JSONErrResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Error.Code != params.StatusLoadShed {
+			t.Errorf("global limit %d: shed response %s", globalLimit, w.Body.String())
+		}
+		if _, ok := l.Allow(from, common.HexToHash("0x01"), big.NewInt(0), time.Now()); !ok {
+			t.Errorf("global limit %d: velocity counted for the shed transaction", globalLimit)
+		}
+		l.Release(from, common.HexToHash("0x01"))
+		<-done
+	}
+}
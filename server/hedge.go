@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/breaker"
+)
+
+// unhedgeablePrefixes are the methods not hedged, as they write or keep state in the node
+var unhedgeablePrefixes = []string{
+	"eth_send", "eth_sign", "eth_submit",
+	"eth_newFilter", "eth_newBlockFilter", "eth_newPendingTransactionFilter",
+	"eth_getFilter", "eth_uninstallFilter", "eth_subscribe", "eth_unsubscribe",
+	"personal_", "miner_", "admin_", "debug_",
+}
+
+// hedgeable returns whether all the messages of body are read methods safe to send twice
+func hedgeable(body []byte) bool {
+	msgs, _ := parseMessages(body)
+	for _, msg := range msgs {
+		if msg.Method == "" {
+			return false
+		}
+		for _, prefix := range unhedgeablePrefixes {
+			if strings.HasPrefix(msg.Method, prefix) {
+				return false
+			}
+		}
+	}
+	return len(msgs) > 0
+}
+
+// hedgeResult is the result of an attempt of hedged request
+type hedgeResult struct {
+	attempt int
+	res     *http.Response
+	err     error
+}
+
+func (r *hedgeResult) ok() bool {
+	return r.err == nil && r.res.StatusCode < http.StatusInternalServerError
+}
+
+func (r *hedgeResult) discard() {
+	if r.res != nil {
+		io.Copy(ioutil.Discard, r.res.Body)
+		r.res.Body.Close()
+	}
+}
+
+// cancelOnClose cancels the context of the response when its body closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// hedgeTransport sends the request to secondary if primary does not respond in delay or fails,
+// and returns the first successful response
+type hedgeTransport struct {
+	primary          http.RoundTripper
+	secondary        http.RoundTripper
+	secondaryURL     *url.URL
+	secondaryBreaker *breaker.Breaker // nil if not enabled
+	delay            time.Duration
+	body             []byte
+}
+
+func (t *hedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		results = make(chan *hedgeResult, 2)
+		cancels []context.CancelFunc
+	)
+	send := func(rt http.RoundTripper, u *url.URL) {
+		ctx, cancel := context.WithCancel(req.Context())
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+
+		out := req.Clone(ctx)
+		if u != nil {
+			target := *u
+			target.RawQuery = req.URL.RawQuery
+			out.URL = &target
+			out.Host = u.Host
+		}
+		out.Body = ioutil.NopCloser(bytes.NewReader(t.body))
+		out.ContentLength = int64(len(t.body))
+		go func() {
+			res, err := rt.RoundTrip(out)
+			results <- &hedgeResult{attempt: attempt, res: res, err: err}
+		}()
+	}
+	// hedge sends to secondary once if its circuit allowed
+	hedged := false
+	hedge := func() {
+		if hedged {
+			return
+		}
+		hedged = true
+		rt := t.secondary
+		if t.secondaryBreaker != nil {
+			ticket, ok := t.secondaryBreaker.Allow(time.Now())
+			if !ok {
+				return
+			}
+			rt = &breakerTransport{base: rt, breaker: t.secondaryBreaker, ticket: ticket}
+		}
+		send(rt, t.secondaryURL)
+	}
+	// finish returns r, and cancels and discards the other attempts
+	finish := func(r *hedgeResult, pending int) (*http.Response, error) {
+		for i, cancel := range cancels {
+			if i != r.attempt {
+				cancel()
+			}
+		}
+		go func() {
+			for ; pending > 0; pending-- {
+				(<-results).discard()
+			}
+		}()
+		if r.err != nil {
+			cancels[r.attempt]()
+			return nil, r.err
+		}
+		r.res.Body = &cancelOnClose{ReadCloser: r.res.Body, cancel: cancels[r.attempt]}
+		return r.res, nil
+	}
+
+	send(t.primary, nil)
+	timer := time.NewTimer(t.delay)
+	defer timer.Stop()
+
+	var failed *hedgeResult
+	for received := 0; ; {
+		select {
+		case <-timer.C:
+			hedge()
+		case r := <-results:
+			received++
+			pending := len(cancels) - received
+			if r.ok() {
+				if failed != nil {
+					failed.discard()
+					cancels[failed.attempt]()
+				}
+				return finish(r, pending)
+			}
+
+			// failed, hedged at once
+			if failed != nil {
+				failed.discard()
+				cancels[failed.attempt]()
+			}
+			failed = r
+			hedge()
+			if len(cancels) == received {
+				return finish(failed, 0)
+			}
+		}
+	}
+}
+
+// transport returns the transport to upstream rawURL recorded by its breaker b allowed the request with ticket,
+// and hedged to HedgeUpstream after the latency percentile of rawURL if the request is read only
+func (s *Server) transport(rawURL string, b *breaker.Breaker, ticket breaker.Ticket, bodyBytes []byte) http.RoundTripper {
+	var rt http.RoundTripper = http.DefaultTransport
+	if b == nil {
+		return rt
+	}
+	rt = &breakerTransport{base: rt, breaker: b, ticket: ticket}
+
+	hedgeURL := s.config.HedgeUpstream
+	if hedgeURL == "" || hedgeURL == rawURL || !hedgeable(bodyBytes) {
+		return rt
+	}
+	delay, ok := b.Percentile(s.config.HedgePercentile, time.Now())
+	if !ok {
+		return rt
+	}
+	if delay < s.config.HedgeMinDelay {
+		delay = s.config.HedgeMinDelay
+	}
+	u, err := url.Parse(hedgeURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return rt
+	}
+
+	h := &hedgeTransport{
+		primary:      rt,
+		secondary:    http.DefaultTransport,
+		secondaryURL: u,
+		delay:        delay,
+		body:         bodyBytes,
+	}
+	if sb := breaker.Get(hedgeURL); sb != nil {
+		h.secondaryBreaker = sb
+	}
+	return h
+}
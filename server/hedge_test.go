@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/newtonproject/newchain-guard/breaker"
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// newNamedUpstream responses its name as the result after delay, or 500 if failed
+func newNamedUpstream(name string, delay time.Duration, failed *int32, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		if atomic.LoadInt32(failed) != 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(params.JSONSuccessResponse{Version: params.JSONRPCVersion, ID: req.ID, Result: name})
+	}))
+}
+
+func serveBody(s *Server, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", params.ContentType)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestServeHTTPCircuitOpen(t *testing.T) {
+	var failed, calls int32 = 1, 0
+	node := newNamedUpstream("node", 0, &failed, &calls)
+	defer node.Close()
+
+	breaker.Enable(breaker.NewBreakers(breaker.Config{MinRequests: 2, ErrorRate: 0.5, OpenDuration: time.Hour}))
+	defer breaker.Enable(nil)
+
+	config := params.DefaultConfig
+	config.RawURL = node.URL
+	config.MethodWhiteList = map[string]struct{}{"eth_blockNumber": {}}
+	s := NewServer(&config)
+
+	body := `{"jsonrpc":"2.0","id":7,"method":"eth_blockNumber","params":[]}`
+	for i := 0; i < 2; i++ {
+		serveBody(s, body)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("upstream called %d, want 2", n)
+	}
+
+	w := serveBody(s, body)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("upstream called %d while open, want 2", n)
+	}
+	var res params.JSONErrResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if res.Error.Code != params.StatusCircuitOpen || string(res.ID) != "7" {
+		t.Errorf("circuit open response %s", w.Body.String())
+	}
+
+	w = serveBody(s, `[`+body+`,{"jsonrpc":"2.0","id":8,"method":"eth_blockNumber","params":[]}]`)
+	var batch []params.JSONErrResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &batch); err != nil || len(batch) != 2 || batch[1].Error.Code != params.StatusCircuitOpen {
+		t.Errorf("circuit open batch response %s", w.Body.String())
+	}
+}
+
+func TestServeHTTPHedge(t *testing.T) {
+	var (
+		slowDelay  = int64(0)
+		noFail     int32
+		slowCalls  int32
+		fastCalls  int32
+		slowFailed int32
+	)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowCalls, 1)
+		ioutil.ReadAll(r.Body)
+		select {
+		case <-time.After(time.Duration(atomic.LoadInt64(&slowDelay))):
+		case <-r.Context().Done():
+			return
+		}
+		if atomic.LoadInt32(&slowFailed) != 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"slow"}` + "\n"))
+	}))
+	defer slow.Close()
+	fast := newNamedUpstream("fast", 0, &noFail, &fastCalls)
+	defer fast.Close()
+
+	breaker.Enable(breaker.NewBreakers(breaker.Config{MinRequests: 5}))
+	defer breaker.Enable(nil)
+
+	config := params.DefaultConfig
+	config.RawURL = slow.URL
+	config.MethodWhiteList = map[string]struct{}{"eth_blockNumber": {}, "eth_sendRawTransaction": {}}
+	config.HedgeUpstream = fast.URL
+	config.HedgePercentile = 90
+	config.HedgeMinDelay = 20 * time.Millisecond
+	s := NewServer(&config)
+
+	result := func(w *httptest.ResponseRecorder) string {
+		var res struct {
+			Result string `json:"result"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return res.Result
+	}
+
+	read := `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+	// not hedged before the latencies known
+	for i := 0; i < 5; i++ {
+		if got := result(serveBody(s, read)); got != "slow" {
+			t.Fatalf("result %s, want slow", got)
+		}
+	}
+	if n := atomic.LoadInt32(&fastCalls); n != 0 {
+		t.Fatalf("hedged %d before the latencies known", n)
+	}
+
+	atomic.StoreInt64(&slowDelay, int64(time.Second))
+	start := time.Now()
+	if got := result(serveBody(s, read)); got != "fast" {
+		t.Errorf("result %s of slow upstream, want fast", got)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("hedged response in %v, want before the slow one", elapsed)
+	}
+
+	// hedged at once if failed
+	atomic.StoreInt64(&slowDelay, 0)
+	atomic.StoreInt32(&slowFailed, 1)
+	if got := result(serveBody(s, read)); got != "fast" {
+		t.Errorf("result %s of failed upstream, want fast", got)
+	}
+
+	// the transactions are never hedged
+	atomic.StoreInt32(&fastCalls, 0)
+	serveBody(s, `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x00"]}`)
+	if !hedgeable([]byte(read)) || hedgeable([]byte(`{"method":"eth_sendRawTransaction"}`)) ||
+		hedgeable([]byte(`[{"method":"eth_call"},{"method":"eth_getFilterChanges"}]`)) {
+		t.Error("hedgeable methods")
+	}
+	if n := atomic.LoadInt32(&fastCalls); n != 0 {
+		t.Errorf("transaction hedged %d", n)
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/newtonproject/newchain-guard/breaker"
 	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/tracing"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -17,6 +21,14 @@ type IPCServer struct {
 	bodyBytes []byte
 	ErrorLog  *log.Logger
 	LogReq    *params.LogRequest
+
+	// ModifyBody is an optional function that modifies the response body,
+	// the response is buffered until read completely if set
+	ModifyBody func([]byte) []byte
+
+	// Breaker records the outcome of the request allowed by it with Ticket if set
+	Breaker *breaker.Breaker
+	Ticket  breaker.Ticket
 }
 
 func NewSingleIPCReverseProxy(rawURL string, bodyBytes []byte) *IPCServer {
@@ -39,12 +51,29 @@ func (s *IPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}()
 	}
 
+	_, span := tracing.Start(ctx, "upstream.ipc")
+	defer span.End()
+
+	outcome := breaker.Failure // till the response read
+	if s.Breaker != nil {
+		start := time.Now()
+		defer func() {
+			if outcome == breaker.Failure && errors.Is(ctx.Err(), context.Canceled) {
+				outcome = breaker.Ignored
+			}
+			s.Breaker.Done(s.Ticket, outcome, time.Since(start), time.Now())
+		}()
+	}
+
 	conn, err := net.Dial("unix", s.rawURL)
 	if err != nil {
 		params.LogAndResponseJSONError(w, r, s.ErrorLog, params.StatusIPCDialError, json.RawMessage{}, string(s.bodyBytes))
 		return
 	}
 	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
 
 	_, err = conn.Write(s.bodyBytes)
 	if err != nil {
@@ -65,7 +94,7 @@ func (s *IPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		buf.Write(tmp[:n])
-		if n < size {
+		if n < size && s.ModifyBody == nil {
 			// Force chunking if we saw a response trailer.
 			// This prevents net/http from calculating the length for short
 			// bodies and adding a Content-Length.
@@ -81,11 +110,17 @@ func (s *IPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	logBuf.Write(buf.Bytes())
-	w.Write(buf.Bytes())
+	outcome = breaker.Success
+
+	body := buf.Bytes()
+	if s.ModifyBody != nil {
+		body = s.ModifyBody(body)
+	}
+	logBuf.Write(body)
+	w.Write(body)
 
 	if s.LogReq != nil {
-		params.LogBatchRequestStructInfo(s.LogReq, logBuf.String())
+		params.LogRequestResponse(s.LogReq, logBuf.String())
 	} else {
 		params.LogRequestAndResponseInfo(r, s.ErrorLog, params.StatusOK, string(s.bodyBytes), strings.Trim(logBuf.String(), "\n"))
 	}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/newtonproject/newchain-guard/params"
+)
+
+// rpcMessage is the id and method of a JSON-RPC request message
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// parseMessages returns the messages of body, and whether body is a batch
+func parseMessages(body []byte) ([]rpcMessage, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var msgs []rpcMessage
+		json.Unmarshal(trimmed, &msgs)
+		return msgs, true
+	}
+	var msg rpcMessage
+	json.Unmarshal(trimmed, &msg)
+	return []rpcMessage{msg}, false
+}
+
+// methodsOf returns the methods of the messages of body
+func methodsOf(body []byte) []string {
+	msgs, _ := parseMessages(body)
+	methods := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		methods = append(methods, msg.Method)
+	}
+	return methods
+}
+
+// responseMessageErrors fails the request fast with the status errors of all its messages,
+// such as the circuit of upstream is open or the request is shed
+func (s *Server) responseMessageErrors(w http.ResponseWriter, r *http.Request, bodyBytes []byte, modify bodyModifier, status int) {
+	msgs, batch := parseMessages(bodyBytes)
+	errs := make([]params.JSONErrResponse, 0, len(msgs))
+	for _, msg := range msgs {
+		if batch && len(msg.ID) == 0 {
+			// no response for notification
+			continue
+		}
+		errs = append(errs, params.JSONErrResponse{
+			Version: params.JSONRPCVersion,
+			ID:      msg.ID,
+			Error: params.JSONError{
+				Code:    status,
+				Message: fmt.Sprintf("%s - %d", params.GetStatusText(status), status),
+			},
+		})
+	}
+
+	var (
+		buf []byte
+		err error
+	)
+	if batch {
+		buf, err = json.Marshal(errs)
+	} else {
+		buf, err = json.Marshal(errs[0])
+	}
+	if err != nil {
+		params.LogAndResponseJSONError(w, r, s.ErrorLog, status, json.RawMessage{}, string(bodyBytes))
+		return
+	}
+	buf = append(buf, '\n')
+	if modify != nil {
+		buf = modify(buf)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	params.LogAndResponseError(w, r, s.ErrorLog, status, buf, string(bodyBytes))
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// bodyModifier modifies the response body of upstream before responding to the client
+type bodyModifier func([]byte) []byte
+
+// chainModifiers returns the modifier applying modifiers in order, nil if no modifier
+func chainModifiers(modifiers ...bodyModifier) bodyModifier {
+	var chain []bodyModifier
+	for _, m := range modifiers {
+		if m != nil {
+			chain = append(chain, m)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return func(body []byte) []byte {
+		for _, m := range chain {
+			body = m(body)
+		}
+		return body
+	}
+}
+
+// appendResponses returns the modifier appending the responses answered by the guard
+// to the batch response of upstream, the responses of batch may be in any order
+func appendResponses(responses []json.RawMessage) bodyModifier {
+	if len(responses) == 0 {
+		return nil
+	}
+	return func(body []byte) []byte {
+		var raws []json.RawMessage
+		if err := json.Unmarshal(body, &raws); err != nil {
+			// the upstream failed, such as an error object for the whole batch
+			return body
+		}
+		b, err := json.Marshal(append(raws, responses...))
+		if err != nil {
+			return body
+		}
+		return append(b, '\n')
+	}
+}
+
+// modifyResponse modifies the body of the upstream response, the gzip body is decompressed
+func (m bodyModifier) modifyResponse(res *http.Response) error {
+	if res.StatusCode != http.StatusOK || res.Body == nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if body, err = ioutil.ReadAll(zr); err != nil {
+			return err
+		}
+		res.Header.Del("Content-Encoding")
+	}
+
+	body = m(body)
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/newtonproject/newchain-guard/breaker"
+	"github.com/newtonproject/newchain-guard/filter"
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/velocity"
+)
+
+// newRawTx returns the message of eth_sendRawTransaction of id sending a signed transaction from key
+func newRawTx(t *testing.T, id int, chainID *big.Int, key *ecdsa.PrivateKey) string {
+	to := common.HexToAddress("0x2048")
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: uint64(id), To: &to, Gas: 21000,
+		GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)})
+	signer := filter.NewSigner(chainID)
+	hash := signer.Hash(tx)
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := elliptic.P256().Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s = new(big.Int).Sub(n, s)
+	}
+	sig := make([]byte, 65)
+	copy(sig[32-len(r.Bytes()):32], r.Bytes())
+	copy(sig[64-len(s.Bytes()):64], s.Bytes())
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	for recID := byte(0); recID < 2; recID++ {
+		sig[64] = recID
+		pub, err := filter.Ecrecover(hash[:], sig)
+		if err != nil || common.BytesToAddress(filter.Keccak256(pub[1:])[12:]) != from {
+			continue
+		}
+		signed, err := tx.WithSignature(signer, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := signed.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_sendRawTransaction","params":["0x%x"]}`, id, raw)
+	}
+	t.Fatal("can not find recovery id")
+	return ""
+}
+
+// withVelocity enables the velocity limit of one transaction per hour
+func withVelocity(t *testing.T) *velocity.Limiter {
+	l, err := velocity.Open("", []velocity.Limit{{Window: time.Hour, MaxCount: 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	velocity.Enable(l)
+	t.Cleanup(func() {
+		velocity.Enable(nil)
+		l.Close()
+	})
+	return l
+}
+
+func TestServeHTTPCircuitOpenAbort(t *testing.T) {
+	var failed, calls int32 = 1, 0
+	node := newNamedUpstream("node", 0, &failed, &calls)
+	defer node.Close()
+
+	breaker.Enable(breaker.NewBreakers(breaker.Config{MinRequests: 1, ErrorRate: 0.5, OpenDuration: time.Hour}))
+	defer breaker.Enable(nil)
+	l := withVelocity(t)
+
+	config := params.DefaultConfig
+	config.RawURL = node.URL
+	config.MethodWhiteList = map[string]struct{}{"eth_blockNumber": {}, "eth_sendRawTransaction": {}}
+	s := NewServer(&config)
+	serveBody(s, `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+
+	// the transaction failed fast is not counted
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serveBody(s, newRawTx(t, 0, config.ChainID, key))
+	var res params.JSONErrResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Error.Code != params.StatusCircuitOpen {
+		t.Fatalf("circuit open response %s", w.Body.String())
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("upstream called %d, want 1", n)
+	}
+	if _, ok := l.Allow(crypto.PubkeyToAddress(key.PublicKey), common.HexToHash("0x01"), big.NewInt(0), time.Now()); !ok {
+		t.Error("velocity not released for the circuit open")
+	}
+}
+
+func TestAuditResponseWriterUnlimited(t *testing.T) {
+	body := make([]byte, maxAuditBody+1)
+	for _, unlimited := range []bool{false, true} {
+		w := &auditResponseWriter{ResponseWriter: httptest.NewRecorder(), unlimited: unlimited}
+		w.Write(body)
+		want := maxAuditBody
+		if unlimited {
+			want = len(body)
+		}
+		if n := len(w.Body()); n != want {
+			t.Errorf("unlimited %v captured %d, want %d", unlimited, n, want)
+		}
+	}
+}
@@ -22,7 +22,9 @@ import (
 	"time"
 
 	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/tracing"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func init() {
@@ -260,23 +262,24 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		outreq.Header.Set("X-Forwarded-For", clientIP)
 	}
 
-	res, err := transport.RoundTrip(outreq)
+	spanCtx, span := tracing.Start(outreq.Context(), "upstream.roundtrip",
+		attribute.String("upstream.host", outreq.URL.Host))
+	tracing.Inject(spanCtx, outreq.Header)
+	res, err := transport.RoundTrip(outreq.WithContext(spanCtx))
 	if err != nil {
+		tracing.End(span, err)
 		p.logf("http: proxy error: %v", err)
 		rw.WriteHeader(http.StatusBadGateway)
 		return
 	}
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+	tracing.End(span, nil)
 
 	removeConnectionHeaders(res.Header)
 
 	for _, h := range hopHeaders {
 		res.Header.Del(h)
 	}
-	// check gzip
-	var isGzip bool
-	if res.Header.Get("Content-Encoding") == "gzip" {
-		isGzip = true
-	}
 
 	if p.ModifyResponse != nil {
 		if err := p.ModifyResponse(res); err != nil {
@@ -287,6 +290,12 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// check gzip, after ModifyResponse which may decompress the body
+	var isGzip bool
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		isGzip = true
+	}
+
 	copyHeader(rw.Header(), res.Header)
 
 	// The "Trailer" header isn't included in the Transport's response,
@@ -378,13 +387,13 @@ func (p *ReverseProxy) copyBuffer(dst io.Writer, src io.Reader, buf []byte, isGz
 			var logBufBuf bytes.Buffer
 			io.Copy(&logBufBuf, zr)
 			if p.LogReq != nil {
-				params.LogBatchRequestStructInfo(p.LogReq, strings.Trim(logBufBuf.String(), "\n"))
+				params.LogRequestResponse(p.LogReq, strings.Trim(logBufBuf.String(), "\n"))
 			} else {
 				log.Infoln(strings.Trim(logBufBuf.String(), "\n"))
 			}
 		} else {
 			if p.LogReq != nil {
-				params.LogBatchRequestStructInfo(p.LogReq, strings.Trim(logBuf.String(), "\n"))
+				params.LogRequestResponse(p.LogReq, strings.Trim(logBuf.String(), "\n"))
 			} else {
 				log.Infoln(strings.Trim(logBuf.String(), "\n"))
 			}
@@ -396,7 +405,10 @@ func (p *ReverseProxy) copyBuffer(dst io.Writer, src io.Reader, buf []byte, isGz
 			p.logf("httputil: ReverseProxy read error during body copy: %v", rerr)
 		}
 		if nr > 0 {
-			logBuf.Write(buf[:nr])
+			// the response body is captured for logs up to the log policy limit
+			if limit := params.CaptureLimit(); limit == 0 || logBuf.Len() < limit {
+				logBuf.Write(buf[:nr])
+			}
 			nw, werr := dst.Write(buf[:nr])
 			if nw > 0 {
 				written += int64(nw)
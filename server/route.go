@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+
+	"github.com/newtonproject/newchain-guard/router"
+)
+
+// bufferedResponseWriter buffers the response of a group of the split batch
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header)}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// forwardGroups forwards the groups of batch to their pools in parallel,
+// and responses the results reassembled in order of the batch
+func (s *Server) forwardGroups(w http.ResponseWriter, r *http.Request, groups []*router.Group, size int,
+	modify bodyModifier) {
+	responses := make([][]byte, len(groups))
+
+	var wg sync.WaitGroup
+	for i, g := range groups {
+		wg.Add(1)
+		go func(i int, g *router.Group) {
+			defer wg.Done()
+
+			// the transport decompresses the response if not asked by the client
+			req := r.Clone(r.Context())
+			req.Header.Del("Accept-Encoding")
+			bw := newBufferedResponseWriter()
+			s.forward(bw, req, g.Pool.Next(), g.Body, nil, nil)
+			if bw.status == http.StatusOK {
+				responses[i] = bw.body.Bytes()
+			}
+		}(i, g)
+	}
+	wg.Wait()
+
+	body := router.Merge(groups, size, responses)
+	if modify != nil {
+		body = modify(body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
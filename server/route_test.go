@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/router"
+)
+
+// newBatchUpstream responses the method name of each request of batch in reverse order
+func newBatchUpstream(t *testing.T, name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		var res []params.JSONSuccessResponse
+		for i := len(reqs) - 1; i >= 0; i-- {
+			if reqs[i].ID == nil {
+				continue
+			}
+			res = append(res, params.JSONSuccessResponse{Version: params.JSONRPCVersion, ID: reqs[i].ID, Result: name + ":" + reqs[i].Method})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+func TestServeHTTPSplitBatch(t *testing.T) {
+	full := newBatchUpstream(t, "full")
+	defer full.Close()
+	archive := newBatchUpstream(t, "archive")
+	defer archive.Close()
+
+	rt, err := router.New(map[string][]string{
+		router.DefaultPool: {full.URL},
+		"archive":          {archive.URL},
+	}, []router.Rule{{Method: "debug_*", Pool: "archive"}}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.Enable(rt)
+	defer router.Enable(nil)
+
+	config := params.DefaultConfig
+	config.RawURL = full.URL
+	config.MethodWhiteList = map[string]struct{}{"eth_blockNumber": {}, "eth_chainId": {}, "debug_traceTransaction": {}}
+	s := NewServer(&config)
+
+	body := `[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]},` +
+		`{"jsonrpc":"2.0","id":2,"method":"debug_traceTransaction","params":["0x01"]},` +
+		`{"jsonrpc":"2.0","id":3,"method":"eth_chainId","params":[]}]`
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", params.ContentType)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	var results []struct {
+		ID     int    `json:"id"`
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	want := []string{"full:eth_blockNumber", "archive:debug_traceTransaction", "full:eth_chainId"}
+	if len(results) != len(want) {
+		t.Fatalf("response %s", w.Body.String())
+	}
+	for i, result := range results {
+		if result.ID != i+1 || result.Result != want[i] {
+			t.Errorf("result %d: %d %s, want %d %s", i, result.ID, result.Result, i+1, want[i])
+		}
+	}
+}
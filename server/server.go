@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,10 +11,17 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/newtonproject/newchain-guard/audit"
+	"github.com/newtonproject/newchain-guard/breaker"
+	"github.com/newtonproject/newchain-guard/concurrency"
 	"github.com/newtonproject/newchain-guard/filter"
 	"github.com/newtonproject/newchain-guard/params"
+	"github.com/newtonproject/newchain-guard/router"
+	"github.com/newtonproject/newchain-guard/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Server struct {
@@ -36,18 +44,26 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// honour the valid request ID of client, it is forwarded to upstream in the header
+	requestID := params.GetRequestID(r)
+	if requestID == "" {
+		requestID = tracing.NewRequestID()
+		r.Header.Set(params.RequestIDHeader, requestID)
+	}
+	w.Header().Set(params.RequestIDHeader, requestID)
+
+	ctx, span := tracing.Start(tracing.Extract(r), "guard.request",
+		attribute.String("request.id", requestID),
+		attribute.String("http.method", r.Method))
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	// s.mu.Lock()
 	// config := params.Copy(s.config)
 	// s.mu.Unlock()
 	// config := params.Copy(s.config)
 	config := s.config
 
-	u, err := url.Parse(config.RawURL)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
 	if r.Body == nil {
 		params.LogAndResponseJSONError(w, r, s.ErrorLog, params.StatusBodyNilOrEmpty, json.RawMessage{}, "")
 		return
@@ -58,25 +74,131 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var logReq *params.LogRequest
+	if audit.Enabled() {
+		aw := &auditResponseWriter{ResponseWriter: w}
+		w = aw
+		r = audit.WithPending(r, bodyBytes)
+		defer func() {
+			audit.Finish(r, aw.status, aw.Body())
+		}()
+	}
+
+	var (
+		logReq *params.LogRequest
+		modify bodyModifier
+	)
 	if r.Method != http.MethodOptions {
+		// shed the request of low priority first if overloaded, before the checks with side effects
+		// such as counting the velocity and holding in quarantine
+		if ls := concurrency.Default(); ls != nil {
+			r = r.WithContext(concurrency.WithPriority(r.Context(), ls.Priority(params.GetAPIKey(r), methodsOf(bodyBytes))))
+			release, err := acquire(r, ls.Global())
+			if err != nil {
+				s.responseMessageErrors(w, r, bodyBytes, nil, params.StatusLoadShed)
+				return
+			}
+			defer release()
+		}
+
 		f, err := filter.NewFilter(config, s.ErrorLog)
 		if err != nil {
 			params.LogAndResponseJSONError(w, r, s.ErrorLog, params.StatusFilterNoConfig, json.RawMessage{}, string(bodyBytes))
 			return
 		}
-		// if err := f.CheckJSONRequest(w, r, bodyBytes); err != nil {
-		// 	return
-		// }
+		r = filter.WithPending(r)
 		logReq, err = f.HandleJSONRequest(w, r, bodyBytes)
 		if err == params.ErrorGuard {
 			// just return
 			return
 		} else if err != nil {
+			filter.Abort(r, bodyBytes, params.StatusInternalError)
 			logrus.WithField("err1", err).Errorln(string(bodyBytes))
 			params.LogAndResponseJSONError(w, r, s.ErrorLog, params.StatusInternalError, json.RawMessage{}, string(bodyBytes))
 			return
 		}
+
+		// forward the calls with the gas field capped
+		if body := f.Body(); body != nil {
+			bodyBytes = body
+		}
+		if timeout := f.CallTimeout(); timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		var pad bodyModifier
+		if padding := newEstimateGasPadding(f.EstimateGasIDs(), config.EstimateGasPadding, config.MaxCallGas); padding != nil {
+			pad = padding.pad
+		}
+		modify = chainModifiers(pad, appendResponses(f.LocalResponses()))
+
+		// the accepted transactions are journaled and tracked by the upstream response
+		if filter.Pending(r) {
+			cw, ok := w.(*auditResponseWriter)
+			if !ok {
+				cw = &auditResponseWriter{ResponseWriter: w}
+				w = cw
+			}
+			// the results of transactions are parsed from the full body, not cut off for audit
+			cw.unlimited = true
+			pending := r
+			defer func() {
+				filter.Finish(pending, cw.Body())
+			}()
+		}
+	}
+
+	rt := router.Default()
+	if rt == nil {
+		s.forward(w, r, config.RawURL, bodyBytes, logReq, modify)
+		return
+	}
+	groups, size := rt.Plan(bodyBytes)
+	if len(groups) == 1 {
+		s.forward(w, r, groups[0].Pool.Next(), bodyBytes, logReq, modify)
+		return
+	}
+	s.forwardGroups(w, r, groups, size, modify)
+}
+
+// forward forwards the request to the upstream of rawURL
+func (s *Server) forward(w http.ResponseWriter, r *http.Request, rawURL string, bodyBytes []byte,
+	logReq *params.LogRequest, modify bodyModifier) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// fail fast if the circuit of upstream is open
+	var (
+		b      *breaker.Breaker
+		ticket breaker.Ticket
+	)
+	if u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "" {
+		b = breaker.Get(rawURL)
+	}
+	if b != nil {
+		var ok bool
+		if ticket, ok = b.Allow(time.Now()); !ok {
+			// the transactions not forwarded are rejected
+			filter.Abort(r, bodyBytes, params.StatusCircuitOpen)
+			s.responseMessageErrors(w, r, bodyBytes, modify, params.StatusCircuitOpen)
+			return
+		}
+	}
+	if ls := concurrency.Default(); ls != nil {
+		release, err := acquire(r, ls.Upstream(rawURL))
+		if err != nil {
+			if b != nil {
+				// not forwarded, return the probe if half-open
+				b.Done(ticket, breaker.Ignored, 0, time.Now())
+			}
+			filter.Abort(r, bodyBytes, params.StatusLoadShed)
+			s.responseMessageErrors(w, r, bodyBytes, modify, params.StatusLoadShed)
+			return
+		}
+		defer release()
 	}
 
 	switch u.Scheme {
@@ -87,10 +209,15 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			rc = ioutil.NopCloser(body)
 		}
 		r.Body = rc
+		r.ContentLength = int64(len(bodyBytes))
 
 		p := NewSingleHostReverseProxy(u)
+		p.Transport = s.transport(rawURL, b, ticket, bodyBytes)
 		p.ErrorLog = s.ErrorLog
 		p.LogReq = logReq
+		if modify != nil {
+			p.ModifyResponse = modify.modifyResponse
+		}
 		if p.LogReq == nil {
 			p.LogReq = &params.LogRequest{
 				R:          r,
@@ -104,9 +231,14 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		return
 	case "":
-		proxy := NewSingleIPCReverseProxy(config.RawURL, bodyBytes)
+		proxy := NewSingleIPCReverseProxy(rawURL, bodyBytes)
 		proxy.ErrorLog = s.ErrorLog
 		proxy.LogReq = logReq
+		proxy.Breaker = b
+		proxy.Ticket = ticket
+		if modify != nil {
+			proxy.ModifyBody = modify
+		}
 		proxy.ServeHTTP(w, r)
 		return
 
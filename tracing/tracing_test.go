@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestExport(t *testing.T) {
+	spans := make(chan string, 8)
+	// the collector stand-in
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req coltracepb.ExportTraceServiceRequest
+		if r.URL.Path != "/v1/traces" || proto.Unmarshal(body, &req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans <- span.Name
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(nil)
+	}))
+	defer srv.Close()
+
+	shutdown, err := Init(strings.TrimPrefix(srv.URL, "http://"), true, "guard-test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := Start(Extract(r), "guard.request")
+	if got := parent.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id %s, want the incoming", got)
+	}
+	_, child := Start(ctx, "upstream.roundtrip")
+	header := make(http.Header)
+	Inject(ctx, header)
+	if !strings.Contains(header.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("traceparent %s, want the trace propagated", header.Get("traceparent"))
+	}
+	End(child, nil)
+	End(parent, nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(spans)
+	names := make(map[string]bool)
+	for name := range spans {
+		names[name] = true
+	}
+	if !names["guard.request"] || !names["upstream.roundtrip"] {
+		t.Errorf("exported spans %v", names)
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	if a, b := NewRequestID(), NewRequestID(); len(a) != 32 || a == b {
+		t.Errorf("request ids %s %s", a, b)
+	}
+}
@@ -0,0 +1,346 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/newtonproject/newchain-guard/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// The state of tracked transaction
+const (
+	StatePending = "pending"
+	StateMined   = "mined"   // included with success receipt
+	StateFailed  = "failed"  // included with failed receipt
+	StateDropped = "dropped" // not included in DropTimeout
+)
+
+const receiptTimeout = 5 * time.Second
+
+var (
+	DefaultPollInterval = 2 * time.Second
+	DefaultDropTimeout  = 10 * time.Minute
+	DefaultHistorySize  = 10000
+	DefaultMaxPending   = 100000
+	DefaultPollWorkers  = 8
+	DefaultPollBatch    = 1000
+)
+
+// Backend is the upstream node to get receipts from
+type Backend interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// Tx is the lifecycle of a transaction accepted by the guard
+type Tx struct {
+	Hash        common.Hash `json:"hash"`
+	From        string      `json:"from,omitempty"`
+	To          string      `json:"to,omitempty"`
+	State       string      `json:"state"`
+	SubmittedAt time.Time   `json:"submittedAt"`
+	FinalizedAt time.Time   `json:"finalizedAt,omitempty"`
+	Latency     float64     `json:"latency,omitempty"` // seconds from submitted to included
+	BlockNumber uint64      `json:"blockNumber,omitempty"`
+	GasUsed     uint64      `json:"gasUsed,omitempty"`
+
+	polledAt time.Time
+}
+
+// Tracker polls the receipts of accepted transactions until they are mined, failed or dropped
+type Tracker struct {
+	backend      Backend
+	pollInterval time.Duration
+	dropTimeout  time.Duration
+	maxPending   int
+	pollWorkers  int
+	pollBatch    int
+
+	mu      sync.RWMutex
+	pending map[common.Hash]*Tx
+	history *lru.Cache // the finalized txs
+	counts  map[string]uint64
+
+	quit chan struct{}
+}
+
+// New returns the tracker, the zero arguments are set to default.
+// Each poll gets the receipts of the pollBatch least recently polled transactions by pollWorkers.
+func New(backend Backend, pollInterval, dropTimeout time.Duration, historySize, maxPending, pollWorkers, pollBatch int) (*Tracker, error) {
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+	if dropTimeout <= 0 {
+		dropTimeout = DefaultDropTimeout
+	}
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPending
+	}
+	if pollWorkers <= 0 {
+		pollWorkers = DefaultPollWorkers
+	}
+	if pollBatch <= 0 {
+		pollBatch = DefaultPollBatch
+	}
+	history, err := lru.New(historySize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tracker{
+		backend:      backend,
+		pollInterval: pollInterval,
+		dropTimeout:  dropTimeout,
+		maxPending:   maxPending,
+		pollWorkers:  pollWorkers,
+		pollBatch:    pollBatch,
+		pending:      make(map[common.Hash]*Tx),
+		history:      history,
+		counts:       make(map[string]uint64),
+		quit:         make(chan struct{}),
+	}, nil
+}
+
+// Track starts tracking the transaction
+func (t *Tracker) Track(hash common.Hash, from common.Address, to *common.Address) {
+	tx := &Tx{
+		Hash:        hash,
+		State:       StatePending,
+		SubmittedAt: time.Now(),
+	}
+	if from != (common.Address{}) {
+		tx.From = from.Hex()
+	}
+	if to != nil {
+		tx.To = to.Hex()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[hash]; ok {
+		return
+	}
+	if len(t.pending) >= t.maxPending {
+		log.Warnf("Tracker discard %s, too many pending transactions", hash.Hex())
+		return
+	}
+	t.pending[hash] = tx
+}
+
+// Get returns the tracked transaction of hash
+func (t *Tracker) Get(hash common.Hash) (Tx, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if tx, ok := t.pending[hash]; ok {
+		return *tx, true
+	}
+	if v, ok := t.history.Get(hash); ok {
+		return *v.(*Tx), true
+	}
+	return Tx{}, false
+}
+
+// Run polls the receipts every poll interval until Stop
+func (t *Tracker) Run() {
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.poll()
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+// Stop stops Run
+func (t *Tracker) Stop() {
+	close(t.quit)
+}
+
+// poll gets the receipts of a batch of pending transactions, the least recently polled first,
+// and stops at the poll interval or the receipt timeout if longer, so that a cycle is bounded
+// even if the node is unreachable
+func (t *Tracker) poll() {
+	type polled struct {
+		tx       *Tx
+		polledAt time.Time
+	}
+	t.mu.RLock()
+	txs := make([]polled, 0, len(t.pending))
+	for _, tx := range t.pending {
+		txs = append(txs, polled{tx, tx.polledAt})
+	}
+	t.mu.RUnlock()
+	sort.Slice(txs, func(i, j int) bool { return txs[i].polledAt.Before(txs[j].polledAt) })
+	if len(txs) > t.pollBatch {
+		txs = txs[:t.pollBatch]
+	}
+
+	timeout := t.pollInterval
+	if timeout < receiptTimeout {
+		timeout = receiptTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	jobs := make(chan *Tx)
+	var wg sync.WaitGroup
+	for i := 0; i < t.pollWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tx := range jobs {
+				t.check(ctx, tx)
+			}
+		}()
+	}
+send:
+	for _, p := range txs {
+		select {
+		case jobs <- p.tx:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// check gets the receipt of tx, and finalizes it if included or dropped
+func (t *Tracker) check(ctx context.Context, tx *Tx) {
+	ctx, cancel := context.WithTimeout(ctx, receiptTimeout)
+	receipt, err := t.backend.TransactionReceipt(ctx, tx.Hash)
+	cancel()
+
+	now := time.Now()
+	t.mu.Lock()
+	tx.polledAt = now
+	t.mu.Unlock()
+	switch {
+	case err == nil && receipt != nil:
+		state := StateMined
+		if receipt.Status == types.ReceiptStatusFailed {
+			state = StateFailed
+		}
+		blockNumber := uint64(0)
+		if receipt.BlockNumber != nil {
+			blockNumber = receipt.BlockNumber.Uint64()
+		}
+		t.finalize(tx, state, now, blockNumber, receipt.GasUsed)
+	case err != nil && !errors.Is(err, ethereum.NotFound):
+		log.Warnf("Tracker get receipt of %s error: %v", tx.Hash.Hex(), err)
+	case now.Sub(tx.SubmittedAt) > t.dropTimeout:
+		t.finalize(tx, StateDropped, now, 0, 0)
+	}
+}
+
+func (t *Tracker) finalize(tx *Tx, state string, now time.Time, blockNumber, gasUsed uint64) {
+	t.mu.Lock()
+	tx.State = state
+	tx.FinalizedAt = now
+	tx.BlockNumber = blockNumber
+	tx.GasUsed = gasUsed
+	if state != StateDropped {
+		tx.Latency = now.Sub(tx.SubmittedAt).Seconds()
+	}
+	delete(t.pending, tx.Hash)
+	t.history.Add(tx.Hash, tx)
+	t.counts[state]++
+	t.mu.Unlock()
+
+	log.Infof("Tracker transaction %s %s, block %d, latency %.1fs", tx.Hash.Hex(), state, blockNumber, tx.Latency)
+	notify.AddEvent(notify.NewEvent(eventTypes[state], "", map[string]interface{}{
+		"hash":        tx.Hash.Hex(),
+		"from":        tx.From,
+		"to":          tx.To,
+		"blockNumber": tx.BlockNumber,
+		"gasUsed":     tx.GasUsed,
+		"latency":     tx.Latency,
+	}))
+}
+
+var eventTypes = map[string]string{
+	StateMined:   notify.EventTxMined,
+	StateFailed:  notify.EventTxFailed,
+	StateDropped: notify.EventTxDropped,
+}
+
+// ServeHTTP responses the tracked transaction for "/tracker/tx/<hash>",
+// and the number of transactions by state for "/tracker/status"
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var v interface{}
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/tracker/tx/"):
+		hex := strings.TrimPrefix(r.URL.Path, "/tracker/tx/")
+		b, err := decodeHash(hex)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tx, ok := t.Get(b)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		v = tx
+	case r.URL.Path == "/tracker/status":
+		t.mu.RLock()
+		status := map[string]uint64{StatePending: uint64(len(t.pending))}
+		for state, count := range t.counts {
+			status[state] = count
+		}
+		t.mu.RUnlock()
+		v = status
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeHash decodes the 0x prefixed hex of transaction hash
+func decodeHash(hex string) (common.Hash, error) {
+	if !strings.HasPrefix(hex, "0x") || len(hex) != 2+2*common.HashLength {
+		return common.Hash{}, errors.New("invalid transaction hash")
+	}
+	var hash common.Hash
+	if err := hash.UnmarshalText([]byte(hex)); err != nil {
+		return common.Hash{}, errors.New("invalid transaction hash")
+	}
+	return hash, nil
+}
+
+var std *Tracker
+
+// Enable sets the tracker of Track
+func Enable(t *Tracker) {
+	std = t
+}
+
+// Enabled returns whether the tracker enabled
+func Enabled() bool {
+	return std != nil
+}
+
+// Track starts tracking the transaction if the tracker enabled
+func Track(hash common.Hash, from common.Address, to *common.Address) {
+	if std != nil {
+		std.Track(hash, from, to)
+	}
+}
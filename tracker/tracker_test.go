@@ -0,0 +1,116 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type fakeBackend struct {
+	mu       sync.Mutex
+	receipts map[common.Hash]*types.Receipt
+	polled   map[common.Hash]int
+}
+
+func (b *fakeBackend) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.polled != nil {
+		b.polled[hash]++
+	}
+	if receipt, ok := b.receipts[hash]; ok {
+		return receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func TestTracker(t *testing.T) {
+	mined := common.HexToHash("0x01")
+	failed := common.HexToHash("0x02")
+	dropped := common.HexToHash("0x03")
+	backend := &fakeBackend{receipts: map[common.Hash]*types.Receipt{
+		mined:  {Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(10), GasUsed: 21000},
+		failed: {Status: types.ReceiptStatusFailed, BlockNumber: big.NewInt(11), GasUsed: 30000},
+	}}
+	tr, err := New(backend, time.Millisecond, 50*time.Millisecond, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0x1024")
+	for _, hash := range []common.Hash{mined, failed, dropped} {
+		tr.Track(hash, common.HexToAddress("0x2048"), &to)
+	}
+
+	tr.poll()
+	for hash, want := range map[common.Hash]string{mined: StateMined, failed: StateFailed, dropped: StatePending} {
+		if tx, ok := tr.Get(hash); !ok || tx.State != want {
+			t.Errorf("%s state %s, want %s", hash.Hex(), tx.State, want)
+		}
+	}
+	if tx, _ := tr.Get(mined); tx.BlockNumber != 10 || tx.GasUsed != 21000 || tx.Latency <= 0 {
+		t.Errorf("mined tx %+v", tx)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	tr.poll()
+	if tx, _ := tr.Get(dropped); tx.State != StateDropped {
+		t.Errorf("state %s, want dropped", tx.State)
+	}
+
+	w := httptest.NewRecorder()
+	tr.ServeHTTP(w, httptest.NewRequest("GET", "/tracker/tx/"+failed.Hex(), nil))
+	var tx Tx
+	if err := json.NewDecoder(w.Body).Decode(&tx); err != nil || tx.Hash != failed || tx.State != StateFailed {
+		t.Errorf("query tx %+v, error %v", tx, err)
+	}
+
+	for _, hash := range []string{"0x04", failed.Hex()[2:]} {
+		w = httptest.NewRecorder()
+		tr.ServeHTTP(w, httptest.NewRequest("GET", "/tracker/tx/"+hash, nil))
+		if w.Code != 400 {
+			t.Errorf("query invalid hash %s code %d, want 400", hash, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	tr.ServeHTTP(w, httptest.NewRequest("GET", "/tracker/status", nil))
+	var status map[string]uint64
+	json.NewDecoder(w.Body).Decode(&status)
+	if status[StatePending] != 0 || status[StateMined] != 1 || status[StateFailed] != 1 || status[StateDropped] != 1 {
+		t.Errorf("status %v", status)
+	}
+}
+
+func TestTrackerPollBatch(t *testing.T) {
+	backend := &fakeBackend{polled: make(map[common.Hash]int)}
+	tr, err := New(backend, time.Millisecond, time.Hour, 0, 0, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		tr.Track(common.BigToHash(big.NewInt(int64(i))), common.Address{}, nil)
+	}
+
+	// the least recently polled first, so all are polled in 3 cycles of 2
+	for i := 0; i < 3; i++ {
+		tr.poll()
+	}
+	total := 0
+	for hash, n := range backend.polled {
+		if n < 1 || n > 2 {
+			t.Errorf("%s polled %d times", hash.Hex(), n)
+		}
+		total += n
+	}
+	if len(backend.polled) != 5 || total != 6 {
+		t.Errorf("polled %d txs %d times, want 5 txs 6 times", len(backend.polled), total)
+	}
+}
@@ -0,0 +1,278 @@
+package velocity
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var recordPrefix = []byte("v") // recordPrefix + from(20) + time(8) + hash -> value
+
+var pruneInterval = time.Minute
+
+// Limit limits the total value and the number of transactions sent in the rolling Window
+type Limit struct {
+	Window   time.Duration
+	MaxValue *big.Int // nil or zero for no value limit
+	MaxCount int      // 0 for no count limit
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%v value %v count %d", l.Window, l.MaxValue, l.MaxCount)
+}
+
+// record is a transaction counted in the window of its sender
+type record struct {
+	time  time.Time
+	hash  common.Hash
+	value *big.Int
+}
+
+// Limiter limits the value velocity per sender by the rolling windows,
+// the senders in overrides are limited by their own limits instead
+type Limiter struct {
+	limits    []Limit
+	overrides map[common.Address][]Limit
+	maxWindow time.Duration
+
+	db *leveldb.DB // nil if memory only
+
+	mu      sync.Mutex
+	records map[common.Address][]record // in order of time
+	quit    chan struct{}
+}
+
+// Open returns the limiter persisted in LevelDB at path, or a memory only limiter if path is empty
+func Open(path string, limits []Limit, overrides map[common.Address][]Limit) (*Limiter, error) {
+	if len(limits) == 0 && len(overrides) == 0 {
+		return nil, errors.New("velocity limits not set")
+	}
+	l := &Limiter{
+		limits:    limits,
+		overrides: overrides,
+		records:   make(map[common.Address][]record),
+		quit:      make(chan struct{}),
+	}
+	for _, limit := range limits {
+		if limit.Window <= 0 {
+			return nil, fmt.Errorf("velocity limit %v window not set", limit)
+		}
+		if limit.Window > l.maxWindow {
+			l.maxWindow = limit.Window
+		}
+	}
+	for from, limits := range overrides {
+		for _, limit := range limits {
+			if limit.Window <= 0 {
+				return nil, fmt.Errorf("velocity limit %v of %s window not set", limit, from.Hex())
+			}
+			if limit.Window > l.maxWindow {
+				l.maxWindow = limit.Window
+			}
+		}
+	}
+
+	if path == "" {
+		return l, nil
+	}
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	l.db = db
+	if err := l.load(time.Now()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func recordKey(from common.Address, rec record) []byte {
+	key := make([]byte, 0, len(recordPrefix)+common.AddressLength+8+common.HashLength)
+	key = append(key, recordPrefix...)
+	key = append(key, from.Bytes()...)
+	key = binary.BigEndian.AppendUint64(key, uint64(rec.time.UnixNano()))
+	return append(key, rec.hash.Bytes()...)
+}
+
+// load reads the records in the largest window before now, and removes the older ones
+func (l *Limiter) load(now time.Time) error {
+	batch := new(leveldb.Batch)
+	iter := l.db.NewIterator(util.BytesPrefix(recordPrefix), nil)
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(recordPrefix)+common.AddressLength+8+common.HashLength {
+			batch.Delete(append([]byte{}, key...))
+			continue
+		}
+		key = key[len(recordPrefix):]
+		from := common.BytesToAddress(key[:common.AddressLength])
+		rec := record{
+			time:  time.Unix(0, int64(binary.BigEndian.Uint64(key[common.AddressLength:]))),
+			hash:  common.BytesToHash(key[common.AddressLength+8:]),
+			value: new(big.Int).SetBytes(iter.Value()),
+		}
+		if now.Sub(rec.time) >= l.maxWindow {
+			batch.Delete(append([]byte{}, iter.Key()...))
+			continue
+		}
+		// keys of sender are in order of time
+		l.records[from] = append(l.records[from], rec)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return l.db.Write(batch, nil)
+}
+
+// limitsOf returns the limits of sender from
+func (l *Limiter) limitsOf(from common.Address) []Limit {
+	if limits, ok := l.overrides[from]; ok {
+		return limits
+	}
+	return l.limits
+}
+
+// Allow counts the transaction of hash sending value from, and returns whether it is within
+// all the limits of from at now, the transaction counted already is always allowed
+func (l *Limiter) Allow(from common.Address, hash common.Hash, value *big.Int, now time.Time) (Limit, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := l.prune(from, now)
+	for _, rec := range records {
+		if rec.hash == hash {
+			return Limit{}, true
+		}
+	}
+
+	for _, limit := range l.limitsOf(from) {
+		count, total := 1, new(big.Int).Set(value)
+		for _, rec := range records {
+			if now.Sub(rec.time) < limit.Window {
+				count++
+				total.Add(total, rec.value)
+			}
+		}
+		if limit.MaxCount > 0 && count > limit.MaxCount {
+			return limit, false
+		}
+		if limit.MaxValue != nil && limit.MaxValue.Sign() > 0 && total.Cmp(limit.MaxValue) > 0 {
+			return limit, false
+		}
+	}
+
+	rec := record{time: now, hash: hash, value: new(big.Int).Set(value)}
+	l.records[from] = append(records, rec)
+	if l.db != nil {
+		if err := l.db.Put(recordKey(from, rec), rec.value.Bytes(), nil); err != nil {
+			log.Errorf("Velocity save %s error: %v", hash.Hex(), err)
+		}
+	}
+
+	return Limit{}, true
+}
+
+// Release uncounts the transaction of hash sent from, such as the transaction not forwarded at last
+func (l *Limiter) Release(from common.Address, hash common.Hash) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := l.records[from]
+	for i, rec := range records {
+		if rec.hash != hash {
+			continue
+		}
+		l.records[from] = append(records[:i:i], records[i+1:]...)
+		if len(l.records[from]) == 0 {
+			delete(l.records, from)
+		}
+		if l.db != nil {
+			if err := l.db.Delete(recordKey(from, rec), nil); err != nil {
+				log.Errorf("Velocity remove %s error: %v", hash.Hex(), err)
+			}
+		}
+		return
+	}
+}
+
+// prune removes the records of from out of the largest window at now, and returns the rest
+func (l *Limiter) prune(from common.Address, now time.Time) []record {
+	records := l.records[from]
+	i := 0
+	for ; i < len(records) && now.Sub(records[i].time) >= l.maxWindow; i++ {
+		if l.db != nil {
+			if err := l.db.Delete(recordKey(from, records[i]), nil); err != nil {
+				log.Errorf("Velocity remove %s error: %v", records[i].hash.Hex(), err)
+			}
+		}
+	}
+	records = records[i:]
+	if len(records) == 0 {
+		delete(l.records, from)
+		return nil
+	}
+	l.records[from] = records
+	return records
+}
+
+// pruneAll removes the records of all senders out of the largest window at now
+func (l *Limiter) pruneAll(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for from := range l.records {
+		l.prune(from, now)
+	}
+}
+
+// Len returns the number of senders counted
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.records)
+}
+
+// Run removes the expired records until Close
+func (l *Limiter) Run() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.pruneAll(time.Now())
+		case <-l.quit:
+			return
+		}
+	}
+}
+
+// Close stops Run and closes the limiter
+func (l *Limiter) Close() error {
+	close(l.quit)
+	if l.db != nil {
+		return l.db.Close()
+	}
+	return nil
+}
+
+var std *Limiter
+
+// Enable sets the limiter checking the senders
+func Enable(l *Limiter) {
+	std = l
+}
+
+// Default returns the limiter enabled, or nil
+func Default() *Limiter {
+	return std
+}
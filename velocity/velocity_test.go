@@ -0,0 +1,107 @@
+package velocity
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestLimiter(t *testing.T) {
+	sender := common.HexToAddress("0x1024")
+	hot := common.HexToAddress("0x2048")
+	l, err := Open("", []Limit{
+		{Window: time.Hour, MaxValue: big.NewInt(100), MaxCount: 3},
+		{Window: 24 * time.Hour, MaxValue: big.NewInt(150)},
+	}, map[common.Address][]Limit{
+		hot: {{Window: time.Hour, MaxValue: big.NewInt(1000)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Now()
+	allow := func(from common.Address, hash byte, value int64, at time.Time) bool {
+		_, ok := l.Allow(from, common.Hash{hash}, big.NewInt(value), at)
+		return ok
+	}
+
+	if !allow(sender, 1, 60, now) || !allow(sender, 2, 40, now) {
+		t.Fatal("rejected within the limits")
+	}
+	if allow(sender, 3, 1, now) {
+		t.Error("allowed above the hourly value")
+	}
+	if !allow(sender, 1, 60, now) {
+		t.Error("rejected the transaction counted already")
+	}
+	if !allow(sender, 3, 0, now) {
+		t.Error("rejected the zero value within the count")
+	}
+	if allow(sender, 4, 0, now) {
+		t.Error("allowed above the hourly count")
+	}
+	if allow(sender, 5, 60, now.Add(time.Hour)) {
+		t.Error("allowed above the daily value")
+	}
+	if !allow(sender, 5, 50, now.Add(time.Hour)) {
+		t.Error("rejected within the daily value")
+	}
+	if !allow(sender, 6, 100, now.Add(24*time.Hour+time.Second)) {
+		t.Error("rejected after the window of the earlier transactions")
+	}
+
+	// overrides
+	if !allow(hot, 1, 900, now) {
+		t.Error("rejected within the override")
+	}
+	if allow(hot, 2, 101, now) {
+		t.Error("allowed above the override")
+	}
+
+	// released
+	l.Release(hot, common.Hash{1})
+	if !allow(hot, 2, 101, now) {
+		t.Error("rejected after released")
+	}
+
+	l.pruneAll(now.Add(72 * time.Hour))
+	if n := l.Len(); n != 0 {
+		t.Errorf("limiter len %d, want 0 after pruned", n)
+	}
+}
+
+func TestLimiterPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "velocity")
+	sender := common.HexToAddress("0x1024")
+	limits := []Limit{{Window: time.Hour, MaxCount: 2}}
+
+	l, err := Open(path, limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := byte(0); i < 2; i++ {
+		if _, ok := l.Allow(sender, common.Hash{i}, big.NewInt(1), now); !ok {
+			t.Fatal("rejected within the limits")
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Open(path, limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, ok := l.Allow(sender, common.Hash{2}, big.NewInt(1), now); ok {
+		t.Error("allowed above the count persisted")
+	}
+	if _, ok := l.Allow(sender, common.Hash{2}, big.NewInt(1), now.Add(time.Hour)); !ok {
+		t.Error("rejected after the window")
+	}
+}